@@ -0,0 +1,211 @@
+package jog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Canonical serializes a value as defined by the JSON Canonicalization
+// Scheme (RFC 8785): no whitespace, object members sorted by the UTF-16 code
+// units of their names, numbers formatted like ECMAScript's
+// Number.prototype.toString and strings with minimal escaping. The output is
+// byte-identical across backends, which makes it suitable for signing.
+//
+// Numbers are IEEE 754 doubles in JCS, integers beyond 2^53 lose precision
+// and NaN or infinite values are an error.
+func Canonical(v Value) (string, error) {
+	var buf bytes.Buffer
+	if err := writeCanonical(&buf, v); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func writeCanonical(buf *bytes.Buffer, v Value) error {
+	switch v.Type() {
+	case TypeNull:
+		buf.WriteString("null")
+	case TypeBool:
+		b, err := v.GetBool()
+		if err != nil {
+			return err
+		}
+		buf.WriteString(strconv.FormatBool(b))
+	case TypeNumber:
+		str, err := v.Stringify()
+		if err != nil {
+			return err
+		}
+		f, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			return fmt.Errorf("Could not read number %s: %v", str, err)
+		}
+		num, err := formatES6(f)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(num)
+	case TypeString:
+		s, err := v.GetString()
+		if err != nil {
+			return err
+		}
+		return writeCanonicalString(buf, s)
+	case TypeArray:
+		elems, err := v.GetArray()
+		if err != nil {
+			return err
+		}
+		buf.WriteByte('[')
+		for i, elem := range elems {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonical(buf, elem); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case TypeObject:
+		members, err := v.GetObject()
+		if err != nil {
+			return err
+		}
+		keys := make([]string, 0, len(members))
+		for k := range members {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return compareUTF16(keys[i], keys[j]) < 0
+		})
+		buf.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonicalString(buf, k); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			if err := writeCanonical(buf, members[k]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	default:
+		return errors.New("Could not serialize a value of unknown type!")
+	}
+	return nil
+}
+
+// Only quotes, backslashes and control characters are escaped, using the
+// short forms where JSON has them and lowercase \u00xx otherwise.
+func writeCanonicalString(buf *bytes.Buffer, s string) error {
+	const hex = "0123456789abcdef"
+	if !utf8.ValidString(s) {
+		return fmt.Errorf("Could not serialize invalid UTF-8 string %q", s)
+	}
+	buf.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if c < 0x20 {
+				buf.WriteString(`\u00`)
+				buf.WriteByte(hex[c>>4])
+				buf.WriteByte(hex[c&0xF])
+			} else {
+				buf.WriteByte(c)
+			}
+		}
+	}
+	buf.WriteByte('"')
+	return nil
+}
+
+// Member names sort by UTF-16 code units, which differs from UTF-8 byte
+// order for characters beyond the Basic Multilingual Plane.
+func compareUTF16(a string, b string) int {
+	x := utf16.Encode([]rune(a))
+	y := utf16.Encode([]rune(b))
+	for i := 0; i < len(x) && i < len(y); i++ {
+		if x[i] != y[i] {
+			return int(x[i]) - int(y[i])
+		}
+	}
+	return len(x) - len(y)
+}
+
+// Format a double like ECMAScript's Number.prototype.toString (ECMA-262,
+// section 7.1.12.1), from the shortest digits that round-trip.
+func formatES6(f float64) (string, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return "", fmt.Errorf("Could not serialize %v, JSON has no such number", f)
+	}
+	if f == 0 {
+		return "0", nil
+	}
+	sign := ""
+	if f < 0 {
+		sign = "-"
+		f = -f
+	}
+
+	// Shortest digits and exponent, e.g. "1.2345e+06".
+	e := strconv.FormatFloat(f, 'e', -1, 64)
+	mantissa, exp := e, 0
+	if i := strings.IndexByte(e, 'e'); i >= 0 {
+		mantissa = e[:i]
+		exp, _ = strconv.Atoi(e[i+1:])
+	}
+	digits := strings.Replace(mantissa, ".", "", 1)
+	k := len(digits)
+	// The value is 0.digits * 10^n.
+	n := exp + 1
+
+	var out string
+	switch {
+	case k <= n && n <= 21:
+		out = digits + strings.Repeat("0", n-k)
+	case 0 < n && n <= 21:
+		out = digits[:n] + "." + digits[n:]
+	case -6 < n && n <= 0:
+		out = "0." + strings.Repeat("0", -n) + digits
+	default:
+		expSign := "+"
+		if n-1 < 0 {
+			expSign = "-"
+		}
+		abs := n - 1
+		if abs < 0 {
+			abs = -abs
+		}
+		out = digits[:1]
+		if k > 1 {
+			out += "." + digits[1:]
+		}
+		out += "e" + expSign + strconv.Itoa(abs)
+	}
+	return sign + out, nil
+}
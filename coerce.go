@@ -0,0 +1,298 @@
+package jog
+
+import (
+	"errors"
+	"iter"
+	"strconv"
+
+	"github.com/anantn/jog/internal/number"
+)
+
+// Coerce returns a view of v whose getters convert between types where the
+// value survives the conversion, instead of failing:
+//
+//   - GetInt, GetUInt, GetFloat and NumberKind accept numeric strings, and
+//     GetInt and GetUInt accept floats without a fraction, such as 2.0 or 1e3.
+//   - GetBool accepts the strings "true" and "false".
+//   - GetString accepts numbers and returns their shortest JSON text:
+//     integers in full, and other numbers as Canonical writes them.
+//
+// A conversion that would lose precision, such as 2.5 to an int or 2^53+1
+// to a float, fails with an error saying so. Values found through the view
+// are coerced as well. Without Coerce, the getters of every backend only
+// convert numbers as described for GetInt, GetUInt and GetFloat.
+func Coerce(v Value) Value {
+	switch v.(type) {
+	case coerced, *coerced:
+		return v
+	}
+	return coerced{v}
+}
+
+type coerced struct {
+	Value
+}
+
+// Data Getters.
+func (c coerced) Get(path ...string) (Value, error) {
+	n, err := c.Value.Get(path...)
+	if err != nil {
+		return nil, err
+	}
+	return coerced{n}, nil
+}
+
+func (c coerced) At(path *Path) (Value, error) {
+	n, err := c.Value.At(path)
+	if err != nil {
+		return nil, err
+	}
+	return coerced{n}, nil
+}
+
+func (c coerced) GetInt(path ...string) (int, error) {
+	n, err := c.number("int", path)
+	if err != nil {
+		return 0, err
+	}
+	if n, err = n.Integral(); err == nil {
+		var i int
+		if i, err = n.Int(); err == nil {
+			return i, nil
+		}
+	}
+	return 0, NumberError(err, "int", path)
+}
+
+func (c coerced) GetUInt(path ...string) (uint, error) {
+	n, err := c.number("uint", path)
+	if err != nil {
+		return 0, err
+	}
+	if n, err = n.Integral(); err == nil {
+		var u uint
+		if u, err = n.Uint(); err == nil {
+			return u, nil
+		}
+	}
+	return 0, NumberError(err, "uint", path)
+}
+
+func (c coerced) GetFloat(path ...string) (float64, error) {
+	n, err := c.number("float", path)
+	if err != nil {
+		return 0, err
+	}
+	f, err := n.Float()
+	if err != nil {
+		return 0, NumberError(err, "float", path)
+	}
+	return f, nil
+}
+
+func (c coerced) NumberKind(path ...string) (NumberKind, error) {
+	n, err := c.number("number", path)
+	if err != nil {
+		return 0, err
+	}
+	return NumberKind(n.Flags()), nil
+}
+
+func (c coerced) GetBool(path ...string) (bool, error) {
+	v, err := c.Value.Get(path...)
+	if err != nil {
+		return false, expectError(err, "bool")
+	}
+	if v.Type() != TypeString {
+		b, err := v.GetBool()
+		return b, PrefixError(err, path)
+	}
+	s, err := v.GetString()
+	if err != nil {
+		return false, PrefixError(err, path)
+	}
+	switch s {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return false, MismatchError(path, "bool", TypeString)
+}
+
+func (c coerced) GetString(path ...string) (string, error) {
+	v, err := c.Value.Get(path...)
+	if err != nil {
+		return "", expectError(err, "string")
+	}
+	if v.Type() != TypeNumber {
+		s, err := v.GetString()
+		return s, PrefixError(err, path)
+	}
+	n, err := getNumber(v)
+	if err != nil {
+		return "", PrefixError(err, path)
+	}
+	switch n.Kind {
+	case number.Int:
+		return strconv.FormatInt(n.I, 10), nil
+	case number.Uint:
+		return strconv.FormatUint(n.U, 10), nil
+	}
+	return formatES6(n.F)
+}
+
+func (c coerced) GetArray(path ...string) ([]Value, error) {
+	array, err := c.Value.GetArray(path...)
+	for i, elem := range array {
+		array[i] = coerced{elem}
+	}
+	return array, err
+}
+
+func (c coerced) GetObject(path ...string) (map[string]Value, error) {
+	members, err := c.Value.GetObject(path...)
+	for key, member := range members {
+		members[key] = coerced{member}
+	}
+	return members, err
+}
+
+func (c coerced) Index(i int, path ...string) (Value, error) {
+	e, err := c.Value.Index(i, path...)
+	if err != nil {
+		return nil, err
+	}
+	return coerced{e}, nil
+}
+
+func (c coerced) IndexInt(i int, path ...string) (int, error) {
+	e, err := c.element("int", i, path)
+	if err != nil {
+		return 0, err
+	}
+	r, err := e.GetInt()
+	return r, ElementError(err, path, i)
+}
+
+func (c coerced) IndexUInt(i int, path ...string) (uint, error) {
+	e, err := c.element("uint", i, path)
+	if err != nil {
+		return 0, err
+	}
+	r, err := e.GetUInt()
+	return r, ElementError(err, path, i)
+}
+
+func (c coerced) IndexFloat(i int, path ...string) (float64, error) {
+	e, err := c.element("float", i, path)
+	if err != nil {
+		return 0, err
+	}
+	r, err := e.GetFloat()
+	return r, ElementError(err, path, i)
+}
+
+func (c coerced) IndexBool(i int, path ...string) (bool, error) {
+	e, err := c.element("bool", i, path)
+	if err != nil {
+		return false, err
+	}
+	r, err := e.GetBool()
+	return r, ElementError(err, path, i)
+}
+
+func (c coerced) IndexString(i int, path ...string) (string, error) {
+	e, err := c.element("string", i, path)
+	if err != nil {
+		return "", err
+	}
+	r, err := e.GetString()
+	return r, ElementError(err, path, i)
+}
+
+func (c coerced) Elements(path ...string) iter.Seq2[int, Value] {
+	return Elements(c, path...)
+}
+
+func (c coerced) ArrayIterator(path ...string) (ArrayIterator, error) {
+	it, err := c.Value.ArrayIterator(path...)
+	if err != nil {
+		return nil, err
+	}
+	return &coercedArrayIterator{ArrayIterator: it}, nil
+}
+
+func (c coerced) ObjectIterator(path ...string) (ObjectIterator, error) {
+	it, err := c.Value.ObjectIterator(path...)
+	if err != nil {
+		return nil, err
+	}
+	return &coercedObjectIterator{ObjectIterator: it}, nil
+}
+
+// Private methods.
+
+// The iterators coerce the values of the iterators they wrap through one
+// view each, reused from step to step like the values are.
+type coercedArrayIterator struct {
+	ArrayIterator
+	view coerced
+}
+
+func (it *coercedArrayIterator) Value() Value {
+	if it.view.Value = it.ArrayIterator.Value(); it.view.Value == nil {
+		return nil
+	}
+	return &it.view
+}
+
+type coercedObjectIterator struct {
+	ObjectIterator
+	view coerced
+}
+
+func (it *coercedObjectIterator) Value() Value {
+	if it.view.Value = it.ObjectIterator.Value(); it.view.Value == nil {
+		return nil
+	}
+	return &it.view
+}
+
+// Element i of the array at path, with a missing element reported to a
+// getter asking for expected.
+func (c coerced) element(expected string, i int, path []string) (coerced, error) {
+	e, err := c.Value.Index(i, path...)
+	var pe *PathError
+	if errors.As(err, &pe) && pe.Err == ErrNotFound && pe.Segment == len(path) {
+		return coerced{}, expectError(err, expected)
+	} else if err != nil {
+		return coerced{}, err
+	}
+	return coerced{e}, nil
+}
+
+// The number at path, or in the string at path. The value is found once,
+// and a number is read as the backend keeps it.
+func (c coerced) number(name string, path []string) (number.Number, error) {
+	v, err := c.Value.Get(path...)
+	if err != nil {
+		return number.Number{}, expectError(err, name)
+	}
+	switch t := v.Type(); t {
+	case TypeNumber:
+		n, err := getNumber(v)
+		return n, PrefixError(err, path)
+	case TypeString:
+		text, err := v.GetString()
+		if err != nil {
+			return number.Number{}, PrefixError(err, path)
+		}
+		if number.Valid(text) {
+			return number.Parse(text), nil
+		}
+		return number.Number{}, MismatchError(path, name, TypeString)
+	default:
+		return number.Number{}, MismatchError(path, name, t)
+	}
+}
@@ -0,0 +1,259 @@
+package jog
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type ChangeKind int
+
+const (
+	ChangeAdded ChangeKind = iota
+	ChangeRemoved
+	ChangeChanged
+	ChangeTypeChanged
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case ChangeAdded:
+		return "added"
+	case ChangeRemoved:
+		return "removed"
+	case ChangeChanged:
+		return "changed"
+	case ChangeTypeChanged:
+		return "type changed"
+	}
+	return "unknown"
+}
+
+// Change is a single difference between two documents.
+type Change struct {
+	Kind ChangeKind
+	// Object keys and array indexes leading to the change.
+	Path []string
+	// Old is nil for ChangeAdded, New is nil for ChangeRemoved.
+	Old Value
+	New Value
+}
+
+// Pointer returns the path of the change as a JSON Pointer.
+func (c Change) Pointer() string {
+	var buf bytes.Buffer
+	for _, part := range c.Path {
+		buf.WriteByte('/')
+		buf.WriteString(strings.Replace(strings.Replace(part, "~", "~0", -1), "/", "~1", -1))
+	}
+	return buf.String()
+}
+
+// DiffOptions tune Diff.
+type DiffOptions struct {
+	// Numbers closer than this are equal.
+	Tolerance float64
+	// JSON Pointers of subtrees to skip. A "*" segment matches any key or
+	// index, e.g. "/items/*/updatedAt".
+	Ignore []string
+}
+
+// Diff compares two documents structurally: object member order, whitespace
+// and number formatting do not matter. Arrays are compared position by
+// position. Changes are sorted by path.
+func Diff(a Value, b Value) []Change {
+	return DiffOptions{}.Diff(a, b)
+}
+
+// Diff with these options.
+func (o DiffOptions) Diff(a Value, b Value) []Change {
+	d := &differ{opts: o}
+	for _, ptr := range o.Ignore {
+		d.ignore = append(d.ignore, splitPointer(ptr))
+	}
+	d.diff(a, b, []string{})
+	return d.changes
+}
+
+// FormatDiff renders changes in the style of a unified diff, one hunk per
+// changed path:
+//
+//	@@ /details/age @@
+//	-36
+//	+37
+func FormatDiff(changes []Change) string {
+	var buf bytes.Buffer
+	for _, c := range changes {
+		ptr := c.Pointer()
+		if ptr == "" {
+			ptr = "/"
+		}
+		if c.Kind == ChangeTypeChanged {
+			fmt.Fprintf(&buf, "@@ %s (%s -> %s) @@\n", ptr, c.Old.Type(), c.New.Type())
+		} else {
+			fmt.Fprintf(&buf, "@@ %s @@\n", ptr)
+		}
+		if c.Old != nil {
+			writeLine(&buf, '-', c.Old)
+		}
+		if c.New != nil {
+			writeLine(&buf, '+', c.New)
+		}
+	}
+	return buf.String()
+}
+
+type differ struct {
+	opts    DiffOptions
+	ignore  [][]string
+	changes []Change
+}
+
+func (d *differ) diff(a Value, b Value, path []string) {
+	if d.ignored(path) {
+		return
+	}
+	ta, tb := a.Type(), b.Type()
+	if ta != tb {
+		d.add(ChangeTypeChanged, path, a, b)
+		return
+	}
+	switch ta {
+	case TypeObject:
+		x, _ := a.GetObject()
+		y, _ := b.GetObject()
+		keys := make([]string, 0, len(x)+len(y))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		for k := range y {
+			if _, ok := x[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			child := appendPath(path, k)
+			xv, inX := x[k]
+			yv, inY := y[k]
+			switch {
+			case !inY:
+				if !d.ignored(child) {
+					d.add(ChangeRemoved, child, xv, nil)
+				}
+			case !inX:
+				if !d.ignored(child) {
+					d.add(ChangeAdded, child, nil, yv)
+				}
+			default:
+				d.diff(xv, yv, child)
+			}
+		}
+	case TypeArray:
+		x, _ := a.GetArray()
+		y, _ := b.GetArray()
+		for i := 0; i < len(x) || i < len(y); i++ {
+			child := appendPath(path, strconv.Itoa(i))
+			switch {
+			case i >= len(y):
+				if !d.ignored(child) {
+					d.add(ChangeRemoved, child, x[i], nil)
+				}
+			case i >= len(x):
+				if !d.ignored(child) {
+					d.add(ChangeAdded, child, nil, y[i])
+				}
+			default:
+				d.diff(x[i], y[i], child)
+			}
+		}
+	case TypeNumber:
+		if !numbersEqual(a, b, d.opts.Tolerance) {
+			d.add(ChangeChanged, path, a, b)
+		}
+	case TypeString:
+		x, _ := a.GetString()
+		y, _ := b.GetString()
+		if x != y {
+			d.add(ChangeChanged, path, a, b)
+		}
+	case TypeBool:
+		x, _ := a.GetBool()
+		y, _ := b.GetBool()
+		if x != y {
+			d.add(ChangeChanged, path, a, b)
+		}
+	}
+}
+
+func (d *differ) add(kind ChangeKind, path []string, old Value, next Value) {
+	d.changes = append(d.changes, Change{kind, path, old, next})
+}
+
+func (d *differ) ignored(path []string) bool {
+	for _, pattern := range d.ignore {
+		if len(pattern) > len(path) {
+			continue
+		}
+		matched := true
+		for i, part := range pattern {
+			if part != "*" && part != path[i] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Utility functions.
+
+func appendPath(path []string, part string) []string {
+	child := make([]string, len(path)+1)
+	copy(child, path)
+	child[len(path)] = part
+	return child
+}
+
+// The whole document is "", while "/" is the member with the empty key, as
+// in RFC 6901.
+func splitPointer(ptr string) []string {
+	if ptr == "" {
+		return []string{}
+	}
+	parts := strings.Split(strings.TrimPrefix(ptr, "/"), "/")
+	for i, part := range parts {
+		parts[i] = strings.Replace(strings.Replace(part, "~1", "/", -1), "~0", "~", -1)
+	}
+	return parts
+}
+
+func writeLine(buf *bytes.Buffer, prefix byte, v Value) {
+	str, err := v.Stringify()
+	if err != nil {
+		str = fmt.Sprintf("<%v>", err)
+	}
+	buf.WriteByte(prefix)
+	buf.WriteString(str)
+	buf.WriteByte('\n')
+}
+
+// Numbers are equal if they read the same through the getters, or within
+// tolerance if it is above zero. Only numbers that differ are read again.
+func numbersEqual(a Value, b Value, tolerance float64) bool {
+	if c, ok := compareNumbers(a, b); !ok || c == 0 {
+		return ok
+	}
+	if tolerance <= 0 {
+		return false
+	}
+	x, _ := getNumber(a)
+	y, _ := getNumber(b)
+	return math.Abs(x.Approx()-y.Approx()) <= tolerance
+}
@@ -0,0 +1,200 @@
+package jog
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Encoder writes a JSON document token by token to an io.Writer, so large
+// documents never need to be held in memory. Tokens must form exactly one
+// valid document: a key is only accepted directly inside an object, every
+// member needs a key, and containers must be closed in order. A token that
+// breaks these rules returns an error and writes nothing.
+//
+// Output is buffered; Flush pushes it to the underlying writer and Close
+// flushes, releases the native generator and reports an incomplete document.
+type Encoder interface {
+	BeginObject() error
+	EndObject() error
+	BeginArray() error
+	EndArray() error
+	Key(k string) error
+
+	Null() error
+	Bool(b bool) error
+	Int64(i int64) error
+	Uint64(u uint64) error
+	Float64(f float64) error
+	String(s string) error
+	// Value writes a whole value. Values of the encoder's own backend are
+	// written natively, others like EncodeValue.
+	Value(v Value) error
+
+	Flush() error
+	Close() error
+}
+
+// EncodeValue writes a value of any backend token by token. Object members
+// are written in the order given by a Keys method if the value has one, and
+// sorted by key otherwise. Numbers keep their exact text if it fits an
+// int64 or uint64 and are written as float64 otherwise.
+func EncodeValue(e Encoder, v Value) error {
+	switch v.Type() {
+	case TypeNull:
+		return e.Null()
+	case TypeBool:
+		b, err := v.GetBool()
+		if err != nil {
+			return err
+		}
+		return e.Bool(b)
+	case TypeNumber:
+		str, err := v.Stringify()
+		if err != nil {
+			return err
+		}
+		if i, err := strconv.ParseInt(str, 10, 64); err == nil {
+			return e.Int64(i)
+		}
+		if u, err := strconv.ParseUint(str, 10, 64); err == nil {
+			return e.Uint64(u)
+		}
+		f, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			return fmt.Errorf("Could not read number %s: %v", str, err)
+		}
+		return e.Float64(f)
+	case TypeString:
+		s, err := v.GetString()
+		if err != nil {
+			return err
+		}
+		return e.String(s)
+	case TypeArray:
+		elems, err := v.GetArray()
+		if err != nil {
+			return err
+		}
+		if err := e.BeginArray(); err != nil {
+			return err
+		}
+		for _, elem := range elems {
+			if err := EncodeValue(e, elem); err != nil {
+				return err
+			}
+		}
+		return e.EndArray()
+	case TypeObject:
+		members, err := v.GetObject()
+		if err != nil {
+			return err
+		}
+		var keys []string
+		if ordered, ok := v.(interface{ Keys() []string }); ok {
+			keys = ordered.Keys()
+		} else {
+			keys = make([]string, 0, len(members))
+			for k := range members {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+		}
+		if err := e.BeginObject(); err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := e.Key(k); err != nil {
+				return err
+			}
+			if err := EncodeValue(e, members[k]); err != nil {
+				return err
+			}
+		}
+		return e.EndObject()
+	}
+	return errors.New("Could not encode a value of unknown type!")
+}
+
+// EncoderState tracks the structure written so far by an Encoder. Backends
+// call it before handing a token to the native generator, which would
+// otherwise emit broken JSON or abort on a misplaced token.
+type EncoderState struct {
+	stack    []Type
+	needsVal bool
+	complete bool
+}
+
+// Key checks that an object member name may be written.
+func (s *EncoderState) Key() error {
+	if s.complete {
+		return errors.New("Could not write key, the document is complete!")
+	}
+	if len(s.stack) == 0 || s.stack[len(s.stack)-1] != TypeObject {
+		return errors.New("Could not write key outside of an object!")
+	}
+	if s.needsVal {
+		return errors.New("Could not write key, the previous key has no value!")
+	}
+	s.needsVal = true
+	return nil
+}
+
+// Value checks that a scalar of type t may be written.
+func (s *EncoderState) Value(t Type) error {
+	if err := s.value(t); err != nil {
+		return err
+	}
+	if len(s.stack) == 0 {
+		s.complete = true
+	}
+	return nil
+}
+
+// Begin checks that an array or object may be opened.
+func (s *EncoderState) Begin(t Type) error {
+	if err := s.value(t); err != nil {
+		return err
+	}
+	s.stack = append(s.stack, t)
+	return nil
+}
+
+// End checks that the innermost array or object may be closed.
+func (s *EncoderState) End(t Type) error {
+	if len(s.stack) == 0 || s.stack[len(s.stack)-1] != t {
+		return fmt.Errorf("Could not end %s, none is open!", t)
+	}
+	if s.needsVal {
+		return errors.New("Could not end object, the last key has no value!")
+	}
+	s.stack = s.stack[:len(s.stack)-1]
+	if len(s.stack) == 0 {
+		s.complete = true
+	}
+	return nil
+}
+
+// Complete reports whether exactly one whole value has been written.
+func (s *EncoderState) Complete() bool {
+	return s.complete
+}
+
+// Depth returns the number of open arrays and objects.
+func (s *EncoderState) Depth() int {
+	return len(s.stack)
+}
+
+func (s *EncoderState) value(t Type) error {
+	if s.complete {
+		return fmt.Errorf("Could not write %s, the document is complete!", t)
+	}
+	if len(s.stack) > 0 && s.stack[len(s.stack)-1] == TypeObject {
+		if !s.needsVal {
+			return fmt.Errorf("Could not write %s in an object without a key!", t)
+		}
+		s.needsVal = false
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package jog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Encoding is the Unicode encoding of a JSON text. The values match
+// rapidjson's UTFType.
+type Encoding int
+
+const (
+	EncodingUTF8 Encoding = iota
+	EncodingUTF16LE
+	EncodingUTF16BE
+	EncodingUTF32LE
+	EncodingUTF32BE
+	// Detect the encoding from a byte order mark, or failing that from the
+	// pattern of NUL bytes in the first four bytes (RFC 4627, section 3).
+	EncodingAuto
+)
+
+func (e Encoding) String() string {
+	switch e {
+	case EncodingUTF8:
+		return "UTF-8"
+	case EncodingUTF16LE:
+		return "UTF-16LE"
+	case EncodingUTF16BE:
+		return "UTF-16BE"
+	case EncodingUTF32LE:
+		return "UTF-32LE"
+	case EncodingUTF32BE:
+		return "UTF-32BE"
+	case EncodingAuto:
+		return "auto"
+	}
+	return "unknown"
+}
+
+// DetectEncoding returns the encoding of a JSON text and the length of its
+// byte order mark, if any. Without a byte order mark the first two
+// characters are assumed to be ASCII, as in RFC 4627.
+func DetectEncoding(data []byte) (Encoding, int) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0x00, 0x00, 0xFE, 0xFF}):
+		return EncodingUTF32BE, 4
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE, 0x00, 0x00}):
+		return EncodingUTF32LE, 4
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		return EncodingUTF16BE, 2
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		return EncodingUTF16LE, 2
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		return EncodingUTF8, 3
+	}
+	if len(data) < 4 {
+		return EncodingUTF8, 0
+	}
+	switch {
+	case data[0] == 0 && data[1] == 0 && data[2] == 0:
+		return EncodingUTF32BE, 0
+	case data[0] == 0 && data[2] == 0:
+		return EncodingUTF16BE, 0
+	case data[1] == 0 && data[2] == 0 && data[3] == 0:
+		return EncodingUTF32LE, 0
+	case data[1] == 0 && data[3] == 0:
+		return EncodingUTF16LE, 0
+	}
+	return EncodingUTF8, 0
+}
+
+// Transcode converts a JSON text in the given encoding to UTF-8, dropping a
+// byte order mark. Malformed code units are an error that reports their byte
+// offset in data.
+func Transcode(data []byte, enc Encoding) ([]byte, error) {
+	bom := 0
+	if enc == EncodingAuto {
+		enc, bom = DetectEncoding(data)
+	} else if detected, n := DetectEncoding(data); detected == enc {
+		bom = n
+	}
+
+	switch enc {
+	case EncodingUTF8:
+		if !utf8.Valid(data[bom:]) {
+			for i := bom; i < len(data); {
+				r, size := utf8.DecodeRune(data[i:])
+				if r == utf8.RuneError && size == 1 {
+					return nil, fmt.Errorf("[%d] Invalid UTF-8 byte 0x%02X.", i, data[i])
+				}
+				i += size
+			}
+		}
+		return data[bom:], nil
+	case EncodingUTF16LE, EncodingUTF16BE:
+		var order binary.ByteOrder = binary.LittleEndian
+		if enc == EncodingUTF16BE {
+			order = binary.BigEndian
+		}
+		if (len(data)-bom)%2 != 0 {
+			return nil, fmt.Errorf("[%d] Truncated UTF-16 code unit.", len(data)-1)
+		}
+		out := make([]byte, 0, len(data)-bom)
+		for i := bom; i < len(data); i += 2 {
+			r := rune(order.Uint16(data[i:]))
+			if utf16.IsSurrogate(r) {
+				if r >= 0xDC00 || i+4 > len(data) {
+					return nil, fmt.Errorf("[%d] Unpaired UTF-16 surrogate 0x%04X.", i, r)
+				}
+				r = utf16.DecodeRune(r, rune(order.Uint16(data[i+2:])))
+				if r == utf8.RuneError {
+					return nil, fmt.Errorf("[%d] Unpaired UTF-16 surrogate 0x%04X.", i, order.Uint16(data[i:]))
+				}
+				i += 2
+			}
+			out = utf8.AppendRune(out, r)
+		}
+		return out, nil
+	case EncodingUTF32LE, EncodingUTF32BE:
+		var order binary.ByteOrder = binary.LittleEndian
+		if enc == EncodingUTF32BE {
+			order = binary.BigEndian
+		}
+		if (len(data)-bom)%4 != 0 {
+			return nil, fmt.Errorf("[%d] Truncated UTF-32 code unit.", len(data)-(len(data)-bom)%4)
+		}
+		out := make([]byte, 0, (len(data)-bom)/2)
+		for i := bom; i < len(data); i += 4 {
+			c := order.Uint32(data[i:])
+			if c > utf8.MaxRune || utf16.IsSurrogate(rune(c)) {
+				return nil, fmt.Errorf("[%d] Invalid UTF-32 code point 0x%X.", i, c)
+			}
+			out = utf8.AppendRune(out, rune(c))
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("Could not transcode from unknown encoding %d!", int(enc))
+}
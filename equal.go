@@ -0,0 +1,222 @@
+package jog
+
+import (
+	"encoding/binary"
+	"hash"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/anantn/jog/internal/number"
+)
+
+// Equal reports whether two values hold the same JSON data, whatever backend
+// parsed them. Object member order is ignored and numbers are compared as
+// the getters read them: integers that fit in an int64 or a uint64 exactly,
+// and other numbers as float64s. So 1, 1.0 and 1e0 are equal, and so are
+// 0.1 and 0.10000000000000001.
+func Equal(a Value, b Value) bool {
+	t := a.Type()
+	if t != b.Type() {
+		return false
+	}
+	switch t {
+	case TypeNull:
+		return true
+	case TypeBool:
+		x, _ := a.GetBool()
+		y, _ := b.GetBool()
+		return x == y
+	case TypeString:
+		x, _ := a.GetString()
+		y, _ := b.GetString()
+		return x == y
+	case TypeNumber:
+		c, ok := compareNumbers(a, b)
+		return ok && c == 0
+	case TypeArray:
+		x, _ := a.GetArray()
+		y, _ := b.GetArray()
+		if len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !Equal(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case TypeObject:
+		x, _ := a.GetObject()
+		y, _ := b.GetObject()
+		if len(x) != len(y) {
+			return false
+		}
+		for k, xv := range x {
+			yv, ok := y[k]
+			if !ok || !Equal(xv, yv) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// Compare returns -1, 0 or +1 as a sorts before, equal to or after b. The
+// order is total and consistent with Equal:
+//
+//   - Values of different types sort null < false < true < numbers <
+//     strings < arrays < objects.
+//   - Numbers sort by value, read as for Equal.
+//   - Strings sort by Unicode code point.
+//   - Arrays sort element by element, a prefix sorts first.
+//   - Objects sort as their members listed by ascending key: key by key,
+//     then value by value, an object whose members are a prefix sorts first.
+func Compare(a Value, b Value) int {
+	ra, rb := rank(a), rank(b)
+	if ra != rb {
+		return sign(ra - rb)
+	}
+	switch a.Type() {
+	case TypeString:
+		x, _ := a.GetString()
+		y, _ := b.GetString()
+		return strings.Compare(x, y)
+	case TypeNumber:
+		c, _ := compareNumbers(a, b)
+		return c
+	case TypeArray:
+		x, _ := a.GetArray()
+		y, _ := b.GetArray()
+		for i := 0; i < len(x) && i < len(y); i++ {
+			if c := Compare(x[i], y[i]); c != 0 {
+				return c
+			}
+		}
+		return sign(len(x) - len(y))
+	case TypeObject:
+		x, _ := a.GetObject()
+		y, _ := b.GetObject()
+		xk, yk := sortedKeys(x), sortedKeys(y)
+		for i := 0; i < len(xk) && i < len(yk); i++ {
+			if c := strings.Compare(xk[i], yk[i]); c != 0 {
+				return c
+			}
+			if c := Compare(x[xk[i]], y[yk[i]]); c != 0 {
+				return c
+			}
+		}
+		return sign(len(xk) - len(yk))
+	}
+	return 0
+}
+
+// Hash returns a 64-bit hash of a value, consistent with Equal: equal
+// values hash the same on every backend. It is not a cryptographic hash.
+func Hash(v Value) uint64 {
+	h := fnv.New64a()
+	hashValue(h, v)
+	return h.Sum64()
+}
+
+// Private functions.
+
+func rank(v Value) int {
+	switch v.Type() {
+	case TypeNull:
+		return 0
+	case TypeBool:
+		if b, _ := v.GetBool(); b {
+			return 2
+		}
+		return 1
+	case TypeNumber:
+		return 3
+	case TypeString:
+		return 4
+	case TypeArray:
+		return 5
+	case TypeObject:
+		return 6
+	}
+	return 7
+}
+
+// Compare two numbers as the getters read them, or report false if either
+// is not a number.
+func compareNumbers(a Value, b Value) (int, bool) {
+	x, errX := getNumber(a)
+	y, errY := getNumber(b)
+	if errX != nil || errY != nil {
+		return 0, false
+	}
+	return number.Compare(x, y), true
+}
+
+func sign(i int) int {
+	switch {
+	case i < 0:
+		return -1
+	case i > 0:
+		return 1
+	}
+	return 0
+}
+
+func sortedKeys(m map[string]Value) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Every value is written with a type tag and strings with their length, so
+// distinct values cannot produce the same byte stream.
+func hashValue(h hash.Hash64, v Value) {
+	var buf [8]byte
+	writeString := func(s string) {
+		binary.LittleEndian.PutUint64(buf[:], uint64(len(s)))
+		h.Write(buf[:])
+		h.Write([]byte(s))
+	}
+	h.Write([]byte{byte(rank(v))})
+	switch v.Type() {
+	case TypeString:
+		s, _ := v.GetString()
+		writeString(s)
+	case TypeNumber:
+		// Equal numbers have the same normal form.
+		if n, err := getNumber(v); err == nil {
+			n = n.Normal()
+			h.Write([]byte{byte(n.Kind)})
+			switch n.Kind {
+			case number.Int:
+				binary.LittleEndian.PutUint64(buf[:], uint64(n.I))
+			case number.Uint:
+				binary.LittleEndian.PutUint64(buf[:], n.U)
+			default:
+				binary.LittleEndian.PutUint64(buf[:], math.Float64bits(n.F))
+			}
+			h.Write(buf[:])
+		}
+	case TypeArray:
+		elems, _ := v.GetArray()
+		binary.LittleEndian.PutUint64(buf[:], uint64(len(elems)))
+		h.Write(buf[:])
+		for _, elem := range elems {
+			hashValue(h, elem)
+		}
+	case TypeObject:
+		members, _ := v.GetObject()
+		binary.LittleEndian.PutUint64(buf[:], uint64(len(members)))
+		h.Write(buf[:])
+		for _, k := range sortedKeys(members) {
+			writeString(k)
+			hashValue(h, members[k])
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package jog
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/anantn/jog/internal/number"
+)
+
+// The getters of every backend fail with a *PathError wrapping one of these,
+// so callers can tell the failures apart with errors.Is.
+var (
+	// The path leads nowhere: a key is missing, or a value on the way is
+	// not an object.
+	ErrNotFound = errors.New("Value not found")
+	// The value is not of the type asked for, or is a number that is not an
+	// integer where one was asked for.
+	ErrTypeMismatch = errors.New("Type mismatch")
+	// The number doesn't fit in the Go type asked for without losing
+	// precision.
+	ErrOverflow = errors.New("Number out of range")
+)
+
+// PathError describes a failed lookup.
+type PathError struct {
+	Path []string
+	// The index in Path of the key or array index that could not be followed
+	// for ErrNotFound, and len(Path) otherwise.
+	Segment int
+	// What the getter asked for: "value", "int", "uint", "float", "number",
+	// "bool", "string", "array", "object" or "array or object".
+	Expected string
+	// The type of the value found at Path, or for ErrNotFound the type of the
+	// value that Path[Segment] was looked up in.
+	Actual Type
+	// ErrNotFound, ErrTypeMismatch or ErrOverflow.
+	Err error
+}
+
+func (e *PathError) Error() string {
+	switch e.Err {
+	case ErrNotFound:
+		at := strings.Join(e.Path[:e.Segment+1], "/")
+		if e.Actual == TypeObject || e.Actual == TypeArray {
+			return fmt.Sprintf("Could not find a child at %s", at)
+		}
+		parent := strings.Join(e.Path[:e.Segment], "/")
+		if parent == "" {
+			parent = "the value"
+		}
+		return fmt.Sprintf("Could not find a child at %s, %s is not an object", at, parent)
+	case ErrTypeMismatch:
+		if e.Actual == TypeNumber && (e.Expected == "int" || e.Expected == "uint") {
+			return fmt.Sprintf("The number%s is not an integer", e.at())
+		}
+		return fmt.Sprintf("Could not find %s value%s, found %s", e.Expected, e.at(), e.Actual)
+	case ErrOverflow:
+		return fmt.Sprintf("Converting the number%s to %s would overflow or lose precision", e.at(), e.Expected)
+	}
+	return fmt.Sprintf("%v%s", e.Err, e.at())
+}
+
+func (e *PathError) Unwrap() error {
+	return e.Err
+}
+
+// Constructors of the errors. Backends build the errors of their getters
+// with these, so every implementation of Value reports failures alike.
+
+// NotFoundError is the error for a path whose key at segment could not be
+// followed from a value of type parent, by a getter asking for expected.
+func NotFoundError(path []string, segment int, expected string, parent Type) error {
+	return &PathError{Path: slices.Clone(path), Segment: segment, Expected: expected, Actual: parent, Err: ErrNotFound}
+}
+
+// MismatchError is the error for a value of type actual at path where
+// expected was asked for.
+func MismatchError(path []string, expected string, actual Type) error {
+	return &PathError{Path: slices.Clone(path), Segment: len(path), Expected: expected, Actual: actual, Err: ErrTypeMismatch}
+}
+
+// NumberError is the error for a number at path that could not convert to
+// expected, given the error of the conversion.
+func NumberError(err error, expected string, path []string) error {
+	if err == number.ErrMismatch {
+		return MismatchError(path, expected, TypeNumber)
+	}
+	return &PathError{Path: slices.Clone(path), Segment: len(path), Expected: expected, Actual: TypeNumber, Err: ErrOverflow}
+}
+
+// OutOfRangeError is the error for an array at path without an element i,
+// by a getter asking for expected.
+func OutOfRangeError(path []string, i int, expected string) error {
+	return NotFoundError(append(slices.Clone(path), strconv.Itoa(i)), len(path), expected, TypeArray)
+}
+
+// ElementError turns an error from element i of the array at path into one
+// about the path to it.
+func ElementError(err error, path []string, i int) error {
+	if err == nil {
+		return nil
+	}
+	return PrefixError(err, append(slices.Clone(path), strconv.Itoa(i)))
+}
+
+// PrefixError turns an error from a value found at prefix into one about
+// the path through it.
+func PrefixError(err error, prefix []string) error {
+	var pe *PathError
+	if len(prefix) == 0 || !errors.As(err, &pe) {
+		return err
+	}
+	prefixed := *pe
+	prefixed.Path = append(slices.Clone(prefix), pe.Path...)
+	prefixed.Segment += len(prefix)
+	return &prefixed
+}
+
+// Private methods.
+
+func (e *PathError) at() string {
+	if len(e.Path) == 0 {
+		return ""
+	}
+	return " at " + strings.Join(e.Path, "/")
+}
+
+// A lookup error from Get, reported for a getter asking for expected.
+func expectError(err error, expected string) error {
+	var pe *PathError
+	if !errors.As(err, &pe) {
+		return err
+	}
+	retargeted := *pe
+	retargeted.Expected = expected
+	return &retargeted
+}
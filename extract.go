@@ -0,0 +1,108 @@
+package jog
+
+import (
+	"strconv"
+
+	"github.com/anantn/jog/internal/number"
+)
+
+// Field is a value for Extract to read: a path and the type expected there.
+// TypeUnknown accepts any type.
+type Field struct {
+	Path *Path
+	Type Type
+}
+
+type FieldStatus int
+
+const (
+	FieldFound FieldStatus = iota
+	FieldMissing
+	FieldMismatch
+)
+
+func (s FieldStatus) String() string {
+	switch s {
+	case FieldFound:
+		return "found"
+	case FieldMissing:
+		return "missing"
+	case FieldMismatch:
+		return "mismatch"
+	}
+	return "unknown"
+}
+
+// Result is what Extract found for a Field. Only the contents of the type
+// found are set. Type is also set on a mismatch.
+type Result struct {
+	Status FieldStatus
+	Type   Type
+
+	Bool bool
+	// Numbers set Float, and Int along with Integer if they are integers
+	// that fit in an int64.
+	Int     int64
+	Float   float64
+	Integer bool
+	String  string
+	// Set for arrays and objects, and for fields of TypeUnknown.
+	Value Value
+}
+
+// Extractor is implemented by values that can resolve many fields at once,
+// such as the backends, which do it in a single native call. Extract sets
+// results[i] to FieldMissing or to the type and contents found at
+// fields[i].Path; type mismatches are left to the caller.
+type Extractor interface {
+	Extract(fields []Field, results []Result)
+}
+
+// Extract reads fields from v, returning a result for each. Values that are
+// not Extractors are read field by field.
+func Extract(v Value, fields []Field) []Result {
+	results := make([]Result, len(fields))
+	if e, ok := v.(Extractor); ok {
+		e.Extract(fields, results)
+	} else {
+		for i, field := range fields {
+			results[i] = extract(v, field)
+		}
+	}
+	for i, field := range fields {
+		r := &results[i]
+		if r.Status == FieldFound && field.Type != TypeUnknown && r.Type != field.Type {
+			*r = Result{Status: FieldMismatch, Type: r.Type}
+		}
+	}
+	return results
+}
+
+// Private methods.
+
+func extract(v Value, field Field) Result {
+	n, err := v.At(field.Path)
+	if err != nil {
+		return Result{Status: FieldMissing}
+	}
+	r := Result{Type: n.Type()}
+	switch r.Type {
+	case TypeBool:
+		r.Bool, _ = n.GetBool()
+	case TypeNumber:
+		// The text of the number converts the same for every backend.
+		text, _ := n.Stringify()
+		r.Float, _ = strconv.ParseFloat(text, 64)
+		if num := number.Parse(text); num.Kind == number.Int {
+			r.Int, r.Integer = num.I, true
+		}
+	case TypeString:
+		r.String, _ = n.GetString()
+	case TypeArray, TypeObject:
+		r.Value = n
+	}
+	if field.Type == TypeUnknown {
+		r.Value = n
+	}
+	return r
+}
@@ -0,0 +1,633 @@
+// Package lazy implements jog.Value over the text of a document that a
+// backend has already validated. Paths are found by skipping over the text,
+// and a subtree is only parsed by the backend once a getter needs its
+// contents, so reading a few fields of a large document stays cheap.
+package lazy
+
+import (
+	"bytes"
+	"iter"
+	"sync"
+
+	"github.com/anantn/jog"
+)
+
+// A document is shared by all of its values. Parsed subtrees and the members
+// of objects are cached by their offset, so each is parsed or scanned at most
+// once per document.
+type document struct {
+	data  []byte
+	parse func([]byte) (jog.Value, error)
+
+	mu      sync.Mutex
+	parsed  map[int]jog.Value
+	objects map[int][]member
+}
+
+// The spans of the key and the value of an object member.
+type member struct {
+	keyStart, keyEnd int
+	start, end       int
+}
+
+// A value is the span of its text in the document.
+type value struct {
+	doc        *document
+	start, end int
+}
+
+// Wrap data, which must be a single valid JSON value, and parse subtrees of
+// it with parse when needed. data is kept, so the caller must not modify it.
+func New(data []byte, parse func([]byte) (jog.Value, error)) jog.Value {
+	doc := &document{data: data, parse: parse, parsed: map[int]jog.Value{}, objects: map[int][]member{}}
+	// The root spans the rest of the text, which saves skipping over it.
+	return &value{doc, doc.skipSpace(0), len(data)}
+}
+
+// Data Getters.
+func (v *value) Get(path ...string) (jog.Value, error) {
+	if len(path) == 0 {
+		// A copy, in case v is reused by an iterator.
+		return &value{v.doc, v.start, v.end}, nil
+	}
+	n, err := v.find("value", path)
+	if err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+func (v *value) At(path *jog.Path) (jog.Value, error) {
+	return v.Get(path.Segments()...)
+}
+
+func (v *value) GetInt(path ...string) (int, error) {
+	n, err := v.scalar(path, jog.TypeNumber, "int")
+	if err != nil {
+		return 0, err
+	}
+	i, err := n.GetInt()
+	return i, jog.PrefixError(err, path)
+}
+
+func (v *value) GetUInt(path ...string) (uint, error) {
+	n, err := v.scalar(path, jog.TypeNumber, "uint")
+	if err != nil {
+		return 0, err
+	}
+	u, err := n.GetUInt()
+	return u, jog.PrefixError(err, path)
+}
+
+func (v *value) GetFloat(path ...string) (float64, error) {
+	n, err := v.scalar(path, jog.TypeNumber, "float")
+	if err != nil {
+		return 0, err
+	}
+	f, err := n.GetFloat()
+	return f, jog.PrefixError(err, path)
+}
+
+func (v *value) NumberKind(path ...string) (jog.NumberKind, error) {
+	n, err := v.scalar(path, jog.TypeNumber, "number")
+	if err != nil {
+		return 0, err
+	}
+	k, err := n.NumberKind()
+	return k, jog.PrefixError(err, path)
+}
+
+func (v *value) GetBool(path ...string) (bool, error) {
+	n, err := v.find("bool", path)
+	if err != nil {
+		return false, err
+	}
+	if n.kind() != jog.TypeBool {
+		return false, jog.MismatchError(path, "bool", n.kind())
+	}
+	return n.doc.data[n.start] == 't', nil
+}
+
+func (v *value) GetString(path ...string) (string, error) {
+	n, err := v.find("string", path)
+	if err != nil {
+		return "", err
+	}
+	if n.kind() != jog.TypeString {
+		return "", jog.MismatchError(path, "string", n.kind())
+	}
+	return n.doc.decodeString(n.start, n.end)
+}
+
+func (v *value) GetArray(path ...string) ([]jog.Value, error) {
+	n, err := v.find("array", path)
+	if err != nil {
+		return nil, err
+	}
+	if n.kind() != jog.TypeArray {
+		return nil, jog.MismatchError(path, "array", n.kind())
+	}
+	array := []jog.Value{}
+	n.doc.elements(n.start, func(start, end int) bool {
+		array = append(array, &value{n.doc, start, end})
+		return true
+	})
+	return array, nil
+}
+
+func (v *value) GetObject(path ...string) (map[string]jog.Value, error) {
+	n, err := v.find("object", path)
+	if err != nil {
+		return nil, err
+	}
+	if n.kind() != jog.TypeObject {
+		return nil, jog.MismatchError(path, "object", n.kind())
+	}
+	members := map[string]jog.Value{}
+	for _, m := range n.doc.members(n.start) {
+		key, err := n.doc.decodeString(m.keyStart, m.keyEnd)
+		if err != nil {
+			return nil, err
+		}
+		members[key] = &value{n.doc, m.start, m.end}
+	}
+	return members, nil
+}
+
+func (v *value) Len(path ...string) (int, error) {
+	n, err := v.find("array or object", path)
+	if err != nil {
+		return 0, err
+	}
+	switch n.kind() {
+	case jog.TypeArray:
+		length := 0
+		n.doc.elements(n.start, func(start, end int) bool {
+			length++
+			return true
+		})
+		return length, nil
+	case jog.TypeObject:
+		return len(n.doc.members(n.start)), nil
+	}
+	return 0, jog.MismatchError(path, "array or object", n.kind())
+}
+
+func (v *value) Index(i int, path ...string) (jog.Value, error) {
+	e, err := v.element("value", i, path)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (v *value) IndexInt(i int, path ...string) (int, error) {
+	e, err := v.element("int", i, path)
+	if err != nil {
+		return 0, err
+	}
+	r, err := e.GetInt()
+	return r, jog.ElementError(err, path, i)
+}
+
+func (v *value) IndexUInt(i int, path ...string) (uint, error) {
+	e, err := v.element("uint", i, path)
+	if err != nil {
+		return 0, err
+	}
+	r, err := e.GetUInt()
+	return r, jog.ElementError(err, path, i)
+}
+
+func (v *value) IndexFloat(i int, path ...string) (float64, error) {
+	e, err := v.element("float", i, path)
+	if err != nil {
+		return 0, err
+	}
+	r, err := e.GetFloat()
+	return r, jog.ElementError(err, path, i)
+}
+
+func (v *value) IndexBool(i int, path ...string) (bool, error) {
+	e, err := v.element("bool", i, path)
+	if err != nil {
+		return false, err
+	}
+	r, err := e.GetBool()
+	return r, jog.ElementError(err, path, i)
+}
+
+func (v *value) IndexString(i int, path ...string) (string, error) {
+	e, err := v.element("string", i, path)
+	if err != nil {
+		return "", err
+	}
+	r, err := e.GetString()
+	return r, jog.ElementError(err, path, i)
+}
+
+func (v *value) Elements(path ...string) iter.Seq2[int, jog.Value] {
+	return jog.Elements(v, path...)
+}
+
+func (v *value) ArrayIterator(path ...string) (jog.ArrayIterator, error) {
+	n, err := v.array(path)
+	if err != nil {
+		return nil, err
+	}
+	return &arrayIterator{next: n.doc.skipSpace(n.start + 1), index: -1, elem: value{doc: n.doc}}, nil
+}
+
+func (v *value) ObjectIterator(path ...string) (jog.ObjectIterator, error) {
+	n, err := v.find("object", path)
+	if err != nil {
+		return nil, err
+	}
+	if n.kind() != jog.TypeObject {
+		return nil, jog.MismatchError(path, "object", n.kind())
+	}
+	return &objectIterator{members: n.doc.members(n.start), index: -1, elem: value{doc: n.doc}}, nil
+}
+
+func (v *value) Type(path ...string) jog.Type {
+	n, err := v.find("value", path)
+	if err != nil {
+		return jog.TypeMissing
+	}
+	return n.kind()
+}
+
+func (v *value) Exists(path ...string) bool {
+	return v.Type(path...) != jog.TypeMissing
+}
+
+func (v *value) IsNull(path ...string) bool {
+	return v.Type(path...) == jog.TypeNull
+}
+
+func (v *value) Stringify(path ...string) (string, error) {
+	n, err := v.find("value", path)
+	if err != nil {
+		return "", err
+	}
+	parsed, err := n.parsed()
+	if err != nil {
+		return "", err
+	}
+	return parsed.Stringify()
+}
+
+// The native memory of the subtrees parsed so far.
+func (v *value) MemoryUsage() int {
+	v.doc.mu.Lock()
+	defer v.doc.mu.Unlock()
+	usage := 0
+	for _, parsed := range v.doc.parsed {
+		usage += parsed.MemoryUsage()
+	}
+	return usage
+}
+
+// Private methods.
+
+func (v *value) kind() jog.Type {
+	switch v.doc.data[v.start] {
+	case '{':
+		return jog.TypeObject
+	case '[':
+		return jog.TypeArray
+	case '"':
+		return jog.TypeString
+	case 't', 'f':
+		return jog.TypeBool
+	case 'n':
+		return jog.TypeNull
+	}
+	return jog.TypeNumber
+}
+
+// Follow path through objects, taking the first member with each key.
+func (v *value) find(expected string, path []string) (*value, error) {
+	n := v
+	for segment, part := range path {
+		if n.kind() != jog.TypeObject {
+			return nil, jog.NotFoundError(path, segment, expected, n.kind())
+		}
+		var child *value
+		for _, m := range n.doc.members(n.start) {
+			if n.doc.keyEquals(m.keyStart, m.keyEnd, part) {
+				child = &value{n.doc, m.start, m.end}
+				break
+			}
+		}
+		if child == nil {
+			return nil, jog.NotFoundError(path, segment, expected, jog.TypeObject)
+		}
+		n = child
+	}
+	return n, nil
+}
+
+// The array at path.
+func (v *value) array(path []string) (*value, error) {
+	n, err := v.find("array", path)
+	if err != nil {
+		return nil, err
+	}
+	if n.kind() != jog.TypeArray {
+		return nil, jog.MismatchError(path, "array", n.kind())
+	}
+	return n, nil
+}
+
+// Skip to element i of the array at path.
+func (v *value) element(expected string, i int, path []string) (*value, error) {
+	n, err := v.array(path)
+	if err != nil {
+		return nil, err
+	}
+	var elem *value
+	index := 0
+	n.doc.elements(n.start, func(start, end int) bool {
+		if index == i {
+			elem = &value{n.doc, start, end}
+			return false
+		}
+		index++
+		return true
+	})
+	if elem == nil {
+		return nil, jog.OutOfRangeError(path, i, expected)
+	}
+	return elem, nil
+}
+
+// Find a scalar of the given type and have the backend parse it, so that
+// number conversions behave exactly like an eagerly parsed document.
+func (v *value) scalar(path []string, kind jog.Type, name string) (jog.Value, error) {
+	n, err := v.find(name, path)
+	if err != nil {
+		return nil, err
+	}
+	if n.kind() != kind {
+		return nil, jog.MismatchError(path, name, n.kind())
+	}
+	return n.parsed()
+}
+
+func (v *value) parsed() (jog.Value, error) {
+	return v.doc.parseSpan(v.start, v.end)
+}
+
+func (d *document) parseSpan(start, end int) (jog.Value, error) {
+	d.mu.Lock()
+	parsed, ok := d.parsed[start]
+	d.mu.Unlock()
+	if ok {
+		return parsed, nil
+	}
+
+	parsed, err := d.parse(d.data[start:end])
+	if err != nil {
+		return nil, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if cached, ok := d.parsed[start]; ok {
+		return cached, nil
+	}
+	d.parsed[start] = parsed
+	return parsed, nil
+}
+
+// A string without escapes is its own text; others are decoded by the
+// backend.
+func (d *document) decodeString(start, end int) (string, error) {
+	text := d.data[start+1 : end-1]
+	if bytes.IndexByte(text, '\\') < 0 {
+		return string(text), nil
+	}
+	parsed, err := d.parseSpan(start, end)
+	if err != nil {
+		return "", err
+	}
+	return parsed.GetString()
+}
+
+func (d *document) keyEquals(start, end int, key string) bool {
+	text := d.data[start+1 : end-1]
+	if bytes.IndexByte(text, '\\') < 0 {
+		return string(text) == key
+	}
+	decoded, err := d.decodeString(start, end)
+	return err == nil && decoded == key
+}
+
+// Call fn with the span of every element of the array at start until it
+// returns false.
+func (d *document) elements(start int, fn func(start, end int) bool) {
+	i := d.skipSpace(start + 1)
+	for {
+		end, next, ok := d.nextElement(i)
+		if !ok || !fn(i, end) {
+			return
+		}
+		i = next
+	}
+}
+
+// The end of the array element at i and the offset of the one after it, or
+// false if i is the end of the array.
+func (d *document) nextElement(i int) (end, next int, ok bool) {
+	if d.data[i] == ']' {
+		return 0, i, false
+	}
+	end = d.skipValue(i)
+	next = d.skipSpace(end)
+	if d.data[next] == ',' {
+		next = d.skipSpace(next + 1)
+	}
+	return end, next, true
+}
+
+// The iterators move elem over the spans of the elements or members.
+type arrayIterator struct {
+	next  int
+	index int
+	done  bool
+	elem  value
+}
+
+func (it *arrayIterator) Next() bool {
+	if it.done {
+		return false
+	}
+	end, next, ok := it.elem.doc.nextElement(it.next)
+	if !ok {
+		it.done = true
+		return false
+	}
+	it.index++
+	it.elem.start, it.elem.end = it.next, end
+	it.next = next
+	return true
+}
+
+func (it *arrayIterator) Index() int {
+	return it.index
+}
+
+func (it *arrayIterator) Value() jog.Value {
+	if it.index < 0 || it.done {
+		return nil
+	}
+	return &it.elem
+}
+
+type objectIterator struct {
+	members []member
+	index   int
+	elem    value
+}
+
+func (it *objectIterator) Next() bool {
+	if it.index+1 >= len(it.members) {
+		it.index = len(it.members)
+		return false
+	}
+	it.index++
+	m := it.members[it.index]
+	it.elem.start, it.elem.end = m.start, m.end
+	return true
+}
+
+// Key returns "" if the backend fails to decode an escaped key.
+func (it *objectIterator) Key() string {
+	if it.index < 0 || it.index >= len(it.members) {
+		return ""
+	}
+	m := it.members[it.index]
+	key, _ := it.elem.doc.decodeString(m.keyStart, m.keyEnd)
+	return key
+}
+
+func (it *objectIterator) Value() jog.Value {
+	if it.index < 0 || it.index >= len(it.members) {
+		return nil
+	}
+	return &it.elem
+}
+
+// The members of the object at start, scanned on first use.
+func (d *document) members(start int) []member {
+	d.mu.Lock()
+	members, ok := d.objects[start]
+	d.mu.Unlock()
+	if ok {
+		return members
+	}
+
+	members = []member{}
+	i := d.skipSpace(start + 1)
+	for d.data[i] != '}' {
+		keyEnd := d.skipString(i)
+		valueStart := d.skipSpace(d.skipSpace(keyEnd) + 1)
+		end := d.skipValue(valueStart)
+		members = append(members, member{i, keyEnd, valueStart, end})
+		i = d.skipSpace(end)
+		if d.data[i] == ',' {
+			i = d.skipSpace(i + 1)
+		}
+	}
+	d.mu.Lock()
+	d.objects[start] = members
+	d.mu.Unlock()
+	return members
+}
+
+// Utility functions. They rely on the document being valid, and return the
+// offset just past what they skipped.
+
+// The bytes that matter when skipping over an object or array.
+var structural = [256]bool{'"': true, '/': true, '{': true, '}': true, '[': true, ']': true}
+
+func (d *document) skipSpace(i int) int {
+	for i < len(d.data) {
+		switch d.data[i] {
+		case ' ', '\t', '\n', '\r':
+			i++
+		case '/':
+			i = d.skipComment(i)
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// yajl accepts C and C++ style comments.
+func (d *document) skipComment(i int) int {
+	if d.data[i+1] == '/' {
+		end := bytes.IndexByte(d.data[i:], '\n')
+		if end < 0 {
+			return len(d.data)
+		}
+		return i + end + 1
+	}
+	return i + 2 + bytes.Index(d.data[i+2:], []byte("*/")) + 2
+}
+
+// A quote ends the string unless an odd number of backslashes escapes it.
+func (d *document) skipString(i int) int {
+	for i++; ; {
+		end := i + bytes.IndexByte(d.data[i:], '"')
+		escapes := 0
+		for end-escapes > i && d.data[end-escapes-1] == '\\' {
+			escapes++
+		}
+		if escapes%2 == 0 {
+			return end + 1
+		}
+		i = end + 1
+	}
+}
+
+func (d *document) skipValue(i int) int {
+	switch d.data[i] {
+	case '"':
+		return d.skipString(i)
+	case '{', '[':
+		depth := 0
+		for i < len(d.data) {
+			if !structural[d.data[i]] {
+				i++
+				continue
+			}
+			switch d.data[i] {
+			case '"':
+				i = d.skipString(i)
+				continue
+			case '/':
+				i = d.skipComment(i)
+				continue
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+				if depth == 0 {
+					return i + 1
+				}
+			}
+			i++
+		}
+		return i
+	}
+	for i < len(d.data) {
+		switch d.data[i] {
+		case ',', ']', '}', ' ', '\t', '\n', '\r', '/':
+			return i
+		}
+		i++
+	}
+	return i
+}
@@ -0,0 +1,268 @@
+// Package number defines how the getters of every backend convert JSON
+// numbers, so that they agree whatever form a backend keeps numbers in.
+//
+// A number written without a fraction or exponent is an integer if it fits
+// in an int64 or a uint64, like rapidjson classifies them; any other number
+// is a float. GetInt and GetUInt only accept integers in their range, and
+// GetFloat accepts any number that a float64 holds without rounding an
+// integer.
+package number
+
+import (
+	"cmp"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+type Kind int
+
+const (
+	Int Kind = iota
+	Uint
+	Float
+)
+
+// A Number is an integer in I or U, or a float in F, according to Kind.
+// Uint is only used for integers above the int64 range.
+type Number struct {
+	Kind Kind
+	I    int64
+	U    uint64
+	F    float64
+}
+
+// Flags of the Go types that hold a number exactly, as jog.NumberKind.
+const (
+	FitsInt32 = 1 << iota
+	FitsUint32
+	FitsInt64
+	FitsUint64
+	IsFloat
+)
+
+var (
+	// ErrMismatch is returned for a float where an integer was asked for.
+	ErrMismatch = errors.New("not an integer")
+	// ErrRange is returned for an integer outside of the range asked for.
+	ErrRange = errors.New("out of range")
+	// ErrPrecision is returned for an integer that a float64 would round,
+	// or a fraction asked for as an integer.
+	ErrPrecision = errors.New("loses precision")
+)
+
+// Parse classifies the text of a valid JSON number.
+func Parse(text string) Number {
+	if !strings.ContainsAny(text, ".eE") {
+		if i, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return Number{Kind: Int, I: i}
+		}
+		if u, err := strconv.ParseUint(text, 10, 64); err == nil {
+			return Number{Kind: Uint, U: u}
+		}
+	}
+	f, _ := strconv.ParseFloat(text, 64)
+	return Number{Kind: Float, F: f}
+}
+
+// Valid reports whether text is a JSON number.
+func Valid(text string) bool {
+	i := 0
+	if i < len(text) && text[i] == '-' {
+		i++
+	}
+	switch {
+	case i < len(text) && text[i] == '0':
+		i++
+	case i < len(text) && text[i] >= '1' && text[i] <= '9':
+		i = digits(text, i)
+	default:
+		return false
+	}
+	if i < len(text) && text[i] == '.' {
+		if j := digits(text, i+1); j > i+1 {
+			i = j
+		} else {
+			return false
+		}
+	}
+	if i < len(text) && (text[i] == 'e' || text[i] == 'E') {
+		i++
+		if i < len(text) && (text[i] == '+' || text[i] == '-') {
+			i++
+		}
+		if j := digits(text, i); j > i {
+			i = j
+		} else {
+			return false
+		}
+	}
+	return i == len(text)
+}
+
+func (n Number) Int() (int, error) {
+	switch n.Kind {
+	case Int:
+		if n.I < math.MinInt || n.I > math.MaxInt {
+			return 0, ErrRange
+		}
+		return int(n.I), nil
+	case Uint:
+		return 0, ErrRange
+	}
+	return 0, ErrMismatch
+}
+
+func (n Number) Uint() (uint, error) {
+	switch n.Kind {
+	case Int:
+		if n.I < 0 || uint64(n.I) > math.MaxUint {
+			return 0, ErrRange
+		}
+		return uint(n.I), nil
+	case Uint:
+		if n.U > math.MaxUint {
+			return 0, ErrRange
+		}
+		return uint(n.U), nil
+	}
+	return 0, ErrMismatch
+}
+
+// Float converts n to a float64, failing for an integer that a float64
+// would round, for the coercing getters.
+func (n Number) Float() (float64, error) {
+	switch n.Kind {
+	case Int:
+		// 2^63 and beyond don't convert back to an int64.
+		f := float64(n.I)
+		if f >= math.MaxInt64 || int64(f) != n.I {
+			return 0, ErrPrecision
+		}
+		return f, nil
+	case Uint:
+		f := float64(n.U)
+		if f >= math.MaxUint64 || uint64(f) != n.U {
+			return 0, ErrPrecision
+		}
+		return f, nil
+	}
+	return n.F, nil
+}
+
+// Flags returns the types that hold n, or IsFloat if n is not an integer.
+func (n Number) Flags() int {
+	switch n.Kind {
+	case Int:
+		flags := FitsInt64
+		if n.I >= math.MinInt32 && n.I <= math.MaxInt32 {
+			flags |= FitsInt32
+		}
+		if n.I >= 0 {
+			flags |= FitsUint64
+			if n.I <= math.MaxUint32 {
+				flags |= FitsUint32
+			}
+		}
+		return flags
+	case Uint:
+		return FitsUint64
+	}
+	return IsFloat
+}
+
+// Approx returns the float64 nearest to n.
+func (n Number) Approx() float64 {
+	switch n.Kind {
+	case Int:
+		return float64(n.I)
+	case Uint:
+		return float64(n.U)
+	}
+	return n.F
+}
+
+// Integral converts a float without a fraction to an integer, for the
+// coercing getters.
+func (n Number) Integral() (Number, error) {
+	if n.Kind != Float {
+		return n, nil
+	}
+	if n.F != math.Trunc(n.F) || math.IsInf(n.F, 0) {
+		return n, ErrPrecision
+	}
+	if n.F >= -math.MaxInt64 && n.F < math.MaxInt64 {
+		return Number{Kind: Int, I: int64(n.F)}, nil
+	}
+	if n.F > 0 && n.F < math.MaxUint64 {
+		return Number{Kind: Uint, U: uint64(n.F)}, nil
+	}
+	return n, ErrRange
+}
+
+// Compare returns -1, 0 or +1 as a is less than, equal to or greater than
+// b. Integers and floats are compared exactly, so 2^53+1 is greater than the
+// float 2^53.
+func Compare(a, b Number) int {
+	switch {
+	case a.Kind == Float && b.Kind == Float:
+		return cmp.Compare(a.F, b.F)
+	case a.Kind == Float:
+		return -Compare(b, a)
+	case b.Kind == Float:
+		return compareFloat(a, b.F)
+	case a.Kind == Int && b.Kind == Int:
+		return cmp.Compare(a.I, b.I)
+	case a.Kind == Uint && b.Kind == Uint:
+		return cmp.Compare(a.U, b.U)
+	case a.Kind == Uint:
+		// Uints are above the int64 range.
+		return 1
+	}
+	return -1
+}
+
+// Normal returns the form that n shares with every number equal to it: a
+// float without a fraction becomes an integer if it fits in an int64 or a
+// uint64, and -0 becomes 0.
+func (n Number) Normal() Number {
+	if i, err := n.Integral(); err == nil {
+		return i
+	}
+	return n
+}
+
+// Utility functions.
+
+// Compare the integer n with f.
+func compareFloat(n Number, f float64) int {
+	switch {
+	case n.Kind == Int && f < -(1<<63):
+		return 1
+	case n.Kind == Int && f >= 1<<63, n.Kind == Uint && f >= 1<<64:
+		return -1
+	case n.Kind == Uint && f < 1<<63:
+		return 1
+	}
+	// f is within the range of n's type, so its integer part converts
+	// exactly and only the fraction is left to break a tie.
+	whole := math.Trunc(f)
+	var c int
+	if n.Kind == Int {
+		c = cmp.Compare(n.I, int64(whole))
+	} else {
+		c = cmp.Compare(n.U, uint64(whole))
+	}
+	if c == 0 {
+		c = cmp.Compare(0, f-whole)
+	}
+	return c
+}
+
+func digits(text string, i int) int {
+	for i < len(text) && text[i] >= '0' && text[i] <= '9' {
+		i++
+	}
+	return i
+}
@@ -0,0 +1,40 @@
+package jog
+
+import "iter"
+
+// An ArrayIterator steps through the elements of an array where the
+// document stores them. The Value it returns is reused by the next step, so
+// call Get on it for a value to keep.
+type ArrayIterator interface {
+	// Next moves to the next element, returning false after the last one.
+	Next() bool
+	// Index returns the position of the current element.
+	Index() int
+	Value() Value
+}
+
+// An ObjectIterator steps through the members of an object in document
+// order, including members with duplicate keys. Like an ArrayIterator, the
+// Value it returns is reused by the next step.
+type ObjectIterator interface {
+	Next() bool
+	Key() string
+	Value() Value
+}
+
+// Elements ranges over the array at path of v with its ArrayIterator,
+// yielding nothing if there is no array there. Implementations of Value
+// use it for their Elements method.
+func Elements(v Value, path ...string) iter.Seq2[int, Value] {
+	return func(yield func(int, Value) bool) {
+		it, err := v.ArrayIterator(path...)
+		if err != nil {
+			return
+		}
+		for it.Next() {
+			if !yield(it.Index(), it.Value()) {
+				return
+			}
+		}
+	}
+}
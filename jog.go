@@ -1,20 +1,70 @@
 package jog
 
+import (
+	"iter"
+	"strings"
+
+	"github.com/anantn/jog/internal/number"
+)
+
+// Value is a parsed JSON value. Its methods only read the document, so a
+// document and the values obtained from it may be used from many goroutines
+// at once without locking. A child value keeps its whole document alive.
 type Value interface {
+	// Type returns TypeMissing if there is no value at path, as opposed to
+	// TypeNull for a null.
 	Type(path ...string) Type
+	Exists(path ...string) bool
+	IsNull(path ...string) bool
 	Stringify(path ...string) (string, error)
 
 	Get(path ...string) (Value, error)
+	// At is Get with a compiled path. Backends convert the path once, so
+	// repeated lookups don't allocate native memory.
+	At(path *Path) (Value, error)
 
+	// Numbers convert the same way on every backend. GetInt and GetUInt
+	// accept numbers written without a fraction or exponent, within their
+	// range. GetFloat accepts any number and returns the nearest float64.
+	// See Coerce for getters that convert other types.
 	GetInt(path ...string) (int, error)
 	GetUInt(path ...string) (uint, error)
 	GetFloat(path ...string) (float64, error)
+	// NumberKind tells how the number at path is written and which Go types
+	// hold it, so code can choose a type before getting it.
+	NumberKind(path ...string) (NumberKind, error)
 
 	GetBool(path ...string) (bool, error)
 	GetString(path ...string) (string, error)
 
 	GetArray(path ...string) ([]Value, error)
 	GetObject(path ...string) (map[string]Value, error)
+
+	// Len returns the number of elements of the array or members of the
+	// object at path. Index returns element i of the array at path, and the
+	// Index getters convert it like the getters above. None of them build a
+	// slice of the elements. An error finding the array is about an "array",
+	// and a missing element is ErrNotFound at the path followed by i.
+	Len(path ...string) (int, error)
+	Index(i int, path ...string) (Value, error)
+	IndexInt(i int, path ...string) (int, error)
+	IndexUInt(i int, path ...string) (uint, error)
+	IndexFloat(i int, path ...string) (float64, error)
+	IndexBool(i int, path ...string) (bool, error)
+	IndexString(i int, path ...string) (string, error)
+
+	// Elements ranges over the elements of the array at path, and the
+	// iterators step through the elements of an array or the members of an
+	// object. They read the document in place, so a Value they yield is only
+	// valid until the next step, and Get returns one to keep. Elements yields
+	// nothing if there is no array at path; the iterators return the error.
+	Elements(path ...string) iter.Seq2[int, Value]
+	ArrayIterator(path ...string) (ArrayIterator, error)
+	ObjectIterator(path ...string) (ObjectIterator, error)
+
+	// MemoryUsage returns the bytes of native memory held by the document
+	// the value belongs to, or 0 for values kept in Go memory.
+	MemoryUsage() int
 }
 
 type Type int
@@ -27,4 +77,91 @@ const (
 	TypeString
 	TypeObject
 	TypeUnknown
+	TypeMissing
 )
+
+func (t Type) String() string {
+	switch t {
+	case TypeBool:
+		return "bool"
+	case TypeNull:
+		return "null"
+	case TypeArray:
+		return "array"
+	case TypeNumber:
+		return "number"
+	case TypeString:
+		return "string"
+	case TypeObject:
+		return "object"
+	case TypeMissing:
+		return "missing"
+	}
+	return "unknown"
+}
+
+// NumberKind is a set of flags for a number. A number written without a
+// fraction or exponent that fits in an int64 or a uint64 is an integer, and
+// has the flag of each integer type that holds it: a negative integer has no
+// unsigned flags. Any other number is NumberFloat.
+type NumberKind int
+
+const (
+	NumberInt32  NumberKind = number.FitsInt32
+	NumberUint32 NumberKind = number.FitsUint32
+	NumberInt64  NumberKind = number.FitsInt64
+	NumberUint64 NumberKind = number.FitsUint64
+	NumberFloat  NumberKind = number.IsFloat
+)
+
+// IsInteger reports whether GetInt or GetUInt accept the number, depending
+// on its sign and size.
+func (k NumberKind) IsInteger() bool {
+	return k&(NumberInt64|NumberUint64) != 0
+}
+
+func (k NumberKind) String() string {
+	var names []string
+	for _, flag := range []struct {
+		kind NumberKind
+		name string
+	}{{NumberInt32, "int32"}, {NumberUint32, "uint32"}, {NumberInt64, "int64"}, {NumberUint64, "uint64"}, {NumberFloat, "float"}} {
+		if k&flag.kind != 0 {
+			names = append(names, flag.name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, "|")
+}
+
+// Private functions.
+
+// The number v holds, read through its getters so that it is classified as
+// the backend keeps it rather than as its text is spelled.
+func getNumber(v Value) (number.Number, error) {
+	kind, err := v.NumberKind()
+	if err != nil {
+		return number.Number{}, err
+	}
+	switch {
+	case kind&NumberInt64 != 0:
+		if i, err := v.GetInt(); err == nil {
+			return number.Number{Kind: number.Int, I: int64(i)}, nil
+		}
+	case kind&NumberUint64 != 0:
+		if u, err := v.GetUInt(); err == nil {
+			return number.Number{Kind: number.Uint, U: uint64(u)}, nil
+		}
+	default:
+		f, err := v.GetFloat()
+		return number.Number{Kind: number.Float, F: f}, err
+	}
+	// Only on 32-bit platforms is an integer wider than int.
+	text, err := v.Stringify()
+	if err != nil {
+		return number.Number{}, err
+	}
+	return number.Parse(text), nil
+}
@@ -0,0 +1,755 @@
+// Package jogtest checks that an implementation of jog.Value behaves like the
+// backends of this module. A backend runs the checks from one of its tests:
+//
+//	func TestConformance(t *testing.T) {
+//		jogtest.RunConformance(t, func(data []byte) (jog.Value, error) {
+//			return mybackend.Parse(data)
+//		})
+//	}
+//
+// The checks cover every method of jog.Value, the errors of the getters,
+// numbers at the limits of each Go type, unicode and Stringify round trips.
+// They leave out what RFC 8259 leaves to implementations: duplicate keys,
+// lone surrogates and numbers beyond the range of a float64.
+package jogtest
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/anantn/jog"
+)
+
+// ParseFunc parses a complete JSON document.
+type ParseFunc func(data []byte) (jog.Value, error)
+
+// RunConformance runs each group of checks as a subtest of t.
+func RunConformance(t *testing.T, parse ParseFunc) {
+	for _, group := range []struct {
+		name string
+		run  func(*testing.T, ParseFunc)
+	}{
+		{"Parse", testParse},
+		{"Types", testTypes},
+		{"Getters", testGetters},
+		{"Containers", testContainers},
+		{"Index", testIndex},
+		{"Iterators", testIterators},
+		{"Errors", testErrors},
+		{"Numbers", testNumbers},
+		{"Unicode", testUnicode},
+		{"Stringify", testStringify},
+		{"Memory", testMemory},
+		{"Concurrent", testConcurrent},
+	} {
+		t.Run(group.name, func(t *testing.T) {
+			group.run(t, parse)
+		})
+	}
+}
+
+const document = `{"null":null,"true":true,"false":false,"int":42,"neg":-7,"float":2.5,"string":"text","empty":{},"list":[1,"two",[3],{"four":4}],"object":{"a":{"b":"c"}}}`
+
+// The type of each member of document.
+var types = map[string]jog.Type{
+	"null":   jog.TypeNull,
+	"true":   jog.TypeBool,
+	"false":  jog.TypeBool,
+	"int":    jog.TypeNumber,
+	"neg":    jog.TypeNumber,
+	"float":  jog.TypeNumber,
+	"string": jog.TypeString,
+	"empty":  jog.TypeObject,
+	"list":   jog.TypeArray,
+	"object": jog.TypeObject,
+}
+
+func mustParse(t *testing.T, parse ParseFunc, doc string) jog.Value {
+	t.Helper()
+	v, err := parse([]byte(doc))
+	if err != nil {
+		t.Fatalf("Couldn't parse %s: %v\n", doc, err)
+	}
+	if v == nil {
+		t.Fatalf("Parsing %s returned no value\n", doc)
+	}
+	return v
+}
+
+func mustGet(t *testing.T, v jog.Value, path ...string) jog.Value {
+	t.Helper()
+	n, err := v.Get(path...)
+	if err != nil {
+		t.Fatalf("Couldn't get %v: %v\n", path, err)
+	}
+	return n
+}
+
+func testParse(t *testing.T, parse ParseFunc) {
+	valid := []string{`{}`, `[]`, `""`, `0`, `-1.5e3`, `true`, `false`, `null`, " \t\r\n[ 1 , {\"a\" : [ ] } ]\n ", document}
+	for _, doc := range valid {
+		mustParse(t, parse, doc)
+	}
+	invalid := []string{``, ` `, `{`, `]`, `[1,]`, `{"a":1,}`, `{"a" 1}`, `{a:1}`, `[1 2]`, `tru`, `nul`, `01`, `1.`, `.5`, `+1`, `-`, `1e`, `"abc`, `"\x"`, `"\u12"`, `[1] 2`, `{} {}`, `'a'`}
+	for _, doc := range invalid {
+		if _, err := parse([]byte(doc)); err == nil {
+			t.Fatalf("Expected %q not to parse\n", doc)
+		}
+	}
+}
+
+func testTypes(t *testing.T, parse ParseFunc) {
+	v := mustParse(t, parse, document)
+	if typ := v.Type(); typ != jog.TypeObject {
+		t.Fatalf("Expected the document to be an object, got %s\n", typ)
+	}
+	for key, want := range types {
+		if typ := v.Type(key); typ != want {
+			t.Fatalf("Expected %s to be %s, got %s\n", key, want, typ)
+		}
+		if typ := mustGet(t, v, key).Type(); typ != want {
+			t.Fatalf("Expected the value of %s to be %s, got %s\n", key, want, typ)
+		}
+		if !v.Exists(key) {
+			t.Fatalf("Expected %s to exist\n", key)
+		}
+		if null := v.IsNull(key); null != (want == jog.TypeNull) {
+			t.Fatalf("Expected IsNull(%s) to be %v\n", key, !null)
+		}
+	}
+	for _, path := range [][]string{{"missing"}, {"object", "missing"}, {"null", "a"}, {"list", "0"}, {"string", "a"}, {"object", "a", "b", "c"}} {
+		if typ := v.Type(path...); typ != jog.TypeMissing {
+			t.Fatalf("Expected %v to be missing, got %s\n", path, typ)
+		}
+		if v.Exists(path...) || v.IsNull(path...) {
+			t.Fatalf("Expected %v not to exist\n", path)
+		}
+	}
+	for doc, want := range map[string]jog.Type{`null`: jog.TypeNull, `true`: jog.TypeBool, `1`: jog.TypeNumber, `"s"`: jog.TypeString, `[]`: jog.TypeArray} {
+		if typ := mustParse(t, parse, doc).Type(); typ != want {
+			t.Fatalf("Expected %s to be %s, got %s\n", doc, want, typ)
+		}
+	}
+}
+
+func testGetters(t *testing.T, parse ParseFunc) {
+	v := mustParse(t, parse, document)
+	if b, err := v.GetBool("true"); err != nil || !b {
+		t.Fatalf("Expected true, got %v (%v)\n", b, err)
+	}
+	if b, err := v.GetBool("false"); err != nil || b {
+		t.Fatalf("Expected false, got %v (%v)\n", b, err)
+	}
+	if i, err := v.GetInt("int"); err != nil || i != 42 {
+		t.Fatalf("Expected 42, got %d (%v)\n", i, err)
+	}
+	if i, err := v.GetInt("neg"); err != nil || i != -7 {
+		t.Fatalf("Expected -7, got %d (%v)\n", i, err)
+	}
+	if u, err := v.GetUInt("int"); err != nil || u != 42 {
+		t.Fatalf("Expected 42, got %d (%v)\n", u, err)
+	}
+	if f, err := v.GetFloat("int"); err != nil || f != 42 {
+		t.Fatalf("Expected 42, got %v (%v)\n", f, err)
+	}
+	if f, err := v.GetFloat("float"); err != nil || f != 2.5 {
+		t.Fatalf("Expected 2.5, got %v (%v)\n", f, err)
+	}
+	if k, err := v.NumberKind("float"); err != nil || k != jog.NumberFloat {
+		t.Fatalf("Expected a float, got %s (%v)\n", k, err)
+	}
+	if s, err := v.GetString("string"); err != nil || s != "text" {
+		t.Fatalf("Expected text, got %q (%v)\n", s, err)
+	}
+	if s, err := v.GetString("object", "a", "b"); err != nil || s != "c" {
+		t.Fatalf("Expected c, got %q (%v)\n", s, err)
+	}
+
+	// A child answers with the paths below it, and an empty path is the
+	// value itself.
+	a := mustGet(t, v, "object", "a")
+	if s, err := a.GetString("b"); err != nil || s != "c" {
+		t.Fatalf("Expected c below object/a, got %q (%v)\n", s, err)
+	}
+	if i, err := mustGet(t, v, "int").GetInt(); err != nil || i != 42 {
+		t.Fatalf("Expected 42 from the child, got %d (%v)\n", i, err)
+	}
+	if s, err := mustParse(t, parse, `"top"`).GetString(); err != nil || s != "top" {
+		t.Fatalf("Expected a top level string, got %q (%v)\n", s, err)
+	}
+
+	// At agrees with Get, for the same path compiled once and used again.
+	p := jog.CompilePath("object", "a", "b")
+	for i := 0; i < 2; i++ {
+		n, err := v.At(p)
+		if err != nil {
+			t.Fatalf("Couldn't get %s: %v\n", p, err)
+		}
+		if s, err := n.GetString(); err != nil || s != "c" {
+			t.Fatalf("Expected c at %s, got %q (%v)\n", p, s, err)
+		}
+	}
+	if s, err := jog.CompilePath("b").GetString(a); err != nil || s != "c" {
+		t.Fatalf("Expected c at b below object/a, got %q (%v)\n", s, err)
+	}
+	if _, err := v.At(jog.CompilePath("object", "missing")); !errors.Is(err, jog.ErrNotFound) {
+		t.Fatalf("Expected object/missing not to be found, got %v\n", err)
+	}
+}
+
+func testContainers(t *testing.T, parse ParseFunc) {
+	v := mustParse(t, parse, document)
+	members, err := v.GetObject()
+	if err != nil {
+		t.Fatalf("Couldn't get the document as an object: %v\n", err)
+	}
+	if len(members) != len(types) {
+		t.Fatalf("Expected %d members, got %d\n", len(types), len(members))
+	}
+	for key, want := range types {
+		member, ok := members[key]
+		if !ok {
+			t.Fatalf("Expected a member %s\n", key)
+		}
+		if typ := member.Type(); typ != want {
+			t.Fatalf("Expected member %s to be %s, got %s\n", key, want, typ)
+		}
+	}
+	if empty, err := v.GetObject("empty"); err != nil || empty == nil || len(empty) != 0 {
+		t.Fatalf("Expected an empty object, got %v (%v)\n", empty, err)
+	}
+
+	list, err := v.GetArray("list")
+	if err != nil {
+		t.Fatalf("Couldn't get list: %v\n", err)
+	}
+	want := []jog.Type{jog.TypeNumber, jog.TypeString, jog.TypeArray, jog.TypeObject}
+	if len(list) != len(want) {
+		t.Fatalf("Expected %d elements, got %d\n", len(want), len(list))
+	}
+	for i, elem := range list {
+		if typ := elem.Type(); typ != want[i] {
+			t.Fatalf("Expected element %d to be %s, got %s\n", i, want[i], typ)
+		}
+	}
+	if s, err := list[1].GetString(); err != nil || s != "two" {
+		t.Fatalf("Expected two, got %q (%v)\n", s, err)
+	}
+	if inner, err := list[2].GetArray(); err != nil || len(inner) != 1 {
+		t.Fatalf("Expected an array of one, got %v (%v)\n", inner, err)
+	}
+	if i, err := list[3].GetInt("four"); err != nil || i != 4 {
+		t.Fatalf("Expected 4, got %d (%v)\n", i, err)
+	}
+	if empty, err := mustParse(t, parse, `[]`).GetArray(); err != nil || empty == nil || len(empty) != 0 {
+		t.Fatalf("Expected an empty array, got %v (%v)\n", empty, err)
+	}
+}
+
+func testIndex(t *testing.T, parse ParseFunc) {
+	v := mustParse(t, parse, document)
+	for path, want := range map[string]int{"list": 4, "object": 1, "empty": 0, "": len(types)} {
+		var segments []string
+		if path != "" {
+			segments = []string{path}
+		}
+		if n, err := v.Len(segments...); err != nil || n != want {
+			t.Fatalf("Expected %q to have length %d, got %d (%v)\n", path, want, n, err)
+		}
+	}
+	if n, err := jog.CompilePath("list").Len(v); err != nil || n != 4 {
+		t.Fatalf("Expected the compiled path list to have length 4, got %d (%v)\n", n, err)
+	}
+	_, err := v.Len("string")
+	checkPathError(t, err, jog.PathError{Path: []string{"string"}, Segment: 1, Expected: "array or object", Actual: jog.TypeString, Err: jog.ErrTypeMismatch})
+	_, err = v.Len("object", "missing")
+	checkPathError(t, err, jog.PathError{Path: []string{"object", "missing"}, Segment: 1, Expected: "array or object", Actual: jog.TypeObject, Err: jog.ErrNotFound})
+
+	if i, err := v.IndexInt(0, "list"); err != nil || i != 1 {
+		t.Fatalf("Expected 1, got %d (%v)\n", i, err)
+	}
+	if u, err := v.IndexUInt(0, "list"); err != nil || u != 1 {
+		t.Fatalf("Expected 1, got %d (%v)\n", u, err)
+	}
+	if f, err := v.IndexFloat(0, "list"); err != nil || f != 1 {
+		t.Fatalf("Expected 1, got %v (%v)\n", f, err)
+	}
+	if s, err := v.IndexString(1, "list"); err != nil || s != "two" {
+		t.Fatalf("Expected two, got %q (%v)\n", s, err)
+	}
+	inner, err := v.Index(2, "list")
+	if err != nil {
+		t.Fatalf("Couldn't get element 2 of list: %v\n", err)
+	}
+	if i, err := inner.IndexInt(0); err != nil || i != 3 {
+		t.Fatalf("Expected 3 in the inner array, got %d (%v)\n", i, err)
+	}
+	if i, err := mustGet(t, v, "list").IndexInt(3, "four"); err == nil {
+		t.Fatalf("Expected a path through an array to fail, got %d\n", i)
+	}
+	if s, err := jog.CompilePath("list").IndexString(v, 1); err != nil || s != "two" {
+		t.Fatalf("Expected two from the compiled path, got %q (%v)\n", s, err)
+	}
+	top := mustParse(t, parse, `[true,2.5,"s"]`)
+	if b, err := top.IndexBool(0); err != nil || !b {
+		t.Fatalf("Expected true, got %v (%v)\n", b, err)
+	}
+	if f, err := top.IndexFloat(1); err != nil || f != 2.5 {
+		t.Fatalf("Expected 2.5, got %v (%v)\n", f, err)
+	}
+
+	// Errors about the element name it by its index.
+	_, err = v.IndexInt(3, "list")
+	checkPathError(t, err, jog.PathError{Path: []string{"list", "3"}, Segment: 2, Expected: "int", Actual: jog.TypeObject, Err: jog.ErrTypeMismatch})
+	_, err = v.IndexBool(4, "list")
+	checkPathError(t, err, jog.PathError{Path: []string{"list", "4"}, Segment: 1, Expected: "bool", Actual: jog.TypeArray, Err: jog.ErrNotFound})
+	_, err = v.Index(-1, "list")
+	checkPathError(t, err, jog.PathError{Path: []string{"list", "-1"}, Segment: 1, Expected: "value", Actual: jog.TypeArray, Err: jog.ErrNotFound})
+	_, err = top.IndexUInt(1)
+	checkPathError(t, err, jog.PathError{Path: []string{"1"}, Segment: 1, Expected: "uint", Actual: jog.TypeNumber, Err: jog.ErrTypeMismatch})
+	_, err = jog.CompilePath("list").IndexString(v, 0)
+	checkPathError(t, err, jog.PathError{Path: []string{"list", "0"}, Segment: 2, Expected: "string", Actual: jog.TypeNumber, Err: jog.ErrTypeMismatch})
+
+	// Errors finding the array are about an array.
+	_, err = v.IndexString(0, "object")
+	checkPathError(t, err, jog.PathError{Path: []string{"object"}, Segment: 1, Expected: "array", Actual: jog.TypeObject, Err: jog.ErrTypeMismatch})
+	_, err = v.IndexInt(0, "missing")
+	checkPathError(t, err, jog.PathError{Path: []string{"missing"}, Segment: 0, Expected: "array", Actual: jog.TypeObject, Err: jog.ErrNotFound})
+	_, err = jog.CompilePath("missing").Index(v, 0)
+	checkPathError(t, err, jog.PathError{Path: []string{"missing"}, Segment: 0, Expected: "array", Actual: jog.TypeObject, Err: jog.ErrNotFound})
+}
+
+func testIterators(t *testing.T, parse ParseFunc) {
+	v := mustParse(t, parse, document)
+	want := []jog.Type{jog.TypeNumber, jog.TypeString, jog.TypeArray, jog.TypeObject}
+	var kept []jog.Value
+	for i, elem := range v.Elements("list") {
+		if i != len(kept) {
+			t.Fatalf("Expected element %d, got %d\n", len(kept), i)
+		}
+		if typ := elem.Type(); typ != want[i] {
+			t.Fatalf("Expected element %d to be %s, got %s\n", i, want[i], typ)
+		}
+		elem, err := elem.Get()
+		if err != nil {
+			t.Fatalf("Couldn't keep element %d: %v\n", i, err)
+		}
+		kept = append(kept, elem)
+	}
+	if len(kept) != len(want) {
+		t.Fatalf("Expected %d elements, got %d\n", len(want), len(kept))
+	}
+	// The values Get returned outlive the steps that yielded them.
+	for i, elem := range kept {
+		if typ := elem.Type(); typ != want[i] {
+			t.Fatalf("Expected kept element %d to be %s, got %s\n", i, want[i], typ)
+		}
+	}
+	if s, err := kept[1].GetString(); err != nil || s != "two" {
+		t.Fatalf("Expected two, got %q (%v)\n", s, err)
+	}
+	if i, err := kept[3].GetInt("four"); err != nil || i != 4 {
+		t.Fatalf("Expected 4, got %d (%v)\n", i, err)
+	}
+
+	steps := 0
+	for range v.Elements("list") {
+		if steps++; steps == 2 {
+			break
+		}
+	}
+	if steps != 2 {
+		t.Fatalf("Expected break to stop after 2 elements, got %d\n", steps)
+	}
+	for _, path := range [][]string{{"object"}, {"string"}, {"missing"}, {"object", "a", "missing"}} {
+		for i := range v.Elements(path...) {
+			t.Fatalf("Expected nothing from %v, got element %d\n", path, i)
+		}
+	}
+	for i := range mustParse(t, parse, `[]`).Elements() {
+		t.Fatalf("Expected nothing from an empty array, got element %d\n", i)
+	}
+
+	// Iterating an element doesn't disturb the iterator it came from.
+	sum := 0
+	for _, row := range mustParse(t, parse, `[[1,2],[],[3,[4]],[5]]`).Elements() {
+		for _, cell := range row.Elements() {
+			if n, err := cell.GetInt(); err == nil {
+				sum += n
+			}
+		}
+	}
+	if sum != 11 {
+		t.Fatalf("Expected nested iteration to sum to 11, got %d\n", sum)
+	}
+
+	it, err := v.ArrayIterator("list")
+	if err != nil {
+		t.Fatalf("Couldn't iterate over list: %v\n", err)
+	}
+	if it.Value() != nil {
+		t.Fatalf("Expected no value before the first step\n")
+	}
+	for i := 0; it.Next(); i++ {
+		if it.Index() != i {
+			t.Fatalf("Expected index %d, got %d\n", i, it.Index())
+		}
+		if typ := it.Value().Type(); typ != want[i] {
+			t.Fatalf("Expected element %d to be %s, got %s\n", i, want[i], typ)
+		}
+	}
+	if it.Next() || it.Value() != nil {
+		t.Fatalf("Expected the iterator to stay at the end\n")
+	}
+	if it, err := mustParse(t, parse, `[]`).ArrayIterator(); err != nil || it.Next() {
+		t.Fatalf("Expected an empty array to have no elements (%v)\n", err)
+	}
+
+	obj, err := v.ObjectIterator()
+	if err != nil {
+		t.Fatalf("Couldn't iterate over the document: %v\n", err)
+	}
+	var keys []string
+	for obj.Next() {
+		key := obj.Key()
+		if typ := obj.Value().Type(); typ != types[key] {
+			t.Fatalf("Expected member %s to be %s, got %s\n", key, types[key], typ)
+		}
+		keys = append(keys, key)
+	}
+	order := []string{"null", "true", "false", "int", "neg", "float", "string", "empty", "list", "object"}
+	if !slices.Equal(keys, order) {
+		t.Fatalf("Expected the members in document order %v, got %v\n", order, keys)
+	}
+	if obj.Next() || obj.Key() != "" || obj.Value() != nil {
+		t.Fatalf("Expected the iterator to stay at the end\n")
+	}
+	if obj, err := v.ObjectIterator("empty"); err != nil || obj.Next() {
+		t.Fatalf("Expected an empty object to have no members (%v)\n", err)
+	}
+	obj, err = mustParse(t, parse, `{"caf\u00e9":1,"\"q\"":2}`).ObjectIterator()
+	if err != nil {
+		t.Fatalf("Couldn't iterate over escaped keys: %v\n", err)
+	}
+	for _, key := range []string{"café", `"q"`} {
+		if !obj.Next() || obj.Key() != key {
+			t.Fatalf("Expected the key %q, got %q\n", key, obj.Key())
+		}
+	}
+
+	// Compiled paths and coerced views iterate the same way.
+	steps = 0
+	for range jog.CompilePath("list").Elements(v) {
+		steps++
+	}
+	if steps != 4 {
+		t.Fatalf("Expected 4 elements through the compiled path, got %d\n", steps)
+	}
+	obj, err = jog.CompilePath("object", "a").ObjectIterator(v)
+	if err != nil || !obj.Next() || obj.Key() != "b" {
+		t.Fatalf("Expected the member b through the compiled path (%v)\n", err)
+	}
+	if s, err := obj.Value().GetString(); err != nil || s != "c" {
+		t.Fatalf("Expected c, got %q (%v)\n", s, err)
+	}
+	_, err = jog.CompilePath("object", "a").ArrayIterator(v)
+	checkPathError(t, err, jog.PathError{Path: []string{"object", "a"}, Segment: 2, Expected: "array", Actual: jog.TypeObject, Err: jog.ErrTypeMismatch})
+	for _, elem := range jog.Coerce(v).Elements("list") {
+		if s, err := elem.GetString(); err != nil || s != "1" {
+			t.Fatalf("Expected the first element to coerce to \"1\", got %q (%v)\n", s, err)
+		}
+		break
+	}
+	obj, err = jog.Coerce(v).ObjectIterator()
+	if err != nil {
+		t.Fatalf("Couldn't iterate over the coerced document: %v\n", err)
+	}
+	for obj.Next() && obj.Key() != "int" {
+	}
+	if s, err := obj.Value().GetString(); err != nil || s != "42" {
+		t.Fatalf("Expected int to coerce to \"42\", got %q (%v)\n", s, err)
+	}
+}
+
+// A getter, by the name PathError.Expected gives it, and the members of
+// document it accepts.
+type getter struct {
+	name    string
+	get     func(v jog.Value, path ...string) error
+	accepts []string
+}
+
+var getters = []getter{
+	{"value", func(v jog.Value, path ...string) error { _, err := v.Get(path...); return err }, nil},
+	{"int", func(v jog.Value, path ...string) error { _, err := v.GetInt(path...); return err }, []string{"int", "neg"}},
+	{"uint", func(v jog.Value, path ...string) error { _, err := v.GetUInt(path...); return err }, []string{"int"}},
+	{"float", func(v jog.Value, path ...string) error { _, err := v.GetFloat(path...); return err }, []string{"int", "neg", "float"}},
+	{"number", func(v jog.Value, path ...string) error { _, err := v.NumberKind(path...); return err }, []string{"int", "neg", "float"}},
+	{"bool", func(v jog.Value, path ...string) error { _, err := v.GetBool(path...); return err }, []string{"true", "false"}},
+	{"string", func(v jog.Value, path ...string) error { _, err := v.GetString(path...); return err }, []string{"string"}},
+	{"array", func(v jog.Value, path ...string) error { _, err := v.GetArray(path...); return err }, []string{"list"}},
+	{"object", func(v jog.Value, path ...string) error { _, err := v.GetObject(path...); return err }, []string{"empty", "object"}},
+	{"array", func(v jog.Value, path ...string) error { _, err := v.ArrayIterator(path...); return err }, []string{"list"}},
+	{"object", func(v jog.Value, path ...string) error { _, err := v.ObjectIterator(path...); return err }, []string{"empty", "object"}},
+}
+
+func checkPathError(t *testing.T, err error, want jog.PathError) {
+	t.Helper()
+	var pe *jog.PathError
+	if !errors.As(err, &pe) {
+		t.Fatalf("Expected a *jog.PathError for %s at %v, got %T: %v\n", want.Expected, want.Path, err, err)
+	}
+	if !errors.Is(err, want.Err) {
+		t.Fatalf("Expected %v for %s at %v, got %v\n", want.Err, want.Expected, want.Path, err)
+	}
+	if !slices.Equal(pe.Path, want.Path) || pe.Segment != want.Segment || pe.Expected != want.Expected || pe.Actual != want.Actual {
+		t.Fatalf("Expected %+v, got %+v\n", want, *pe)
+	}
+	if err.Error() == "" {
+		t.Fatalf("Expected a message for %+v\n", want)
+	}
+}
+
+func testErrors(t *testing.T, parse ParseFunc) {
+	v := mustParse(t, parse, document)
+	for _, g := range getters {
+		for key, typ := range types {
+			err := g.get(v, key)
+			switch {
+			case g.accepts == nil || slices.Contains(g.accepts, key):
+				if err != nil {
+					t.Fatalf("Expected %s to get %s, got %v\n", g.name, key, err)
+				}
+			case g.name == "uint" && key == "neg":
+				checkPathError(t, err, jog.PathError{Path: []string{key}, Segment: 1, Expected: g.name, Actual: typ, Err: jog.ErrOverflow})
+			default:
+				checkPathError(t, err, jog.PathError{Path: []string{key}, Segment: 1, Expected: g.name, Actual: typ, Err: jog.ErrTypeMismatch})
+			}
+		}
+		err := g.get(v, "missing")
+		checkPathError(t, err, jog.PathError{Path: []string{"missing"}, Segment: 0, Expected: g.name, Actual: jog.TypeObject, Err: jog.ErrNotFound})
+		err = g.get(v, "object", "a", "missing", "deeper")
+		checkPathError(t, err, jog.PathError{Path: []string{"object", "a", "missing", "deeper"}, Segment: 2, Expected: g.name, Actual: jog.TypeObject, Err: jog.ErrNotFound})
+		err = g.get(v, "list", "0")
+		checkPathError(t, err, jog.PathError{Path: []string{"list", "0"}, Segment: 1, Expected: g.name, Actual: jog.TypeArray, Err: jog.ErrNotFound})
+		err = g.get(v, "float", "x")
+		checkPathError(t, err, jog.PathError{Path: []string{"float", "x"}, Segment: 1, Expected: g.name, Actual: jog.TypeNumber, Err: jog.ErrNotFound})
+		err = g.get(mustGet(t, v, "null"), "x")
+		checkPathError(t, err, jog.PathError{Path: []string{"x"}, Segment: 0, Expected: g.name, Actual: jog.TypeNull, Err: jog.ErrNotFound})
+		// A key holding a NUL byte is not the key it starts with.
+		err = g.get(v, "object\x00x", "a")
+		checkPathError(t, err, jog.PathError{Path: []string{"object\x00x", "a"}, Segment: 0, Expected: g.name, Actual: jog.TypeObject, Err: jog.ErrNotFound})
+	}
+	_, err := v.At(jog.CompilePath("object\x00x", "a"))
+	checkPathError(t, err, jog.PathError{Path: []string{"object\x00x", "a"}, Segment: 0, Expected: "value", Actual: jog.TypeObject, Err: jog.ErrNotFound})
+	if _, err := v.Stringify("missing"); !errors.Is(err, jog.ErrNotFound) {
+		t.Fatalf("Expected stringifying a missing value to fail, got %v\n", err)
+	}
+}
+
+const numbers = `{"maxInt32":2147483647,"minInt32":-2147483648,"maxUint32":4294967295,"maxInt64":9223372036854775807,"minInt64":-9223372036854775808,"aboveInt64":9223372036854775808,"maxUint64":18446744073709551615,"aboveUint64":18446744073709551616,"maxSafe":9007199254740992,"unsafe":9007199254740993,"zero":0,"negZero":-0,"whole":1.0,"exp":1e3,"negExp":-1.5E-3,"tiny":5e-324,"maxFloat":1.7976931348623157e308}`
+
+func testNumbers(t *testing.T, parse ParseFunc) {
+	const (
+		i32 = jog.NumberInt32
+		u32 = jog.NumberUint32
+		i64 = jog.NumberInt64
+		u64 = jog.NumberUint64
+	)
+	v := mustParse(t, parse, numbers)
+	kinds := map[string]jog.NumberKind{
+		"maxInt32":    i32 | u32 | i64 | u64,
+		"minInt32":    i32 | i64,
+		"maxUint32":   u32 | i64 | u64,
+		"maxInt64":    i64 | u64,
+		"minInt64":    i64,
+		"aboveInt64":  u64,
+		"maxUint64":   u64,
+		"aboveUint64": jog.NumberFloat,
+		"maxSafe":     i64 | u64,
+		"unsafe":      i64 | u64,
+		"zero":        i32 | u32 | i64 | u64,
+		"negZero":     i32 | u32 | i64 | u64,
+		"whole":       jog.NumberFloat,
+		"exp":         jog.NumberFloat,
+		"negExp":      jog.NumberFloat,
+		"tiny":        jog.NumberFloat,
+		"maxFloat":    jog.NumberFloat,
+	}
+	for key, want := range kinds {
+		if k, err := v.NumberKind(key); err != nil || k != want {
+			t.Fatalf("Expected %s to be %s, got %s (%v)\n", key, want, k, err)
+		}
+	}
+
+	// Where int is 64 bits, GetInt takes any integer within int64.
+	ints := map[string]int64{"maxInt32": math.MaxInt32, "minInt32": math.MinInt32, "maxUint32": math.MaxUint32, "maxSafe": 1 << 53, "unsafe": 1<<53 + 1, "zero": 0, "negZero": 0}
+	if math.MaxInt == math.MaxInt64 {
+		ints["maxInt64"] = math.MaxInt64
+		ints["minInt64"] = math.MinInt64
+	}
+	for key, want := range ints {
+		if i, err := v.GetInt(key); err != nil || int64(i) != want {
+			t.Fatalf("Expected %s to be %d, got %d (%v)\n", key, want, i, err)
+		}
+	}
+	uints := map[string]uint64{"maxUint32": math.MaxUint32, "zero": 0}
+	if math.MaxUint == math.MaxUint64 {
+		uints["maxInt64"] = math.MaxInt64
+		uints["aboveInt64"] = 1 << 63
+		uints["maxUint64"] = math.MaxUint64
+	}
+	for key, want := range uints {
+		if u, err := v.GetUInt(key); err != nil || uint64(u) != want {
+			t.Fatalf("Expected %s to be %d, got %d (%v)\n", key, want, u, err)
+		}
+	}
+	// Integers a float64 can't hold read as the nearest one.
+	floats := map[string]float64{"maxInt32": math.MaxInt32, "maxSafe": 1 << 53, "unsafe": 1 << 53, "maxInt64": 1 << 63, "minInt64": -1 << 63, "maxUint64": 1 << 64, "aboveUint64": 1 << 64, "zero": 0, "whole": 1, "exp": 1000, "negExp": -0.0015, "tiny": math.SmallestNonzeroFloat64, "maxFloat": math.MaxFloat64}
+	for key, want := range floats {
+		if f, err := v.GetFloat(key); err != nil || f != want {
+			t.Fatalf("Expected %s to be %v, got %v (%v)\n", key, want, f, err)
+		}
+	}
+
+	for _, key := range []string{"aboveInt64", "maxUint64"} {
+		if _, err := v.GetInt(key); !errors.Is(err, jog.ErrOverflow) {
+			t.Fatalf("Expected %s to overflow an int, got %v\n", key, err)
+		}
+	}
+	for _, key := range []string{"minInt32", "minInt64"} {
+		if _, err := v.GetUInt(key); !errors.Is(err, jog.ErrOverflow) {
+			t.Fatalf("Expected %s to overflow a uint, got %v\n", key, err)
+		}
+	}
+	for _, key := range []string{"aboveUint64", "whole", "exp", "tiny"} {
+		if _, err := v.GetInt(key); !errors.Is(err, jog.ErrTypeMismatch) {
+			t.Fatalf("Expected %s not to be an int, got %v\n", key, err)
+		}
+		if _, err := v.GetUInt(key); !errors.Is(err, jog.ErrTypeMismatch) {
+			t.Fatalf("Expected %s not to be a uint, got %v\n", key, err)
+		}
+	}
+}
+
+const unicode = `{"ascii":"plain","escaped":"é日😀","raw":"é日😀","controls":"\b\f\n\r\t\"\\\/\u001f","keyé":1,"key":2,"日本":{"語":"ja"}}`
+
+func testUnicode(t *testing.T, parse ParseFunc) {
+	v := mustParse(t, parse, unicode)
+	strings := map[string]string{"ascii": "plain", "escaped": "é日😀", "raw": "é日😀", "controls": "\b\f\n\r\t\"\\/\x1f"}
+	for key, want := range strings {
+		if s, err := v.GetString(key); err != nil || s != want {
+			t.Fatalf("Expected %s to be %q, got %q (%v)\n", key, want, s, err)
+		}
+	}
+	if i, err := v.GetInt("keyé"); err != nil || i != 1 {
+		t.Fatalf("Expected a key with raw unicode, got %d (%v)\n", i, err)
+	}
+	if i, err := v.GetInt("key"); err != nil || i != 2 {
+		t.Fatalf("Expected a key written with escapes, got %d (%v)\n", i, err)
+	}
+	if s, err := v.GetString("日本", "語"); err != nil || s != "ja" {
+		t.Fatalf("Expected a path of unicode keys, got %q (%v)\n", s, err)
+	}
+	members, err := v.GetObject()
+	if err != nil {
+		t.Fatalf("Couldn't get the members: %v\n", err)
+	}
+	keys := make([]string, 0, len(members))
+	for key := range members {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if want := []string{"ascii", "controls", "escaped", "key", "keyé", "raw", "日本"}; !slices.Equal(keys, want) {
+		t.Fatalf("Expected the keys %q, got %q\n", want, keys)
+	}
+}
+
+func testStringify(t *testing.T, parse ParseFunc) {
+	// Text that every backend writes back unchanged.
+	for _, doc := range []string{`{}`, `[]`, `null`, `true`, `"s"`, `42`, `-7`, `2.5`, document} {
+		v := mustParse(t, parse, doc)
+		if s, err := v.Stringify(); err != nil || s != doc {
+			t.Fatalf("Expected %s to stringify unchanged, got %s (%v)\n", doc, s, err)
+		}
+	}
+
+	// Any document reads back as the same data.
+	for _, doc := range []string{document, numbers, unicode, ` [ {"a" : [ 1 , 2.50 , 1E2 ] } , "A" ] `} {
+		v := mustParse(t, parse, doc)
+		s, err := v.Stringify()
+		if err != nil {
+			t.Fatalf("Couldn't stringify %s: %v\n", doc, err)
+		}
+		again := mustParse(t, parse, s)
+		if !jog.Equal(v, again) {
+			t.Fatalf("Expected %s to read back as %s\n", s, doc)
+		}
+	}
+
+	v := mustParse(t, parse, document)
+	for key := range types {
+		s, err := v.Stringify(key)
+		if err != nil {
+			t.Fatalf("Couldn't stringify %s: %v\n", key, err)
+		}
+		if child := mustParse(t, parse, s); !jog.Equal(child, mustGet(t, v, key)) {
+			t.Fatalf("Expected %s to read back as the value of %s\n", s, key)
+		}
+	}
+}
+
+func testMemory(t *testing.T, parse ParseFunc) {
+	v := mustParse(t, parse, document)
+	child := mustGet(t, v, "object", "a")
+	if _, err := child.GetString("b"); err != nil {
+		t.Fatalf("Couldn't get object/a/b: %v\n", err)
+	}
+	usage := v.MemoryUsage()
+	if usage < 0 {
+		t.Fatalf("Expected a usage of at least 0, got %d\n", usage)
+	}
+	if childUsage := child.MemoryUsage(); childUsage != usage {
+		t.Fatalf("Expected a child to report the usage of its document, %d, got %d\n", usage, childUsage)
+	}
+}
+
+// Values are read from many goroutines at once. Run the tests with -race to
+// also check that reads don't write to shared state.
+func testConcurrent(t *testing.T, parse ParseFunc) {
+	v := mustParse(t, parse, document)
+	want, err := v.Stringify()
+	if err != nil {
+		t.Fatalf("Couldn't stringify the document: %v\n", err)
+	}
+	var wg sync.WaitGroup
+	failures := make(chan string, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				s, _ := v.GetString("object", "a", "b")
+				list, _ := v.GetArray("list")
+				got, _ := v.Stringify()
+				elems := 0
+				for range v.Elements("list") {
+					elems++
+				}
+				if s != "c" || len(list) != 4 || elems != 4 || got != want {
+					failures <- got
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(failures)
+	for got := range failures {
+		t.Fatalf("Expected concurrent reads to agree, got %s\n", got)
+	}
+}
@@ -0,0 +1,43 @@
+package jog
+
+import "sync"
+
+// MemoryStats counts the native memory a backend allocated for documents,
+// parsers and encoders. Go memory is not included.
+type MemoryStats struct {
+	// Bytes currently allocated.
+	InUse int64
+	// Bytes allocated so far, including those already freed.
+	TotalAlloc int64
+	// Allocations and frees so far.
+	Mallocs int64
+	Frees   int64
+}
+
+var (
+	statsMu  sync.Mutex
+	backends = map[string]func() MemoryStats{}
+)
+
+// RegisterStats adds the counters of a backend to Stats. Backends register
+// themselves when their package is initialized.
+func RegisterStats(backend string, stats func() MemoryStats) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	backends[backend] = stats
+}
+
+// Stats returns the native memory counters of all backends in use, summed.
+func Stats() MemoryStats {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	var total MemoryStats
+	for _, stats := range backends {
+		s := stats()
+		total.InUse += s.InUse
+		total.TotalAlloc += s.TotalAlloc
+		total.Mallocs += s.Mallocs
+		total.Frees += s.Frees
+	}
+	return total
+}
@@ -0,0 +1,184 @@
+// Package merge combines JSON documents: JSON Merge Patch (RFC 7386) and a
+// configurable deep merge for layering configuration.
+//
+// Inputs can come from any jog backend and are never modified, the result is
+// a new *tree.Value.
+package merge
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/anantn/jog"
+	"github.com/anantn/jog/tree"
+)
+
+// ArrayStrategy decides how Merge combines two arrays.
+type ArrayStrategy int
+
+const (
+	// The overlay array replaces the base array.
+	ArrayReplace ArrayStrategy = iota
+	// Overlay elements are appended to the base elements.
+	ArrayConcat
+	// Object elements are matched by the member named Options.Key and merged,
+	// unmatched elements are appended.
+	ArrayMergeByKey
+)
+
+// Options for Merge.
+type Options struct {
+	Arrays ArrayStrategy
+	// Member identifying array elements for ArrayMergeByKey.
+	Key string
+	// A null in an overlay deletes the member instead of setting it to null,
+	// like a merge patch does.
+	NullDeletes bool
+}
+
+// MergePatch applies an RFC 7386 merge patch to target. Objects are merged
+// recursively, null deletes a member and anything else, arrays included,
+// replaces the target.
+func MergePatch(target jog.Value, patch jog.Value) (*tree.Value, error) {
+	t, err := tree.Copy(target)
+	if err != nil {
+		return nil, err
+	}
+	p, err := tree.Copy(patch)
+	if err != nil {
+		return nil, err
+	}
+	return mergePatch(t, p), nil
+}
+
+func mergePatch(target *tree.Value, patch *tree.Value) *tree.Value {
+	if patch.Type() != jog.TypeObject {
+		return patch
+	}
+	if target == nil || target.Type() != jog.TypeObject {
+		target = tree.Object()
+	}
+	for _, k := range patch.Keys() {
+		v := patch.Member(k)
+		if v.Type() == jog.TypeNull {
+			if target.Member(k) != nil {
+				target.Delete(k)
+			}
+			continue
+		}
+		target.Set(k, mergePatch(target.Member(k), v))
+	}
+	return target
+}
+
+// Merge layers, later layers taking precedence, e.g. defaults, then
+// environment, then per-tenant overrides. Objects are merged recursively,
+// arrays according to opts.Arrays and any other value replaces what is
+// below it.
+func Merge(opts Options, layers ...jog.Value) (*tree.Value, error) {
+	if opts.Arrays == ArrayMergeByKey && opts.Key == "" {
+		return nil, errors.New("ArrayMergeByKey needs a Key")
+	}
+	var result *tree.Value
+	for i, layer := range layers {
+		t, err := tree.Copy(layer)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read layer %d: %v", i, err)
+		}
+		if result == nil {
+			result = t
+			continue
+		}
+		result = merge(result, t, &opts)
+	}
+	if result == nil {
+		return tree.Null(), nil
+	}
+	return result, nil
+}
+
+func merge(base *tree.Value, overlay *tree.Value, opts *Options) *tree.Value {
+	if base.Type() == jog.TypeObject && overlay.Type() == jog.TypeObject {
+		for _, k := range overlay.Keys() {
+			v := overlay.Member(k)
+			if opts.NullDeletes && v.Type() == jog.TypeNull {
+				if base.Member(k) != nil {
+					base.Delete(k)
+				}
+				continue
+			}
+			if old := base.Member(k); old != nil {
+				base.Set(k, merge(old, v, opts))
+			} else {
+				if opts.NullDeletes {
+					dropNulls(v)
+				}
+				base.Set(k, v)
+			}
+		}
+		return base
+	}
+	if base.Type() == jog.TypeArray && overlay.Type() == jog.TypeArray {
+		switch opts.Arrays {
+		case ArrayConcat:
+			length, _ := overlay.Len()
+			for i := 0; i < length; i++ {
+				base.Append(overlay.Elem(i))
+			}
+			return base
+		case ArrayMergeByKey:
+			return mergeByKey(base, overlay, opts)
+		}
+	}
+	if opts.NullDeletes {
+		dropNulls(overlay)
+	}
+	return overlay
+}
+
+func mergeByKey(base *tree.Value, overlay *tree.Value, opts *Options) *tree.Value {
+	baseLength, _ := base.Len()
+	index := make(map[string]int, baseLength)
+	for i := 0; i < baseLength; i++ {
+		if key, ok := elementKey(base.Elem(i), opts.Key); ok {
+			index[key] = i
+		}
+	}
+	overlayLength, _ := overlay.Len()
+	for i := 0; i < overlayLength; i++ {
+		elem := overlay.Elem(i)
+		if key, ok := elementKey(elem, opts.Key); ok {
+			if j, found := index[key]; found {
+				base.Replace(j, merge(base.Elem(j), elem, opts))
+				continue
+			}
+			index[key] = baseLength
+		}
+		base.Append(elem)
+		baseLength++
+	}
+	return base
+}
+
+// Elements are matched by the JSON text of their key member.
+func elementKey(v *tree.Value, key string) (string, bool) {
+	if v.Type() != jog.TypeObject || v.Member(key) == nil {
+		return "", false
+	}
+	s, err := v.Member(key).Stringify()
+	return s, err == nil
+}
+
+// Remove null members from nested objects, arrays are kept as they are.
+func dropNulls(v *tree.Value) {
+	if v.Type() != jog.TypeObject {
+		return
+	}
+	for _, k := range append([]string(nil), v.Keys()...) {
+		if v.Member(k).Type() == jog.TypeNull {
+			v.Delete(k)
+		} else {
+			dropNulls(v.Member(k))
+		}
+	}
+}
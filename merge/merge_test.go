@@ -0,0 +1,92 @@
+package merge
+
+import (
+	"testing"
+
+	"github.com/anantn/jog"
+	"github.com/anantn/jog/rapid"
+	"github.com/anantn/jog/yajl"
+)
+
+var parsers = map[string]func(string) (jog.Value, error){
+	"rapid": rapid.New,
+	"yajl":  yajl.New,
+}
+
+func parseAll(t *testing.T, parse func(string) (jog.Value, error), docs ...string) []jog.Value {
+	values := make([]jog.Value, len(docs))
+	for i, doc := range docs {
+		v, err := parse(doc)
+		if err != nil {
+			t.Fatalf("Couldn't parse %s: %v\n", doc, err)
+		}
+		values[i] = v
+	}
+	return values
+}
+
+// Test cases from RFC 7386, Appendix A.
+func TestMergePatch(t *testing.T) {
+	cases := [][3]string{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+	for name, parse := range parsers {
+		for _, test := range cases {
+			docs := parseAll(t, parse, test[0], test[1])
+			res, err := MergePatch(docs[0], docs[1])
+			if err != nil {
+				t.Fatalf("[%s] Couldn't merge: %v\n", name, err)
+			}
+			if got, _ := res.Stringify(); got != test[2] {
+				t.Fatalf("[%s] Expected %s, got %s\n", name, test[2], got)
+			}
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	defaults := `{"db":{"host":"localhost","port":5432},"features":["a"],"users":[{"id":1,"role":"admin"},{"id":2,"role":"user"}],"debug":false}`
+	env := `{"db":{"host":"db.internal"},"features":["b"],"debug":null}`
+	tenant := `{"users":[{"id":2,"role":"admin"},{"id":3,"role":"user"}],"db":{"port":6432}}`
+	cases := []struct {
+		opts   Options
+		result string
+	}{
+		{Options{}, `{"db":{"host":"db.internal","port":6432},"features":["b"],"users":[{"id":2,"role":"admin"},{"id":3,"role":"user"}],"debug":null}`},
+		{Options{Arrays: ArrayConcat}, `{"db":{"host":"db.internal","port":6432},"features":["a","b"],"users":[{"id":1,"role":"admin"},{"id":2,"role":"user"},{"id":2,"role":"admin"},{"id":3,"role":"user"}],"debug":null}`},
+		{Options{Arrays: ArrayMergeByKey, Key: "id", NullDeletes: true}, `{"db":{"host":"db.internal","port":6432},"features":["a","b"],"users":[{"id":1,"role":"admin"},{"id":2,"role":"admin"},{"id":3,"role":"user"}]}`},
+	}
+	for name, parse := range parsers {
+		layers := parseAll(t, parse, defaults, env, tenant)
+		for _, test := range cases {
+			res, err := Merge(test.opts, layers...)
+			if err != nil {
+				t.Fatalf("[%s] Couldn't merge: %v\n", name, err)
+			}
+			if got, _ := res.Stringify(); got != test.result {
+				t.Fatalf("[%s] Expected %s, got %s\n", name, test.result, got)
+			}
+		}
+		// The layers are not modified.
+		if got, _ := layers[0].Stringify(); got != defaults {
+			t.Fatalf("[%s] Base layer changed to %s\n", name, got)
+		}
+		if _, err := Merge(Options{Arrays: ArrayMergeByKey}, layers...); err == nil {
+			t.Fatalf("[%s] Expected ArrayMergeByKey without a Key to fail\n", name)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package jog
+
+import "fmt"
+
+// Options control how a backend parses a document. The zero value parses
+// UTF-8 like New.
+type Options struct {
+	// Encoding of the input. Values are always returned as UTF-8.
+	Encoding Encoding
+	// Limits on the resources the document may use.
+	Limits Limits
+	// Only validate the document while parsing, and parse a subtree when a
+	// getter first needs its contents. Reading a few fields of a large
+	// document gets much cheaper, reading all of it gets dearer. The limits
+	// apply to the validation; MaxMemory does not cover the subtrees.
+	Lazy bool
+}
+
+// Limits bound the resources a parse may use, so untrusted input is rejected
+// before it exhausts memory. A zero field is not limited. Both backends
+// parse without recursion, so even unlimited nesting cannot overflow the
+// stack while parsing. rapid serializes without recursion as well, while
+// yajl's generator writes no deeper than yajl.MaxDepth: a deeper document
+// parses, but fails to Stringify on yajl.
+type Limits struct {
+	// Bytes of input, before it is transcoded.
+	MaxSize int
+	// Arrays and objects nested in each other. A scalar document has depth
+	// 0, and [[]] has depth 2.
+	MaxDepth int
+	// Bytes of a single string or key, after unescaping.
+	MaxStringLength int
+	// Members of a single object or elements of a single array.
+	MaxMembers int
+	// Bytes of native memory the parse may allocate. Memory a Parser kept
+	// from earlier documents may be reused without being counted again.
+	MaxMemory int
+}
+
+// Limit names a field of Limits. The values are shared with the C parsers.
+type Limit int
+
+const (
+	LimitSize Limit = iota + 1
+	LimitDepth
+	LimitStringLength
+	LimitMembers
+	LimitMemory
+)
+
+func (l Limit) String() string {
+	switch l {
+	case LimitSize:
+		return "MaxSize"
+	case LimitDepth:
+		return "MaxDepth"
+	case LimitStringLength:
+		return "MaxStringLength"
+	case LimitMembers:
+		return "MaxMembers"
+	case LimitMemory:
+		return "MaxMemory"
+	}
+	return "unknown"
+}
+
+// Get returns the value of the limit in l.
+func (l Limits) Get(limit Limit) int {
+	switch limit {
+	case LimitSize:
+		return l.MaxSize
+	case LimitDepth:
+		return l.MaxDepth
+	case LimitStringLength:
+		return l.MaxStringLength
+	case LimitMembers:
+		return l.MaxMembers
+	case LimitMemory:
+		return l.MaxMemory
+	}
+	return 0
+}
+
+// CheckSize returns a *LimitError if an input of size bytes exceeds
+// MaxSize.
+func (l Limits) CheckSize(size int) error {
+	if l.MaxSize > 0 && size > l.MaxSize {
+		return &LimitError{LimitSize, l.MaxSize, l.MaxSize}
+	}
+	return nil
+}
+
+// LimitError is returned when a document exceeds one of its Limits. Offset
+// is the byte offset at which the parse stopped. For input that was
+// transcoded to UTF-8 before parsing it counts bytes of the transcoded text.
+type LimitError struct {
+	Limit  Limit
+	Max    int
+	Offset int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("[%d] Exceeded the %s limit of %d.", e.Offset, e.Limit, e.Max)
+}
+
+// WriterOptions control how an Encoder escapes strings. The zero value only
+// escapes what JSON requires. Both backends produce the same escapes.
+type WriterOptions struct {
+	// Escape every non-ASCII character as \uXXXX, with a surrogate pair
+	// beyond the Basic Multilingual Plane. Implies ValidateUTF8.
+	ASCII bool
+	// Escape <, > and & as \u003c, \u003e and \u0026 like encoding/json, so
+	// the output can be embedded in an HTML <script> element.
+	HTMLSafe bool
+	// Escape / as \/.
+	EscapeSolidus bool
+	// Reject keys and strings that are not valid UTF-8.
+	ValidateUTF8 bool
+}
@@ -0,0 +1,35 @@
+package jog
+
+import "sync"
+
+// Parser parses documents one after another, reusing its native memory. A
+// document returned by Parse is only valid until the next call to Parse or
+// Reset. Parsers are not safe for concurrent use; keep one per goroutine or
+// share them through a ParserPool.
+type Parser interface {
+	Parse(data []byte) (Value, error)
+	// Reset releases the last document, keeping its memory for the next.
+	Reset()
+}
+
+// ParserPool shares Parsers between goroutines.
+type ParserPool struct {
+	pool sync.Pool
+}
+
+// Create a pool that makes Parsers with newParser when it runs out.
+func NewParserPool(newParser func() Parser) *ParserPool {
+	return &ParserPool{sync.Pool{New: func() any { return newParser() }}}
+}
+
+// Get a Parser from the pool, or a new one.
+func (p *ParserPool) Get() Parser {
+	return p.pool.Get().(Parser)
+}
+
+// Reset parser and return it to the pool. Documents it parsed must no longer
+// be used.
+func (p *ParserPool) Put(parser Parser) {
+	parser.Reset()
+	p.pool.Put(parser)
+}
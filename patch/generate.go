@@ -0,0 +1,136 @@
+package patch
+
+import (
+	"strconv"
+
+	"github.com/anantn/jog"
+	"github.com/anantn/jog/tree"
+)
+
+// Arrays longer than this on both sides are compared position by position
+// instead of with a longest common subsequence.
+const maxLCSCells = 1 << 20
+
+// Generate a patch document that turns from into to.
+func Generate(from jog.Value, to jog.Value) (*tree.Value, error) {
+	ops, err := Diff(from, to)
+	if err != nil {
+		return nil, err
+	}
+	return Encode(ops)
+}
+
+// Diff returns the operations that turn from into to. Objects are compared
+// member by member and arrays by their longest common subsequence, so
+// unchanged elements are never rewritten.
+func Diff(from jog.Value, to jog.Value) ([]Operation, error) {
+	a, err := tree.Copy(from)
+	if err != nil {
+		return nil, err
+	}
+	b, err := tree.Copy(to)
+	if err != nil {
+		return nil, err
+	}
+	ops := []Operation{}
+	diff(a, b, "", &ops)
+	return ops, nil
+}
+
+func diff(a *tree.Value, b *tree.Value, path string, ops *[]Operation) {
+	if jog.Equal(a, b) {
+		return
+	}
+	if a.Type() == jog.TypeObject && b.Type() == jog.TypeObject {
+		for _, k := range a.Keys() {
+			if b.Member(k) == nil {
+				*ops = append(*ops, Operation{Op: "remove", Path: path + "/" + escape(k)})
+			}
+		}
+		for _, k := range b.Keys() {
+			if old := a.Member(k); old != nil {
+				diff(old, b.Member(k), path+"/"+escape(k), ops)
+			} else {
+				*ops = append(*ops, Operation{Op: "add", Path: path + "/" + escape(k), Value: b.Member(k)})
+			}
+		}
+		return
+	}
+	if a.Type() == jog.TypeArray && b.Type() == jog.TypeArray {
+		diffArray(a, b, path, ops)
+		return
+	}
+	*ops = append(*ops, Operation{Op: "replace", Path: path, Value: b})
+}
+
+func diffArray(a *tree.Value, b *tree.Value, path string, ops *[]Operation) {
+	// Skip the common prefix and suffix.
+	endA, _ := a.Len()
+	endB, _ := b.Len()
+	start := 0
+	for start < endA && start < endB && jog.Equal(a.Elem(start), b.Elem(start)) {
+		start++
+	}
+	for endA > start && endB > start && jog.Equal(a.Elem(endA-1), b.Elem(endB-1)) {
+		endA--
+		endB--
+	}
+	n, m := endA-start, endB-start
+
+	elemPath := func(i int) string {
+		return path + "/" + strconv.Itoa(i)
+	}
+	if n*m > maxLCSCells {
+		for i := 0; i < n && i < m; i++ {
+			diff(a.Elem(start+i), b.Elem(start+i), elemPath(start+i), ops)
+		}
+		for i := n - 1; i >= m; i-- {
+			*ops = append(*ops, Operation{Op: "remove", Path: elemPath(start + i)})
+		}
+		for i := n; i < m; i++ {
+			*ops = append(*ops, Operation{Op: "add", Path: elemPath(start + i), Value: b.Elem(start + i)})
+		}
+		return
+	}
+
+	// lcs[i][j] is the length of the LCS of a[start+i:endA] and b[start+j:endB].
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if jog.Equal(a.Elem(start+i), b.Elem(start+j)) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	// Walk the table, idx is the position in the array being patched. An
+	// element that changed in place becomes a nested diff.
+	i, j, idx := 0, 0, start
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && jog.Equal(a.Elem(start+i), b.Elem(start+j)):
+			i++
+			j++
+			idx++
+		case i < n && j < m && lcs[i+1][j+1] == lcs[i][j]:
+			diff(a.Elem(start+i), b.Elem(start+j), elemPath(idx), ops)
+			i++
+			j++
+			idx++
+		case i < n && (j == m || lcs[i+1][j] >= lcs[i][j+1]):
+			*ops = append(*ops, Operation{Op: "remove", Path: elemPath(idx)})
+			i++
+		default:
+			*ops = append(*ops, Operation{Op: "add", Path: elemPath(idx), Value: b.Elem(start + j)})
+			j++
+			idx++
+		}
+	}
+}
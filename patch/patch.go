@@ -0,0 +1,315 @@
+// Package patch applies and generates JSON Patch documents (RFC 6902).
+//
+// Documents and patches can come from any jog backend. Applying a patch
+// never modifies its input, the result is a new *tree.Value.
+package patch
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/anantn/jog"
+	"github.com/anantn/jog/tree"
+)
+
+// Operation is a single JSON Patch operation.
+type Operation struct {
+	Op    string
+	Path  string
+	From  string
+	Value jog.Value
+}
+
+// Error reports the operation that could not be applied.
+type Error struct {
+	// Index of the operation in the patch.
+	Index int
+	Op    string
+	Path  string
+	Err   error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("Could not apply operation %d (%s %s): %v", e.Index, e.Op, e.Path, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// ErrTestFailed is wrapped by the Error returned when a "test" fails.
+var ErrTestFailed = errors.New("Test operation failed")
+
+// Apply a patch document to doc. Either every operation succeeds or an
+// *Error is returned and nothing is changed.
+func Apply(doc jog.Value, patch jog.Value) (jog.Value, error) {
+	ops, err := Decode(patch)
+	if err != nil {
+		return nil, err
+	}
+	return ApplyOperations(doc, ops)
+}
+
+// ApplyOperations is Apply for already decoded operations.
+func ApplyOperations(doc jog.Value, ops []Operation) (*tree.Value, error) {
+	root, err := tree.Copy(doc)
+	if err != nil {
+		return nil, err
+	}
+	for i, op := range ops {
+		root, err = apply(root, op)
+		if err != nil {
+			return nil, &Error{i, op.Op, op.Path, err}
+		}
+	}
+	return root, nil
+}
+
+// Decode a patch document into operations.
+func Decode(patch jog.Value) ([]Operation, error) {
+	elems, err := patch.GetArray()
+	if err != nil {
+		return nil, errors.New("A JSON Patch must be an array of operations")
+	}
+	ops := make([]Operation, len(elems))
+	for i, elem := range elems {
+		op := &ops[i]
+		if op.Op, err = elem.GetString("op"); err != nil {
+			return nil, fmt.Errorf("Operation %d has no \"op\"", i)
+		}
+		if op.Path, err = elem.GetString("path"); err != nil {
+			return nil, fmt.Errorf("Operation %d has no \"path\"", i)
+		}
+		switch op.Op {
+		case "add", "replace", "test":
+			if op.Value, err = elem.Get("value"); err != nil {
+				return nil, fmt.Errorf("Operation %d (%s) has no \"value\"", i, op.Op)
+			}
+		case "move", "copy":
+			if op.From, err = elem.GetString("from"); err != nil {
+				return nil, fmt.Errorf("Operation %d (%s) has no \"from\"", i, op.Op)
+			}
+		case "remove":
+		default:
+			return nil, fmt.Errorf("Operation %d has unknown op %q", i, op.Op)
+		}
+	}
+	return ops, nil
+}
+
+// Encode operations as a patch document.
+func Encode(ops []Operation) (*tree.Value, error) {
+	doc := tree.Array()
+	for _, op := range ops {
+		obj := tree.Object()
+		obj.Set("op", tree.String(op.Op))
+		if op.Op == "move" || op.Op == "copy" {
+			obj.Set("from", tree.String(op.From))
+		}
+		obj.Set("path", tree.String(op.Path))
+		if op.Value != nil {
+			val, err := tree.Copy(op.Value)
+			if err != nil {
+				return nil, err
+			}
+			obj.Set("value", val)
+		}
+		doc.Append(obj)
+	}
+	return doc, nil
+}
+
+// Apply one operation. The root is returned since operations on "" replace
+// the whole document.
+func apply(root *tree.Value, op Operation) (*tree.Value, error) {
+	switch op.Op {
+	case "add":
+		val, err := tree.Copy(op.Value)
+		if err != nil {
+			return nil, err
+		}
+		return add(root, op.Path, val)
+	case "remove":
+		_, err := remove(root, op.Path)
+		return root, err
+	case "replace":
+		val, err := tree.Copy(op.Value)
+		if err != nil {
+			return nil, err
+		}
+		return replace(root, op.Path, val)
+	case "move":
+		if op.Path == op.From {
+			_, err := find(root, op.From)
+			return root, err
+		}
+		if strings.HasPrefix(op.Path, op.From+"/") {
+			return nil, errors.New("Cannot move a value into one of its children")
+		}
+		val, err := remove(root, op.From)
+		if err != nil {
+			return nil, err
+		}
+		return add(root, op.Path, val)
+	case "copy":
+		val, err := find(root, op.From)
+		if err != nil {
+			return nil, err
+		}
+		return add(root, op.Path, val.Clone())
+	case "test":
+		val, err := find(root, op.Path)
+		if err != nil {
+			return nil, err
+		}
+		if !jog.Equal(val, op.Value) {
+			return nil, ErrTestFailed
+		}
+		return root, nil
+	}
+	return nil, fmt.Errorf("Unknown op %q", op.Op)
+}
+
+func add(root *tree.Value, path string, val *tree.Value) (*tree.Value, error) {
+	if path == "" {
+		return val, nil
+	}
+	parent, last, err := findParent(root, path)
+	if err != nil {
+		return nil, err
+	}
+	switch parent.Type() {
+	case jog.TypeObject:
+		return root, parent.Set(last, val)
+	case jog.TypeArray:
+		if last == "-" {
+			return root, parent.Append(val)
+		}
+		length, _ := parent.Len()
+		i, err := index(last, length+1)
+		if err != nil {
+			return nil, err
+		}
+		return root, parent.Insert(i, val)
+	}
+	return nil, fmt.Errorf("Cannot add a child to a scalar at %q", path)
+}
+
+func replace(root *tree.Value, path string, val *tree.Value) (*tree.Value, error) {
+	if path == "" {
+		return val, nil
+	}
+	parent, last, err := findParent(root, path)
+	if err != nil {
+		return nil, err
+	}
+	switch parent.Type() {
+	case jog.TypeObject:
+		if parent.Member(last) == nil {
+			return nil, fmt.Errorf("Could not find %q", path)
+		}
+		return root, parent.Set(last, val)
+	case jog.TypeArray:
+		length, _ := parent.Len()
+		i, err := index(last, length)
+		if err != nil {
+			return nil, err
+		}
+		return root, parent.Replace(i, val)
+	}
+	return nil, fmt.Errorf("Could not find %q", path)
+}
+
+func remove(root *tree.Value, path string) (*tree.Value, error) {
+	if path == "" {
+		return nil, errors.New("Cannot remove the root")
+	}
+	parent, last, err := findParent(root, path)
+	if err != nil {
+		return nil, err
+	}
+	switch parent.Type() {
+	case jog.TypeObject:
+		val := parent.Member(last)
+		return val, parent.Delete(last)
+	case jog.TypeArray:
+		length, _ := parent.Len()
+		i, err := index(last, length)
+		if err != nil {
+			return nil, err
+		}
+		val := parent.Elem(i)
+		return val, parent.Remove(i)
+	}
+	return nil, fmt.Errorf("Could not find %q", path)
+}
+
+func findParent(root *tree.Value, path string) (*tree.Value, string, error) {
+	i := strings.LastIndexByte(path, '/')
+	if i < 0 {
+		return nil, "", fmt.Errorf("Invalid JSON pointer %q", path)
+	}
+	parent, err := find(root, path[:i])
+	if err != nil {
+		return nil, "", err
+	}
+	return parent, unescape(path[i+1:]), nil
+}
+
+// Resolve a JSON Pointer (RFC 6901) in a tree.
+func find(root *tree.Value, path string) (*tree.Value, error) {
+	if path == "" {
+		return root, nil
+	}
+	if path[0] != '/' {
+		return nil, fmt.Errorf("Invalid JSON pointer %q", path)
+	}
+	n := root
+	for _, token := range strings.Split(path[1:], "/") {
+		token = unescape(token)
+		switch n.Type() {
+		case jog.TypeObject:
+			n = n.Member(token)
+		case jog.TypeArray:
+			length, _ := n.Len()
+			i, err := index(token, length)
+			if err != nil {
+				return nil, err
+			}
+			n = n.Elem(i)
+		default:
+			n = nil
+		}
+		if n == nil {
+			return nil, fmt.Errorf("Could not find %q", path)
+		}
+	}
+	return n, nil
+}
+
+// Parse an array index, which must be below max and have no leading zeros.
+func index(token string, max int) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("Invalid array index %q", token)
+	}
+	for _, c := range token {
+		if c < '0' || c > '9' {
+			return 0, fmt.Errorf("Invalid array index %q", token)
+		}
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i >= max {
+		return 0, fmt.Errorf("Array index %s out of range", token)
+	}
+	return i, nil
+}
+
+func escape(s string) string {
+	return strings.Replace(strings.Replace(s, "~", "~0", -1), "/", "~1", -1)
+}
+
+func unescape(s string) string {
+	return strings.Replace(strings.Replace(s, "~1", "/", -1), "~0", "~", -1)
+}
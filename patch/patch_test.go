@@ -0,0 +1,136 @@
+package patch
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/anantn/jog"
+	"github.com/anantn/jog/rapid"
+	"github.com/anantn/jog/yajl"
+)
+
+var parsers = map[string]func(string) (jog.Value, error){
+	"rapid": rapid.New,
+	"yajl":  yajl.New,
+}
+
+type PatchCase struct {
+	doc    string
+	patch  string
+	result string
+}
+
+func DoPatchTests(t *testing.T, cases []PatchCase) {
+	for name, parse := range parsers {
+		for _, test := range cases {
+			doc, err := parse(test.doc)
+			if err != nil {
+				t.Fatalf("[%s] Couldn't parse %s: %v\n", name, test.doc, err)
+			}
+			p, err := parse(test.patch)
+			if err != nil {
+				t.Fatalf("[%s] Couldn't parse %s: %v\n", name, test.patch, err)
+			}
+			res, err := Apply(doc, p)
+			if err != nil {
+				t.Fatalf("[%s] Couldn't apply %s: %v\n", name, test.patch, err)
+			}
+			got, _ := res.Stringify()
+			if got != test.result {
+				t.Fatalf("[%s] Expected %s, got %s\n", name, test.result, got)
+			}
+			// The input document is never modified.
+			if orig, _ := doc.Stringify(); orig != test.doc {
+				t.Fatalf("[%s] Input document changed to %s\n", name, orig)
+			}
+		}
+	}
+}
+
+func TestOperations(t *testing.T) {
+	DoPatchTests(t, []PatchCase{
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"foo":"bar","baz":"qux"}`},
+		{`{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`},
+		{`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`, `{"foo":["bar",["abc","def"]]}`},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`},
+		{`{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`},
+		{`{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`},
+		{`{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`},
+		{`{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"test","path":"/c/b","value":1.0}]`, `{"a":{"b":1},"c":{"b":1}}`},
+		{`{"/":{"~":1}}`, `[{"op":"replace","path":"/~1/~0","value":2}]`, `{"/":{"~":2}}`},
+		{`{"a":1}`, `[{"op":"replace","path":"","value":[1,2]}]`, `[1,2]`},
+	})
+}
+
+func TestFailures(t *testing.T) {
+	cases := [][2]string{
+		{`{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"bar"}]`},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`},
+		{`{"foo":[1]}`, `[{"op":"add","path":"/foo/2","value":2}]`},
+		{`{"foo":[1]}`, `[{"op":"remove","path":"/foo/01"}]`},
+		{`{"foo":1}`, `[{"op":"replace","path":"/bar","value":2}]`},
+		{`{"a":{"b":1}}`, `[{"op":"move","from":"/a","path":"/a/b"}]`},
+		{`{"a":1}`, `[{"op":"add","path":"/b","value":1},{"op":"frob","path":"/a"}]`},
+		{`{"a":1}`, `{"op":"remove","path":"/a"}`},
+	}
+	for name, parse := range parsers {
+		for _, test := range cases {
+			doc, _ := parse(test[0])
+			p, _ := parse(test[1])
+			if _, err := Apply(doc, p); err == nil {
+				t.Fatalf("[%s] Expected %s to fail on %s\n", name, test[1], test[0])
+			}
+		}
+		doc, _ := parse(`{"baz":"qux"}`)
+		p, _ := parse(`[{"op":"remove","path":"/baz"},{"op":"test","path":"/baz","value":"qux"}]`)
+		_, err := Apply(doc, p)
+		var perr *Error
+		if !errors.As(err, &perr) || perr.Index != 1 {
+			t.Fatalf("[%s] Expected a failure at operation 1, got %v\n", name, err)
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	cases := []struct {
+		from string
+		to   string
+		ops  int
+	}{
+		{`{"a":1,"b":[1,2,3],"c":{"d":true}}`, `{"a":1,"b":[1,2,3],"c":{"d":true}}`, 0},
+		{`{"a":1,"b":2}`, `{"a":1,"c":2}`, 2},
+		{`{"a":{"b":{"c":1,"d":2}}}`, `{"a":{"b":{"c":1,"d":3}}}`, 1},
+		{`[1,2,3,4,5]`, `[1,2,9,3,4,5]`, 1},
+		{`[1,2,3,4,5]`, `[1,3,4,5]`, 1},
+		{`[{"id":1,"v":"a"},{"id":2,"v":"b"}]`, `[{"id":1,"v":"a"},{"id":2,"v":"c"}]`, 1},
+		{`["a","b","c"]`, `["x","b","y","z"]`, 3},
+		{`{"a":[1]}`, `{"a":"x"}`, 1},
+		{`1`, `2.5`, 1},
+	}
+	for name, parse := range parsers {
+		for _, test := range cases {
+			from, _ := parse(test.from)
+			to, _ := parse(test.to)
+			ops, err := Diff(from, to)
+			if err != nil {
+				t.Fatalf("[%s] Couldn't diff: %v\n", name, err)
+			}
+			if len(ops) != test.ops {
+				t.Fatalf("[%s] Expected %d operations from %s to %s, got %d\n", name, test.ops, test.from, test.to, len(ops))
+			}
+			p, err := Generate(from, to)
+			if err != nil {
+				t.Fatalf("[%s] Couldn't generate: %v\n", name, err)
+			}
+			res, err := Apply(from, p)
+			if err != nil {
+				t.Fatalf("[%s] Couldn't apply generated patch: %v\n", name, err)
+			}
+			if !jog.Equal(res, to) {
+				got, _ := res.Stringify()
+				t.Fatalf("[%s] Expected %s, got %s\n", name, test.to, got)
+			}
+		}
+	}
+}
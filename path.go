@@ -0,0 +1,275 @@
+package jog
+
+import (
+	"iter"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Path is a list of object keys prepared for looking up many times. Each
+// backend converts the keys on first use and keeps the result, so a lookup
+// through Value.At costs no conversions. Paths are safe for concurrent use.
+type Path struct {
+	segments []string
+	// The forms of the path made so far. There are only ever a few, so the
+	// list is replaced as a whole when one is added.
+	compiled atomic.Pointer[[]compiledPath]
+	mu       sync.Mutex
+}
+
+type compiledPath struct {
+	backend string
+	path    any
+}
+
+// Compile the path through the given keys. An empty path refers to the value
+// it is looked up on.
+func CompilePath(segments ...string) *Path {
+	return &Path{segments: slices.Clone(segments)}
+}
+
+// Segments returns the keys of the path. The slice is shared and must not be
+// modified.
+func (p *Path) Segments() []string {
+	return p.segments
+}
+
+func (p *Path) String() string {
+	return strings.Join(p.segments, "/")
+}
+
+// Compiled returns the form backend keeps of the path, making it with compile
+// on first use.
+func (p *Path) Compiled(backend string, compile func(segments []string) any) any {
+	if c, ok := p.lookup(backend); ok {
+		return c
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if c, ok := p.lookup(backend); ok {
+		return c
+	}
+	c := compile(p.segments)
+	var compiled []compiledPath
+	if old := p.compiled.Load(); old != nil {
+		compiled = append(compiled, *old...)
+	}
+	compiled = append(compiled, compiledPath{backend, c})
+	p.compiled.Store(&compiled)
+	return c
+}
+
+// Data Getters. They mirror those of Value, with the path looked up on v.
+func (p *Path) Get(v Value) (Value, error) {
+	return v.At(p)
+}
+
+func (p *Path) GetInt(v Value) (int, error) {
+	n, err := p.at(v, "int")
+	if err != nil {
+		return 0, err
+	}
+	r, err := n.GetInt()
+	return r, PrefixError(err, p.segments)
+}
+
+func (p *Path) GetUInt(v Value) (uint, error) {
+	n, err := p.at(v, "uint")
+	if err != nil {
+		return 0, err
+	}
+	r, err := n.GetUInt()
+	return r, PrefixError(err, p.segments)
+}
+
+func (p *Path) GetFloat(v Value) (float64, error) {
+	n, err := p.at(v, "float")
+	if err != nil {
+		return 0, err
+	}
+	r, err := n.GetFloat()
+	return r, PrefixError(err, p.segments)
+}
+
+func (p *Path) NumberKind(v Value) (NumberKind, error) {
+	n, err := p.at(v, "number")
+	if err != nil {
+		return 0, err
+	}
+	r, err := n.NumberKind()
+	return r, PrefixError(err, p.segments)
+}
+
+func (p *Path) GetBool(v Value) (bool, error) {
+	n, err := p.at(v, "bool")
+	if err != nil {
+		return false, err
+	}
+	r, err := n.GetBool()
+	return r, PrefixError(err, p.segments)
+}
+
+func (p *Path) GetString(v Value) (string, error) {
+	n, err := p.at(v, "string")
+	if err != nil {
+		return "", err
+	}
+	r, err := n.GetString()
+	return r, PrefixError(err, p.segments)
+}
+
+func (p *Path) GetArray(v Value) ([]Value, error) {
+	n, err := p.at(v, "array")
+	if err != nil {
+		return nil, err
+	}
+	r, err := n.GetArray()
+	return r, PrefixError(err, p.segments)
+}
+
+func (p *Path) GetObject(v Value) (map[string]Value, error) {
+	n, err := p.at(v, "object")
+	if err != nil {
+		return nil, err
+	}
+	r, err := n.GetObject()
+	return r, PrefixError(err, p.segments)
+}
+
+func (p *Path) Len(v Value) (int, error) {
+	n, err := p.at(v, "array or object")
+	if err != nil {
+		return 0, err
+	}
+	r, err := n.Len()
+	return r, PrefixError(err, p.segments)
+}
+
+func (p *Path) Index(v Value, i int) (Value, error) {
+	n, err := p.at(v, "array")
+	if err != nil {
+		return nil, err
+	}
+	r, err := n.Index(i)
+	return r, PrefixError(err, p.segments)
+}
+
+func (p *Path) IndexInt(v Value, i int) (int, error) {
+	n, err := p.at(v, "array")
+	if err != nil {
+		return 0, err
+	}
+	r, err := n.IndexInt(i)
+	return r, PrefixError(err, p.segments)
+}
+
+func (p *Path) IndexUInt(v Value, i int) (uint, error) {
+	n, err := p.at(v, "array")
+	if err != nil {
+		return 0, err
+	}
+	r, err := n.IndexUInt(i)
+	return r, PrefixError(err, p.segments)
+}
+
+func (p *Path) IndexFloat(v Value, i int) (float64, error) {
+	n, err := p.at(v, "array")
+	if err != nil {
+		return 0, err
+	}
+	r, err := n.IndexFloat(i)
+	return r, PrefixError(err, p.segments)
+}
+
+func (p *Path) IndexBool(v Value, i int) (bool, error) {
+	n, err := p.at(v, "array")
+	if err != nil {
+		return false, err
+	}
+	r, err := n.IndexBool(i)
+	return r, PrefixError(err, p.segments)
+}
+
+func (p *Path) IndexString(v Value, i int) (string, error) {
+	n, err := p.at(v, "array")
+	if err != nil {
+		return "", err
+	}
+	r, err := n.IndexString(i)
+	return r, PrefixError(err, p.segments)
+}
+
+func (p *Path) Elements(v Value) iter.Seq2[int, Value] {
+	return func(yield func(int, Value) bool) {
+		if n, err := v.At(p); err == nil {
+			n.Elements()(yield)
+		}
+	}
+}
+
+func (p *Path) ArrayIterator(v Value) (ArrayIterator, error) {
+	n, err := p.at(v, "array")
+	if err != nil {
+		return nil, err
+	}
+	r, err := n.ArrayIterator()
+	return r, PrefixError(err, p.segments)
+}
+
+func (p *Path) ObjectIterator(v Value) (ObjectIterator, error) {
+	n, err := p.at(v, "object")
+	if err != nil {
+		return nil, err
+	}
+	r, err := n.ObjectIterator()
+	return r, PrefixError(err, p.segments)
+}
+
+func (p *Path) Type(v Value) Type {
+	n, err := v.At(p)
+	if err != nil {
+		return TypeMissing
+	}
+	return n.Type()
+}
+
+func (p *Path) Exists(v Value) bool {
+	return p.Type(v) != TypeMissing
+}
+
+func (p *Path) IsNull(v Value) bool {
+	return p.Type(v) == TypeNull
+}
+
+func (p *Path) Stringify(v Value) (string, error) {
+	n, err := v.At(p)
+	if err != nil {
+		return "", err
+	}
+	r, err := n.Stringify()
+	return r, PrefixError(err, p.segments)
+}
+
+// Private methods.
+
+// At for a getter asking for expected.
+func (p *Path) at(v Value, expected string) (Value, error) {
+	n, err := v.At(p)
+	if err != nil {
+		return nil, expectError(err, expected)
+	}
+	return n, nil
+}
+
+func (p *Path) lookup(backend string) (any, bool) {
+	if compiled := p.compiled.Load(); compiled != nil {
+		for _, c := range *compiled {
+			if c.backend == backend {
+				return c.path, true
+			}
+		}
+	}
+	return nil, false
+}
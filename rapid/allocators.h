@@ -61,6 +61,18 @@ concept Allocator {
 ///////////////////////////////////////////////////////////////////////////////
 // CrtAllocator
 
+// The C runtime functions used by CrtAllocator, which can be defined before
+// including rapidjson to route every allocation elsewhere.
+#ifndef RAPIDJSON_MALLOC
+#define RAPIDJSON_MALLOC(size) std::malloc(size)
+#endif
+#ifndef RAPIDJSON_REALLOC
+#define RAPIDJSON_REALLOC(ptr, new_size) std::realloc(ptr, new_size)
+#endif
+#ifndef RAPIDJSON_FREE
+#define RAPIDJSON_FREE(ptr) std::free(ptr)
+#endif
+
 //! C-runtime library allocator.
 /*! This class is just wrapper for standard C library memory routines.
     \note implements Allocator concept
@@ -68,9 +80,9 @@ concept Allocator {
 class CrtAllocator {
 public:
     static const bool kNeedFree = true;
-    void* Malloc(size_t size) { return std::malloc(size); }
-    void* Realloc(void* originalPtr, size_t originalSize, size_t newSize) { (void)originalSize; return std::realloc(originalPtr, newSize); }
-    static void Free(void *ptr) { std::free(ptr); }
+    void* Malloc(size_t size) { return RAPIDJSON_MALLOC(size); }
+    void* Realloc(void* originalPtr, size_t originalSize, size_t newSize) { (void)originalSize; return RAPIDJSON_REALLOC(originalPtr, newSize); }
+    static void Free(void *ptr) { RAPIDJSON_FREE(ptr); }
 };
 
 ///////////////////////////////////////////////////////////////////////////////
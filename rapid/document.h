@@ -1708,6 +1708,29 @@ public:
         return *this;
     }
 
+    //! Parse JSON text from an input stream through another handler
+    /*! \tparam parseFlags Combination of \ref ParseFlag.
+        \tparam SourceEncoding Encoding of input stream
+        \tparam InputStream Type of input stream, implementing Stream concept
+        \tparam Handler Type of handler, which must forward every event to this
+            document's handler functions or stop the parse by returning false.
+        \param is Input stream to be parsed.
+        \param handler Handler receiving the events of the reader.
+        \return The document itself for fluent API.
+    */
+    template <unsigned parseFlags, typename SourceEncoding, typename InputStream, typename Handler>
+    GenericDocument& ParseStream(InputStream& is, Handler& handler) {
+        ValueType::SetNull(); // Remove existing root if exist
+        GenericReader<SourceEncoding, Encoding, Allocator> reader(&GetAllocator());
+        ClearStackOnExit scope(*this);
+        parseResult_ = reader.template Parse<parseFlags>(is, handler);
+        if (parseResult_) {
+            RAPIDJSON_ASSERT(stack_.GetSize() == sizeof(ValueType)); // Got one and only one root object
+            this->RawAssign(*stack_.template Pop<ValueType>(1));    // Add this-> to prevent issue 13.
+        }
+        return *this;
+    }
+
     //! Parse JSON text from an input stream
     /*! \tparam parseFlags Combination of \ref ParseFlag.
         \tparam InputStream Type of input stream, implementing Stream concept
@@ -1831,7 +1854,9 @@ private:
     template <typename,typename,typename> friend class GenericReader; // for parsing
     template <typename, typename> friend class GenericValue; // for deep copying
 
-    // Implementation of Handler
+public:
+    // Implementation of Handler, public so that a handler passed to
+    // ParseStream(is, handler) can forward its events here.
     bool Null() { new (stack_.template Push<ValueType>()) ValueType(); return true; }
     bool Bool(bool b) { new (stack_.template Push<ValueType>()) ValueType(b); return true; }
     bool Int(int i) { new (stack_.template Push<ValueType>()) ValueType(i); return true; }
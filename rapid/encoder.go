@@ -0,0 +1,270 @@
+package rapid
+
+// #include <stdint.h>
+// #include <stdbool.h>
+// #include <stdlib.h>
+// #include "rapid.h"
+import "C"
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"runtime"
+	"runtime/cgo"
+	"unicode/utf8"
+	"unsafe"
+
+	"github.com/anantn/jog"
+)
+
+// The output stream writes into a sink rather than the encoder itself, so
+// the cgo handle does not keep the encoder reachable and its finalizer can
+// still run.
+type sink struct {
+	w   *bufio.Writer
+	err error
+}
+
+type rapidEncoder struct {
+	enc      unsafe.Pointer
+	handle   cgo.Handle
+	out      *sink
+	state    jog.EncoderState
+	validate bool
+}
+
+// NewEncoder returns an Encoder writing compact JSON to w through a
+// rapidjson Writer.
+func NewEncoder(w io.Writer) jog.Encoder {
+	return NewEncoderWithOptions(w, jog.WriterOptions{})
+}
+
+// NewEncoderWithOptions returns an Encoder that escapes strings as opts
+// asks.
+func NewEncoderWithOptions(w io.Writer, opts jog.WriterOptions) jog.Encoder {
+	var flags C.int
+	if opts.ASCII {
+		flags |= C.EncoderASCII
+	}
+	if opts.HTMLSafe {
+		flags |= C.EncoderEscapeHTML
+	}
+	if opts.EscapeSolidus {
+		flags |= C.EncoderEscapeSolidus
+	}
+	if opts.ValidateUTF8 {
+		flags |= C.EncoderValidateUTF8
+	}
+	out := &sink{w: bufio.NewWriter(w)}
+	e := &rapidEncoder{handle: cgo.NewHandle(out), out: out}
+	e.validate = opts.ASCII || opts.ValidateUTF8
+	e.enc = C.NewEncoder(C.uintptr_t(e.handle), flags)
+	runtime.SetFinalizer(e, cleanupEncoder)
+	return e
+}
+
+// StringifyWithOptions serializes a value like Stringify, escaping strings
+// as opts asks.
+func StringifyWithOptions(v jog.Value, opts jog.WriterOptions) (string, error) {
+	var buf bytes.Buffer
+	e := NewEncoderWithOptions(&buf, opts)
+	if err := e.Value(v); err != nil {
+		e.Close()
+		return "", err
+	}
+	if err := e.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+//export rapidWrite
+func rapidWrite(handle C.uintptr_t, str *C.char, length C.size_t) {
+	out := cgo.Handle(handle).Value().(*sink)
+	if out.err != nil {
+		return
+	}
+	_, out.err = out.w.Write(unsafe.Slice((*byte)(unsafe.Pointer(str)), int(length)))
+}
+
+func (e *rapidEncoder) BeginObject() error {
+	if err := e.check(e.state.Begin(jog.TypeObject)); err != nil {
+		return err
+	}
+	return e.status(C.EncoderStartObject(e.enc))
+}
+
+func (e *rapidEncoder) EndObject() error {
+	if err := e.check(e.state.End(jog.TypeObject)); err != nil {
+		return err
+	}
+	return e.status(C.EncoderEndObject(e.enc))
+}
+
+func (e *rapidEncoder) BeginArray() error {
+	if err := e.check(e.state.Begin(jog.TypeArray)); err != nil {
+		return err
+	}
+	return e.status(C.EncoderStartArray(e.enc))
+}
+
+func (e *rapidEncoder) EndArray() error {
+	if err := e.check(e.state.End(jog.TypeArray)); err != nil {
+		return err
+	}
+	return e.status(C.EncoderEndArray(e.enc))
+}
+
+func (e *rapidEncoder) Key(k string) error {
+	if err := e.checkString(k); err != nil {
+		return err
+	}
+	if err := e.check(e.state.Key()); err != nil {
+		return err
+	}
+	return e.status(C.EncoderKey(e.enc, cstring(k), C.size_t(len(k))))
+}
+
+func (e *rapidEncoder) Null() error {
+	if err := e.check(e.state.Value(jog.TypeNull)); err != nil {
+		return err
+	}
+	return e.status(C.EncoderNull(e.enc))
+}
+
+func (e *rapidEncoder) Bool(b bool) error {
+	if err := e.check(e.state.Value(jog.TypeBool)); err != nil {
+		return err
+	}
+	return e.status(C.EncoderBool(e.enc, C.bool(b)))
+}
+
+func (e *rapidEncoder) Int64(i int64) error {
+	if err := e.check(e.state.Value(jog.TypeNumber)); err != nil {
+		return err
+	}
+	return e.status(C.EncoderInt64(e.enc, C.int64_t(i)))
+}
+
+func (e *rapidEncoder) Uint64(u uint64) error {
+	if err := e.check(e.state.Value(jog.TypeNumber)); err != nil {
+		return err
+	}
+	return e.status(C.EncoderUint64(e.enc, C.uint64_t(u)))
+}
+
+func (e *rapidEncoder) Float64(f float64) error {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return fmt.Errorf("Could not encode %v, JSON has no such number", f)
+	}
+	if err := e.check(e.state.Value(jog.TypeNumber)); err != nil {
+		return err
+	}
+	return e.status(C.EncoderDouble(e.enc, C.double(f)))
+}
+
+func (e *rapidEncoder) String(s string) error {
+	if err := e.checkString(s); err != nil {
+		return err
+	}
+	if err := e.check(e.state.Value(jog.TypeString)); err != nil {
+		return err
+	}
+	return e.status(C.EncoderString(e.enc, cstring(s), C.size_t(len(s))))
+}
+
+func (e *rapidEncoder) Value(v jog.Value) error {
+	native, ok := v.(*rapidValue)
+	if !ok {
+		return jog.EncodeValue(e, v)
+	}
+	defer runtime.KeepAlive(native)
+	if err := e.check(e.state.Value(v.Type())); err != nil {
+		return err
+	}
+	if !C.EncoderValue(e.enc, native.value) {
+		if e.out.err == nil {
+			e.out.err = errors.New("Could not encode value, it holds an invalid UTF-8 string!")
+		}
+		return e.out.err
+	}
+	return e.out.err
+}
+
+func (e *rapidEncoder) Flush() error {
+	if e.enc != nil {
+		C.EncoderFlush(e.enc)
+	}
+	if e.out.err != nil {
+		return e.out.err
+	}
+	e.out.err = e.out.w.Flush()
+	return e.out.err
+}
+
+func (e *rapidEncoder) Close() error {
+	if e.enc == nil {
+		return e.out.err
+	}
+	err := e.Flush()
+	cleanupEncoder(e)
+	runtime.SetFinalizer(e, nil)
+	if err == nil && !e.state.Complete() {
+		err = errors.New("Could not close encoder, the document is incomplete!")
+	}
+	return err
+}
+
+// Private methods.
+
+// Finalizer to call the Encoder destructor and release the sink.
+func cleanupEncoder(e *rapidEncoder) {
+	C.DeleteEncoder(e.enc)
+	e.enc = nil
+	e.handle.Delete()
+}
+
+// Reject the token if the structure is invalid or a write already failed.
+func (e *rapidEncoder) check(err error) error {
+	if e.enc == nil {
+		return errors.New("Could not write to a closed encoder!")
+	}
+	if e.out.err != nil {
+		return e.out.err
+	}
+	return err
+}
+
+// A write error raised while the Writer was flushing sticks and fails every
+// later token.
+func (e *rapidEncoder) status(ok C.bool) error {
+	if e.out.err != nil {
+		return e.out.err
+	}
+	if !ok {
+		e.out.err = errors.New("Could not encode token!")
+	}
+	return e.out.err
+}
+
+// Writer takes string lengths as 32-bit SizeType. Its UTF-8 decoding
+// would only fail after part of the string has been written.
+func (e *rapidEncoder) checkString(s string) error {
+	if uint64(len(s)) > math.MaxUint32 {
+		return fmt.Errorf("Could not encode a string of %d bytes!", len(s))
+	}
+	if e.validate && !utf8.ValidString(s) {
+		return fmt.Errorf("Could not encode invalid UTF-8 string %q!", s)
+	}
+	return nil
+}
+
+// Utility functions.
+
+func cstring(s string) *C.char {
+	return (*C.char)(unsafe.Pointer(unsafe.StringData(s)))
+}
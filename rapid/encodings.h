@@ -392,7 +392,7 @@ struct UTF32 {
         RAPIDJSON_STATIC_ASSERT(sizeof(typename InputStream::Ch) >= 4);
         Ch c = is.Take();
         *codepoint = c;
-        return c <= 0x10FFFF;
+        return c <= 0x10FFFF && (c < 0xD800 || c > 0xDFFF);
     }
 
     template <typename InputStream, typename OutputStream>
@@ -400,7 +400,7 @@ struct UTF32 {
         RAPIDJSON_STATIC_ASSERT(sizeof(typename InputStream::Ch) >= 4);
         Ch c;
         os.Put(c = is.Take());
-        return c <= 0x10FFFF;
+        return c <= 0x10FFFF && (c < 0xD800 || c > 0xDFFF);
     }
 };
 
@@ -0,0 +1,68 @@
+package rapid
+
+// #include <stdbool.h>
+// #include <stdint.h>
+// #include "rapid.h"
+import "C"
+
+import (
+	"context"
+	"runtime"
+	"unsafe"
+
+	"github.com/anantn/jog"
+)
+
+// Parser parses documents one after another into the same memory pools and
+// input buffer, so once they have grown to fit, parsing stops allocating
+// native memory. A document is only valid until the next call to Parse or
+// Reset, and a Parser must not be used by more than one goroutine at a time.
+// If its pools can't be allocated, a Parser parses each document into memory
+// of its own, as New does.
+type Parser struct {
+	opts   jog.Options
+	parser unsafe.Pointer
+}
+
+// Finalizer to call the Parser destructor.
+func cleanupParser(p *Parser) {
+	if p.parser != nil {
+		C.DeleteParser(p.parser)
+	}
+}
+
+// Create a Parser reading documents as described by opts.
+func NewParser(opts jog.Options) *Parser {
+	return newParser(opts, C.NewParser())
+}
+
+// Parse data, invalidating the previous document.
+func (p *Parser) Parse(data []byte) (jog.Value, error) {
+	defer runtime.KeepAlive(p)
+	return parseContext(context.Background(), data, p.opts, p.pooled())
+}
+
+// Release the last document, keeping its memory for the next one.
+func (p *Parser) Reset() {
+	defer runtime.KeepAlive(p)
+	if p.parser != nil {
+		C.ResetParser(p.parser)
+	}
+}
+
+// Private methods.
+
+// A Parser owning parser, or parsing without pools if parser is nil.
+func newParser(opts jog.Options, parser unsafe.Pointer) *Parser {
+	p := &Parser{opts, parser}
+	runtime.SetFinalizer(p, cleanupParser)
+	return p
+}
+
+// The Parser to parse into, or nil to parse without the pools.
+func (p *Parser) pooled() *Parser {
+	if p.parser == nil {
+		return nil
+	}
+	return p
+}
@@ -1,99 +1,523 @@
 #include <errno.h>
 #include <stdio.h>
 #include <stdlib.h>
+#include <string.h>
 #include <stdbool.h>
+#include <stdint.h>
+#include <stddef.h>
+
+#include <new>
+#include <vector>
 
 #include "rapid.h"
+
+#define RAPIDJSON_MALLOC(size) CountedMalloc(size)
+#define RAPIDJSON_REALLOC(ptr, new_size) CountedRealloc(ptr, new_size)
+#define RAPIDJSON_FREE(ptr) CountedFree(ptr)
+
 #include "writer.h"
 #include "document.h"
 #include "stringbuffer.h"
+#include "memorystream.h"
+#include "encodedstream.h"
 
 using namespace rapidjson;
 
-void* NewDocument(char* string, char** error) {
-    Document* doc = new Document();
-    if (!string) {
-        delete doc;
+// Every counted allocation is preceded by its size, so frees can be counted.
+static const size_t kHeaderSize = 16;
+
+static MemoryStats stats;
+
+// The net bytes allocated by the parse running on this thread, if it has a
+// memory budget.
+static __thread int64_t* parseAccount;
+
+static void CountAlloc(int64_t size, int64_t mallocs, int64_t frees) {
+    __atomic_add_fetch(&stats.inUse, size, __ATOMIC_RELAXED);
+    if (size > 0) {
+        __atomic_add_fetch(&stats.totalAlloc, size, __ATOMIC_RELAXED);
+    }
+    __atomic_add_fetch(&stats.mallocs, mallocs, __ATOMIC_RELAXED);
+    __atomic_add_fetch(&stats.frees, frees, __ATOMIC_RELAXED);
+    if (parseAccount) {
+        *parseAccount += size;
+    }
+}
+
+void* CountedMalloc(size_t size) {
+    char* block = (char*) malloc(kHeaderSize + size);
+    if (!block) {
         return NULL;
     }
+    *(size_t*) block = size;
+    CountAlloc(size, 1, 0);
+    return block + kHeaderSize;
+}
 
-    if (doc->ParseInsitu(string).HasParseError()) {
-        char* msg = new char[100];
-        size_t offset = doc->GetErrorOffset();
-        ParseErrorCode code = doc->GetParseError();
-        switch (code) {
-            case kParseErrorNone:
-                sprintf(msg, "[%lu] %s", offset, "No error.");
-                break;
-            case kParseErrorDocumentEmpty:
-                sprintf(msg, "[%lu] %s", offset, "The document is empty.");
-                break;
-            case kParseErrorDocumentRootNotSingular:
-                sprintf(msg, "[%lu] %s", offset, "The document root must not follow by other values.");
-                break;
-            case kParseErrorValueInvalid:
-                sprintf(msg, "[%lu] %s", offset, "Invalid value.");
-                break;
-            case kParseErrorObjectMissName:
-                sprintf(msg, "[%lu] %s", offset, "Missing a name for object member.");
-                break;
-            case kParseErrorObjectMissColon:
-                sprintf(msg, "[%lu] %s", offset, "Missing a colon after a name of object member.");
-                break;
-            case kParseErrorObjectMissCommaOrCurlyBracket:
-                sprintf(msg, "[%lu] %s", offset, "Missing a comma or '}' after an object member.");
-                break;
-            case kParseErrorArrayMissCommaOrSquareBracket:
-                sprintf(msg, "[%lu] %s", offset, "Missing a comma or ']' after an array element.");
-                break;
-            case kParseErrorStringUnicodeEscapeInvalidHex:
-                sprintf(msg, "[%lu] %s", offset, "Incorrect hex digit after \\u escape in string.");
-                break;
-            case kParseErrorStringUnicodeSurrogateInvalid:
-                sprintf(msg, "[%lu] %s", offset, "The surrogate pair in string is invalid.");
-                break;
-            case kParseErrorStringEscapeInvalid:
-                sprintf(msg, "[%lu] %s", offset, "Invalid escape character in string.");
-                break;
-            case kParseErrorStringMissQuotationMark:
-                sprintf(msg, "[%lu] %s", offset, "Missing a closing quotation mark in string.");
-                break;
-            case kParseErrorStringInvalidEncoding:
-                sprintf(msg, "[%lu] %s", offset, "Invalid encoding in string.");
-                break;
-            case kParseErrorNumberTooBig:
-                sprintf(msg, "[%lu] %s", offset, "Number too big to be stored in double.");
-                break;
-            case kParseErrorNumberMissFraction:
-                sprintf(msg, "[%lu] %s", offset, "Miss fraction part in number.");
-                break;
-            case kParseErrorNumberMissExponent:
-                sprintf(msg, "[%lu] %s", offset, "Miss exponent in number.");
-                break;
-            case kParseErrorTermination:
-                sprintf(msg, "[%lu] %s", offset, "Parsing was terminated.");
-                break;
-            case kParseErrorUnspecificSyntaxError:
-                sprintf(msg, "[%lu] %s", offset, "Unspecific syntax error.");
-                break;
-            default:
-                sprintf(msg, "[%lu] %s", offset, "Unrecognized error code.");
-                break;
+void* CountedRealloc(void* ptr, size_t size) {
+    if (!ptr) {
+        return CountedMalloc(size);
+    }
+    char* block = (char*) ptr - kHeaderSize;
+    size_t old = *(size_t*) block;
+    block = (char*) realloc(block, kHeaderSize + size);
+    if (!block) {
+        return NULL;
+    }
+    *(size_t*) block = size;
+    CountAlloc((int64_t) size - (int64_t) old, 0, 0);
+    return block + kHeaderSize;
+}
+
+void CountedFree(void* ptr) {
+    if (!ptr) {
+        return;
+    }
+    char* block = (char*) ptr - kHeaderSize;
+    CountAlloc(-(int64_t) *(size_t*) block, 0, 1);
+    free(block);
+}
+
+void GetMemoryStats(MemoryStats* out) {
+    out->inUse = __atomic_load_n(&stats.inUse, __ATOMIC_RELAXED);
+    out->totalAlloc = __atomic_load_n(&stats.totalAlloc, __ATOMIC_RELAXED);
+    out->mallocs = __atomic_load_n(&stats.mallocs, __ATOMIC_RELAXED);
+    out->frees = __atomic_load_n(&stats.frees, __ATOMIC_RELAXED);
+}
+
+// A document whose values and parse stack live in memory pools, so that a
+// Parser can reuse them.
+typedef GenericDocument<UTF8<>, MemoryPoolAllocator<>, MemoryPoolAllocator<> > PooledDocument;
+
+// Describe a parse error, prefixed by its byte offset.
+static char* ParseError(ParseErrorCode code, size_t offset) {
+    char* msg = (char*) malloc(100);
+    switch (code) {
+        case kParseErrorNone:
+            sprintf(msg, "[%lu] %s", offset, "No error.");
+            break;
+        case kParseErrorDocumentEmpty:
+            sprintf(msg, "[%lu] %s", offset, "The document is empty.");
+            break;
+        case kParseErrorDocumentRootNotSingular:
+            sprintf(msg, "[%lu] %s", offset, "The document root must not follow by other values.");
+            break;
+        case kParseErrorValueInvalid:
+            sprintf(msg, "[%lu] %s", offset, "Invalid value.");
+            break;
+        case kParseErrorObjectMissName:
+            sprintf(msg, "[%lu] %s", offset, "Missing a name for object member.");
+            break;
+        case kParseErrorObjectMissColon:
+            sprintf(msg, "[%lu] %s", offset, "Missing a colon after a name of object member.");
+            break;
+        case kParseErrorObjectMissCommaOrCurlyBracket:
+            sprintf(msg, "[%lu] %s", offset, "Missing a comma or '}' after an object member.");
+            break;
+        case kParseErrorArrayMissCommaOrSquareBracket:
+            sprintf(msg, "[%lu] %s", offset, "Missing a comma or ']' after an array element.");
+            break;
+        case kParseErrorStringUnicodeEscapeInvalidHex:
+            sprintf(msg, "[%lu] %s", offset, "Incorrect hex digit after \\u escape in string.");
+            break;
+        case kParseErrorStringUnicodeSurrogateInvalid:
+            sprintf(msg, "[%lu] %s", offset, "The surrogate pair in string is invalid.");
+            break;
+        case kParseErrorStringEscapeInvalid:
+            sprintf(msg, "[%lu] %s", offset, "Invalid escape character in string.");
+            break;
+        case kParseErrorStringMissQuotationMark:
+            sprintf(msg, "[%lu] %s", offset, "Missing a closing quotation mark in string.");
+            break;
+        case kParseErrorStringInvalidEncoding:
+            sprintf(msg, "[%lu] %s", offset, "Invalid encoding in string.");
+            break;
+        case kParseErrorNumberTooBig:
+            sprintf(msg, "[%lu] %s", offset, "Number too big to be stored in double.");
+            break;
+        case kParseErrorNumberMissFraction:
+            sprintf(msg, "[%lu] %s", offset, "Miss fraction part in number.");
+            break;
+        case kParseErrorNumberMissExponent:
+            sprintf(msg, "[%lu] %s", offset, "Miss exponent in number.");
+            break;
+        case kParseErrorTermination:
+            sprintf(msg, "[%lu] %s", offset, "Parsing was terminated.");
+            break;
+        case kParseErrorUnspecificSyntaxError:
+            sprintf(msg, "[%lu] %s", offset, "Unspecific syntax error.");
+            break;
+        default:
+            sprintf(msg, "[%lu] %s", offset, "Unrecognized error code.");
+            break;
+    }
+    return msg;
+}
+
+// Limits that can stop a parse, matching jog.Limit.
+enum {
+    LimitDepth = 2,
+    LimitStringLength = 3,
+    LimitMembers = 4,
+    LimitMemory = 5
+};
+
+// Forwards parse events to a document, stopping the parse with
+// kParseErrorTermination once it has been canceled or a limit is exceeded.
+// The memory allocated while it is alive is charged to its budget, on top of
+// the memory already charged for the input.
+template <typename Doc>
+class ParseHandler {
+public:
+    ParseHandler(Doc& doc, ParseControl* control, size_t charged) : doc_(doc), control_(control), allocated_(charged) {
+        previous_ = parseAccount;
+        parseAccount = &allocated_;
+    }
+    ~ParseHandler() { parseAccount = previous_; }
+
+    bool WithinBudget() { return !control_->maxMemory || allocated_ <= (int64_t) control_->maxMemory; }
+
+    bool Null() { return Element() && doc_.Null(); }
+    bool Bool(bool b) { return Element() && doc_.Bool(b); }
+    bool Int(int i) { return Element() && doc_.Int(i); }
+    bool Uint(unsigned u) { return Element() && doc_.Uint(u); }
+    bool Int64(int64_t i) { return Element() && doc_.Int64(i); }
+    bool Uint64(uint64_t u) { return Element() && doc_.Uint64(u); }
+    bool Double(double d) { return Element() && doc_.Double(d); }
+    bool String(const char* str, SizeType length, bool copy) {
+        return Element() && Length(length) && doc_.String(str, length, copy);
+    }
+    bool StartObject() { return Element() && Push(true) && doc_.StartObject(); }
+    bool Key(const char* str, SizeType length, bool copy) {
+        return Continue() && Count(true) && Length(length) && doc_.Key(str, length, copy);
+    }
+    bool EndObject(SizeType count) { return Pop() && doc_.EndObject(count); }
+    bool StartArray() { return Element() && Push(false) && doc_.StartArray(); }
+    bool EndArray(SizeType count) { return Pop() && doc_.EndArray(count); }
+
+private:
+    struct Level {
+        size_t members;
+        bool object;
+    };
+
+    bool Continue() {
+        if (__atomic_load_n(&control_->canceled, __ATOMIC_RELAXED)) {
+            return false;
+        }
+        return WithinBudget() || Exceed(LimitMemory);
+    }
+
+    bool Exceed(int limit) {
+        control_->exceeded = limit;
+        return false;
+    }
+
+    // A value is a member of an enclosing array; object members are counted
+    // by their key.
+    bool Element() { return Continue() && Count(false); }
+
+    bool Count(bool object) {
+        if (levels_.empty() || levels_.back().object != object) {
+            return true;
+        }
+        size_t members = ++levels_.back().members;
+        if (control_->maxMembers && members > control_->maxMembers) {
+            return Exceed(LimitMembers);
+        }
+        return true;
+    }
+
+    bool Length(SizeType length) {
+        if (control_->maxStringLength && length > control_->maxStringLength) {
+            return Exceed(LimitStringLength);
+        }
+        return true;
+    }
+
+    bool Push(bool object) {
+        if (control_->maxDepth && levels_.size() >= control_->maxDepth) {
+            return Exceed(LimitDepth);
+        }
+        Level level = { 0, object };
+        levels_.push_back(level);
+        return true;
+    }
+
+    bool Pop() {
+        levels_.pop_back();
+        return true;
+    }
+
+    Doc& doc_;
+    ParseControl* control_;
+    std::vector<Level> levels_;
+    int64_t allocated_;
+    int64_t* previous_;
+};
+
+// Parse without recursion, so deeply nested input cannot overflow the stack.
+template <unsigned parseFlags, typename SourceEncoding, typename Doc, typename InputStream>
+static void Parse(Doc* doc, InputStream& is, ParseControl* control, size_t charged = 0) {
+    if (control) {
+        ParseHandler<Doc> handler(*doc, control, charged);
+        doc->template ParseStream<parseFlags | kParseIterativeFlag, SourceEncoding>(is, handler);
+        // The last value is allocated after its event was checked.
+        if (!doc->HasParseError() && !handler.WithinBudget()) {
+            control->exceeded = LimitMemory;
+            control->offset = is.Tell();
+        }
+    } else {
+        doc->template ParseStream<parseFlags | kParseIterativeFlag, SourceEncoding>(is);
+    }
+}
+
+// Store the parse error in *error. Returns false if there was one.
+static bool Check(ParseErrorCode code, size_t offset, ParseControl* control, char** error) {
+    if (code == kParseErrorNone) {
+        if (!control || control->exceeded != LimitMemory) {
+            return true;
         }
+        *error = (char*) malloc(100);
+        sprintf(*error, "[%lu] %s", control->offset, "Exceeded the memory budget.");
+        return false;
+    }
+    *error = ParseError(code, offset);
+    if (control) {
+        control->offset = offset;
+    }
+    return false;
+}
+
+template <typename Doc>
+static bool Check(Doc* doc, ParseControl* control, char** error) {
+    return Check(doc->GetParseError(), doc->GetErrorOffset(), control, error);
+}
+
+// Parse a NUL-terminated UTF-8 string of length bytes in place. The string
+// counts towards the memory budget.
+template <typename Doc>
+static bool ParseInsitu(Doc* doc, char* string, size_t length, ParseControl* control, char** error) {
+    GenericInsituStringStream<UTF8<> > is(string);
+    Parse<kParseFullPrecisionFlag | kParseInsituFlag, UTF8<> >(doc, is, control, length + 1);
+    return Check(doc, control, error);
+}
+
+// Parse length bytes of data in the given UTFType without modifying it.
+template <typename Doc>
+static bool ParseEncoded(Doc* doc, const char* data, size_t length, int encoding, ParseControl* control, char** error) {
+    MemoryStream ms(data, length);
+    AutoUTFInputStream<unsigned, MemoryStream> is(ms, (UTFType) encoding);
 
+    // The stream pads a truncated code unit with NULs, which would read as
+    // the end of the input.
+    size_t unit = 1, bom = 0;
+    switch (is.GetType()) {
+        case kUTF8:
+            bom = 3;
+            break;
+        case kUTF16LE:
+        case kUTF16BE:
+            unit = bom = 2;
+            break;
+        case kUTF32LE:
+        case kUTF32BE:
+            unit = bom = 4;
+            break;
+    }
+    if (!is.HasBOM()) {
+        bom = 0;
+    }
+    if ((length - bom) % unit != 0) {
+        char* msg = (char*) malloc(100);
+        sprintf(msg, "[%lu] %s", length - (length - bom) % unit, "Truncated code unit at the end of the input.");
         *error = msg;
+        return false;
+    }
+
+    Parse<kParseFullPrecisionFlag | kParseValidateEncodingFlag, AutoUTF<unsigned> >(doc, is, control);
+    return Check(doc, control, error);
+}
+
+void CancelParse(ParseControl* control) {
+    __atomic_store_n(&control->canceled, 1, __ATOMIC_RELAXED);
+}
+
+void* NewDocument(char* string, size_t length, ParseControl* control, char** error) {
+    if (!string) {
+        return NULL;
+    }
+
+    Document* doc = new Document();
+    if (!ParseInsitu(doc, string, length, control, error)) {
         delete doc;
         return NULL;
     }
+    return doc;
+}
 
+void* NewDocumentEncoded(const char* data, size_t length, int encoding, ParseControl* control, char** error) {
+    Document* doc = new Document();
+    if (!ParseEncoded(doc, data, length, encoding, control, error)) {
+        delete doc;
+        return NULL;
+    }
     return doc;
 }
 
+bool ValidateDocument(const char* data, size_t length, ParseControl* control, char** error) {
+    MemoryStream is(data, length);
+    Reader reader;
+    BaseReaderHandler<> sink;
+    ParseResult result;
+    if (control) {
+        ParseHandler<BaseReaderHandler<> > handler(sink, control, 0);
+        result = reader.Parse<kParseIterativeFlag>(is, handler);
+        if (!result.IsError() && !handler.WithinBudget()) {
+            control->exceeded = LimitMemory;
+            control->offset = is.Tell();
+        }
+    } else {
+        result = reader.Parse<kParseIterativeFlag>(is, sink);
+    }
+    return Check(result.Code(), result.Offset(), control, error);
+}
+
 void DeleteDocument(void *value) {
     Document *d = static_cast<Document*>(value);
     delete d;
 }
 
+size_t DocumentMemory(void* value) {
+    Document* d = static_cast<Document*>(value);
+    return sizeof(Document) + d->GetAllocator().Capacity();
+}
+
+// A memory pool whose first chunk is a buffer kept between documents. Reset
+// frees the chunks added once the buffer filled up and grows the buffer to
+// hold them as well, so similar documents soon stop allocating.
+class Region {
+public:
+    // Pool is NULL if the buffer or the pool could not be allocated.
+    Region() : capacity_(kInitialCapacity), buffer_(CountedMalloc(capacity_)), pool_(NULL) {
+        if (buffer_) {
+            pool_ = new (std::nothrow) MemoryPoolAllocator<>(buffer_, capacity_);
+        }
+    }
+    ~Region() {
+        delete pool_;
+        CountedFree(buffer_);
+    }
+
+    MemoryPoolAllocator<>* Pool() { return pool_; }
+
+    // Recreate the pool in place, since the document holds a pointer to it.
+    // If a larger buffer can't be allocated, the old one is kept.
+    void Reset() {
+        size_t used = pool_->Capacity();
+        pool_->~MemoryPoolAllocator();
+        if (used > capacity_) {
+            size_t capacity = capacity_;
+            while (capacity < used + kInitialCapacity) {
+                capacity *= 2;
+            }
+            void* buffer = CountedMalloc(capacity);
+            if (buffer) {
+                CountedFree(buffer_);
+                buffer_ = buffer;
+                capacity_ = capacity;
+            }
+        }
+        new (pool_) MemoryPoolAllocator<>(buffer_, capacity_);
+    }
+
+private:
+    static const size_t kInitialCapacity = 4096;
+
+    size_t capacity_;
+    void* buffer_;
+    MemoryPoolAllocator<>* pool_;
+};
+
+struct Parser {
+    Parser() : doc(values.Pool(), 1024, stack.Pool()), input(NULL), inputCapacity(0), inputLength(0) {}
+    ~Parser() { CountedFree(input); }
+
+    Region values;
+    Region stack;
+    PooledDocument doc;
+    char* input;
+    size_t inputCapacity;
+    // The bytes of input the current document was parsed in.
+    size_t inputLength;
+};
+
+void* NewParser() {
+    Parser* p = new (std::nothrow) Parser();
+    if (p && (!p->values.Pool() || !p->stack.Pool())) {
+        delete p;
+        return NULL;
+    }
+    return p;
+}
+
+void DeleteParser(void* parser) {
+    delete static_cast<Parser*>(parser);
+}
+
+void ResetParser(void* parser) {
+    Parser* p = static_cast<Parser*>(parser);
+    p->doc.SetNull();
+    p->values.Reset();
+    p->stack.Reset();
+    p->inputLength = 0;
+}
+
+void* ParserParse(void* parser, const char* data, size_t length, ParseControl* control, char** error) {
+    Parser* p = static_cast<Parser*>(parser);
+    ResetParser(p);
+    if (length + 1 > p->inputCapacity) {
+        char* input = (char*) CountedRealloc(p->input, length + 1);
+        if (!input) {
+            *error = strdup("[0] Could not allocate the input buffer.");
+            return NULL;
+        }
+        p->input = input;
+        p->inputCapacity = length + 1;
+    }
+    memcpy(p->input, data, length);
+    p->input[length] = '\0';
+    p->inputLength = length + 1;
+    if (!ParseInsitu(&p->doc, p->input, length, control, error)) {
+        return NULL;
+    }
+    return static_cast<Value*>(&p->doc);
+}
+
+void* ParserParseEncoded(void* parser, const char* data, size_t length, int encoding, ParseControl* control, char** error) {
+    Parser* p = static_cast<Parser*>(parser);
+    ResetParser(p);
+    if (!ParseEncoded(&p->doc, data, length, encoding, control, error)) {
+        return NULL;
+    }
+    return static_cast<Value*>(&p->doc);
+}
+
+size_t ParserMemory(void* parser) {
+    Parser* p = static_cast<Parser*>(parser);
+    return p->values.Pool()->Size() + p->inputLength;
+}
+
+// The member of an object under key i of path, or NULL if there is none.
+static Value* FindKey(Value* val, Path* path, size_t i) {
+    Value name(StringRef(path->keys[i], (SizeType) path->keyLengths[i]));
+    Value::MemberIterator itr = val->FindMember(name);
+    if (itr == val->MemberEnd()) {
+        return NULL;
+    }
+    return &(itr->value);
+}
+
 void* Get(void* value, Path* path) {
     if (!value) {
         return NULL;
@@ -102,26 +526,25 @@ void* Get(void* value, Path* path) {
         return static_cast<Value*>(value);
     }
 
-    int i;
     Value* val = static_cast<Value*>(value);
-    for (i = 0; i < path->length; i++) {
-        char* key = path->keys[i];
-        Value::MemberIterator itr = val->FindMember(key);
-        if (itr == val->MemberEnd()) {
-            return NULL;
-        }
-        val = &(itr->value);
+    for (size_t i = 0; val && i < path->length; i++) {
+        val = val->IsObject() ? FindKey(val, path, i) : NULL;
     }
     return val;
 }
 
-int GetInt(void* value, Path* path) {
-    Value* val = (Value*) Get(value, path);
-    if (!val || !val->IsInt()) {
-        errno = EINVAL;
-        return -1;
+int Locate(void* value, Path* path, size_t* depth) {
+    Value* val = static_cast<Value*>(value);
+    *depth = 0;
+    while (path && *depth < path->length && val->IsObject()) {
+        Value* member = FindKey(val, path, *depth);
+        if (!member) {
+            break;
+        }
+        val = member;
+        (*depth)++;
     }
-    return val->GetInt();
+    return val->GetType();
 }
 
 bool GetBool(void* value, Path* path) {
@@ -133,22 +556,21 @@ bool GetBool(void* value, Path* path) {
     return val->GetBool();
 }
 
-double GetDouble(void* value, Path* path) {
+int GetNumber(void* value, Path* path, int64_t* i, uint64_t* u, double* d) {
     Value* val = (Value*) Get(value, path);
-    if (!val || !val->IsDouble()) {
-        errno = EINVAL;
+    if (!val || !val->IsNumber()) {
         return -1;
     }
-    return val->GetDouble();
-}
-
-unsigned int GetUInt(void* value, Path* path) {
-    Value* val = (Value*) Get(value, path);
-    if (!val || !val->IsUint()) {
-        errno = EINVAL;
-        return -1;
+    if (val->IsInt64()) {
+        *i = val->GetInt64();
+        return NumberInt;
+    }
+    if (val->IsUint64()) {
+        *u = val->GetUint64();
+        return NumberUint;
     }
-    return val->GetUint();
+    *d = val->GetDouble();
+    return NumberDouble;
 }
 
 const char* GetString(void* value, Path* path) {
@@ -176,6 +598,53 @@ void** GetArray(void* value, Path* path, size_t* length) {
     return array;
 }
 
+int64_t Len(void* value, Path* path) {
+    Value* val = (Value*) Get(value, path);
+    if (val && val->IsArray()) {
+        return val->Size();
+    }
+    if (val && val->IsObject()) {
+        return val->MemberCount();
+    }
+    return -1;
+}
+
+void* Index(void* value, Path* path, size_t i) {
+    Value* val = (Value*) Get(value, path);
+    if (!val || !val->IsArray() || i >= val->Size()) {
+        return NULL;
+    }
+    return &(*val)[(SizeType) i];
+}
+
+void* Elements(void* value, Path* path, size_t* length, size_t* stride) {
+    Value* val = (Value*) Get(value, path);
+    if (!val || !val->IsArray()) {
+        return NULL;
+    }
+    *length = val->Size();
+    *stride = sizeof(Value);
+    // Begin() of an empty array may be NULL, which would read as no array.
+    return val->Size() ? (void*) val->Begin() : (void*) val;
+}
+
+void* Members(void* value, Path* path, size_t* length, size_t* stride, size_t* offset) {
+    Value* val = (Value*) Get(value, path);
+    if (!val || !val->IsObject()) {
+        return NULL;
+    }
+    *length = val->MemberCount();
+    *stride = sizeof(Value::Member);
+    *offset = offsetof(Value::Member, value);
+    return val->MemberCount() ? (void*) &*val->MemberBegin() : (void*) val;
+}
+
+const char* MemberKey(void* member, size_t* length) {
+    Value::Member* m = (Value::Member*) member;
+    *length = m->name.GetStringLength();
+    return m->name.GetString();
+}
+
 void** GetObject(void* value, Path* path, size_t* length, char*** keys) {
     Value* val = (Value*) Get(value, path);
     if (!val || !val->IsObject()) {
@@ -220,6 +689,58 @@ const char* Type(void *value, Path* path) {
     return "UNKNOWN";
 }
 
+// Write a value like Value::Accept, but walking the arrays and objects
+// with a stack of its own, so deep nesting can't overflow the C stack.
+template <typename Handler>
+bool WriteValue(const Value& root, Handler& handler) {
+    struct Frame {
+        const Value* container;
+        SizeType next;
+    };
+    std::vector<Frame> stack;
+    const Value* val = &root;
+    for (;;) {
+        if (val) {
+            if (val->IsObject() || val->IsArray()) {
+                if (!(val->IsObject() ? handler.StartObject() : handler.StartArray())) {
+                    return false;
+                }
+                Frame frame = {val, 0};
+                stack.push_back(frame);
+            } else if (!val->Accept(handler)) {
+                return false;
+            }
+            val = NULL;
+        }
+        if (stack.empty()) {
+            return true;
+        }
+        Frame& top = stack.back();
+        if (top.container->IsObject()) {
+            if (top.next < top.container->MemberCount()) {
+                Value::ConstMemberIterator m = top.container->MemberBegin() + top.next++;
+                if (!handler.Key(m->name.GetString(), m->name.GetStringLength())) {
+                    return false;
+                }
+                val = &m->value;
+                continue;
+            }
+            if (!handler.EndObject(top.next)) {
+                return false;
+            }
+        } else {
+            if (top.next < top.container->Size()) {
+                val = &(*top.container)[top.next++];
+                continue;
+            }
+            if (!handler.EndArray(top.next)) {
+                return false;
+            }
+        }
+        stack.pop_back();
+    }
+}
+
 char* Stringify(void *value, Path* path) {
     Value* val = (Value*) Get(value, path);
     if (!val) {
@@ -227,10 +748,203 @@ char* Stringify(void *value, Path* path) {
     }
     StringBuffer buffer;
     Writer<StringBuffer> writer(buffer);
-    val->Accept(writer);
+    WriteValue(*val, writer);
 
     const char* str = buffer.GetString();
     char* retstr = (char*) malloc(sizeof(char) * (strlen(str) + 1));
     strcpy(retstr, str);
     return retstr;
 }
+
+void Extract(void* value, ExtractField* fields, size_t count) {
+    for (size_t f = 0; f < count; f++) {
+        ExtractField* field = &fields[f];
+        Value* val = (Value*) Get(value, &field->path);
+        field->value = val;
+        if (!val) {
+            field->type = -1;
+            continue;
+        }
+        field->type = val->GetType();
+        if (val->IsNumber()) {
+            field->d = val->GetDouble();
+            field->isInt = val->IsInt64();
+            if (field->isInt) {
+                field->i = val->GetInt64();
+            }
+        } else if (val->IsString()) {
+            field->str = val->GetString();
+            field->length = val->GetStringLength();
+        }
+    }
+}
+
+// Implemented in encoder.go.
+extern "C" void rapidWrite(uintptr_t handle, char* str, size_t length);
+
+// Output stream for Writer that hands its buffer to the Go writer whenever
+// it fills up or is flushed. '<', '>', '&' and '/' can only occur inside
+// strings, so they are escaped here rather than in the Writer.
+class GoStream {
+public:
+    typedef char Ch;
+
+    GoStream(uintptr_t handle, int flags) : handle_(handle), flags_(flags), length_(0) {}
+
+    void Put(Ch c) {
+        switch (c) {
+            case '<':
+                if (flags_ & EncoderEscapeHTML) { PutString("\\u003c"); return; }
+                break;
+            case '>':
+                if (flags_ & EncoderEscapeHTML) { PutString("\\u003e"); return; }
+                break;
+            case '&':
+                if (flags_ & EncoderEscapeHTML) { PutString("\\u0026"); return; }
+                break;
+            case '/':
+                if (flags_ & EncoderEscapeSolidus) { PutString("\\/"); return; }
+                break;
+        }
+        PutRaw(c);
+    }
+
+    void Flush() {
+        if (length_ > 0) {
+            rapidWrite(handle_, buffer_, length_);
+            length_ = 0;
+        }
+    }
+
+private:
+    void PutRaw(Ch c) {
+        if (length_ == sizeof(buffer_)) {
+            Flush();
+        }
+        buffer_[length_++] = c;
+    }
+
+    void PutString(const char* str) {
+        for (; *str; str++) {
+            PutRaw(*str);
+        }
+    }
+
+    uintptr_t handle_;
+    int flags_;
+    char buffer_[4096];
+    size_t length_;
+};
+
+// The target encoding of the Writer is a template parameter, so the C
+// functions dispatch through this interface.
+class Encoder {
+public:
+    Encoder(uintptr_t handle, int flags) : stream(handle, flags) {}
+    virtual ~Encoder() {}
+
+    virtual bool StartObject() = 0;
+    virtual bool EndObject() = 0;
+    virtual bool StartArray() = 0;
+    virtual bool EndArray() = 0;
+    virtual bool Key(const char* str, size_t length) = 0;
+    virtual bool Null() = 0;
+    virtual bool Bool(bool b) = 0;
+    virtual bool Int64(int64_t i) = 0;
+    virtual bool Uint64(uint64_t u) = 0;
+    virtual bool Double(double d) = 0;
+    virtual bool String(const char* str, size_t length) = 0;
+    virtual bool Accept(Value* value) = 0;
+
+    GoStream stream;
+};
+
+// ASCII escapes everything else as \uXXXX. Writing to UTF8<unsigned char>
+// instead of UTF8<char> decodes every code point, which validates it.
+template <typename TargetEncoding>
+class EncoderImpl : public Encoder {
+public:
+    EncoderImpl(uintptr_t handle, int flags) : Encoder(handle, flags), writer(stream) {}
+
+    bool StartObject() { return writer.StartObject(); }
+    bool EndObject() { return writer.EndObject(); }
+    bool StartArray() { return writer.StartArray(); }
+    bool EndArray() { return writer.EndArray(); }
+    bool Key(const char* str, size_t length) { return writer.Key(str, (SizeType) length); }
+    bool Null() { return writer.Null(); }
+    bool Bool(bool b) { return writer.Bool(b); }
+    bool Int64(int64_t i) { return writer.Int64(i); }
+    bool Uint64(uint64_t u) { return writer.Uint64(u); }
+    bool Double(double d) { return writer.Double(d); }
+    bool String(const char* str, size_t length) { return writer.String(str, (SizeType) length); }
+    bool Accept(Value* value) { return WriteValue(*value, writer); }
+
+private:
+    Writer<GoStream, UTF8<>, TargetEncoding> writer;
+};
+
+void* NewEncoder(uintptr_t handle, int flags) {
+    if (flags & EncoderASCII) {
+        return static_cast<Encoder*>(new EncoderImpl<ASCII<> >(handle, flags));
+    }
+    if (flags & EncoderValidateUTF8) {
+        return static_cast<Encoder*>(new EncoderImpl<UTF8<unsigned char> >(handle, flags));
+    }
+    return static_cast<Encoder*>(new EncoderImpl<UTF8<> >(handle, flags));
+}
+
+void DeleteEncoder(void* encoder) {
+    delete static_cast<Encoder*>(encoder);
+}
+
+void EncoderFlush(void* encoder) {
+    static_cast<Encoder*>(encoder)->stream.Flush();
+}
+
+bool EncoderStartObject(void* encoder) {
+    return static_cast<Encoder*>(encoder)->StartObject();
+}
+
+bool EncoderEndObject(void* encoder) {
+    return static_cast<Encoder*>(encoder)->EndObject();
+}
+
+bool EncoderStartArray(void* encoder) {
+    return static_cast<Encoder*>(encoder)->StartArray();
+}
+
+bool EncoderEndArray(void* encoder) {
+    return static_cast<Encoder*>(encoder)->EndArray();
+}
+
+bool EncoderKey(void* encoder, const char* str, size_t length) {
+    return static_cast<Encoder*>(encoder)->Key(str, length);
+}
+
+bool EncoderNull(void* encoder) {
+    return static_cast<Encoder*>(encoder)->Null();
+}
+
+bool EncoderBool(void* encoder, bool b) {
+    return static_cast<Encoder*>(encoder)->Bool(b);
+}
+
+bool EncoderInt64(void* encoder, int64_t i) {
+    return static_cast<Encoder*>(encoder)->Int64(i);
+}
+
+bool EncoderUint64(void* encoder, uint64_t u) {
+    return static_cast<Encoder*>(encoder)->Uint64(u);
+}
+
+bool EncoderDouble(void* encoder, double d) {
+    return static_cast<Encoder*>(encoder)->Double(d);
+}
+
+bool EncoderString(void* encoder, const char* str, size_t length) {
+    return static_cast<Encoder*>(encoder)->String(str, length);
+}
+
+bool EncoderValue(void* encoder, void* value) {
+    return static_cast<Encoder*>(encoder)->Accept(static_cast<Value*>(value));
+}
@@ -2,45 +2,112 @@ package rapid
 
 // #include <stdlib.h>
 // #include <stdbool.h>
+// #include <stdint.h>
 // #include "rapid.h"
 import "C"
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"iter"
 	"runtime"
-	"strings"
 	"unsafe"
 
 	"github.com/anantn/jog"
+	"github.com/anantn/jog/internal/lazy"
+	"github.com/anantn/jog/internal/number"
 )
 
+// A parsed value is safe to read from many goroutines at once: the document
+// is never modified after parsing and every getter only reads it.
 type rapidValue struct {
 	clean unsafe.Pointer
 	value unsafe.Pointer
+	// The value owning the document, or nil if this is the root. Children
+	// keep it reachable so its finalizer can't free the document under them.
+	root *rapidValue
+	// The Parser holding the document, or nil if the root owns it.
+	parser *Parser
+	// Bytes of native memory held by the document, set on the root.
+	memory int
+}
+
+func init() {
+	jog.RegisterStats("rapid", Stats)
+}
+
+// Stats returns the native memory counters of this backend.
+func Stats() jog.MemoryStats {
+	var stats C.MemoryStats
+	C.GetMemoryStats(&stats)
+	return jog.MemoryStats{
+		InUse:      int64(stats.inUse),
+		TotalAlloc: int64(stats.totalAlloc),
+		Mallocs:    int64(stats.mallocs),
+		Frees:      int64(stats.frees),
+	}
 }
 
 // Constructor by string.
 func New(val string) (jog.Value, error) {
-	var cerr *C.char
-	cval := C.CString(val)
-	doc := C.NewDocument(cval, &cerr)
-	if doc == nil {
-		msg := C.GoString(cerr)
-		C.free(unsafe.Pointer(cval))
-		C.free(unsafe.Pointer(cerr))
-		return nil, errors.New(msg)
-	}
+	return parse(copyInput(unsafe.Slice(unsafe.StringData(val), len(val))), len(val), nil)
+}
 
-	obj := &rapidValue{unsafe.Pointer(cval), doc}
-	runtime.SetFinalizer(obj, cleanupDocument)
-	return obj, nil
+// Constructor by bytes, in the encoding given by opts. Input that is not
+// UTF-8 is transcoded by rapidjson while parsing.
+func NewWithOptions(data []byte, opts jog.Options) (jog.Value, error) {
+	return NewContext(context.Background(), data, opts)
+}
+
+// Constructor by bytes that stops parsing once ctx is done, returning
+// ctx.Err() wrapped with the offset reached. A document exceeding
+// opts.Limits returns a *jog.LimitError.
+func NewContext(ctx context.Context, data []byte, opts jog.Options) (jog.Value, error) {
+	return parseContext(ctx, data, opts, nil)
+}
+
+// Parse data into the pools of p, or into a document of its own if p is nil.
+func parseContext(ctx context.Context, data []byte, opts jog.Options, p *Parser) (jog.Value, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := opts.Limits.CheckSize(len(data)); err != nil {
+		return nil, err
+	}
+	var control *C.ParseControl
+	if ctx.Done() != nil || opts.Limits != (jog.Limits{}) {
+		control = (*C.ParseControl)(C.calloc(1, C.sizeof_ParseControl))
+		defer C.free(unsafe.Pointer(control))
+		control.maxDepth = C.size_t(max(opts.Limits.MaxDepth, 0))
+		control.maxStringLength = C.size_t(max(opts.Limits.MaxStringLength, 0))
+		control.maxMembers = C.size_t(max(opts.Limits.MaxMembers, 0))
+		control.maxMemory = C.size_t(max(opts.Limits.MaxMemory, 0))
+	}
+	stop := watch(ctx, control)
+	var v jog.Value
+	var err error
+	if opts.Lazy {
+		v, err = parseLazy(data, opts, control)
+	} else {
+		v, err = parseBytes(data, opts, control, p)
+	}
+	if stop() && err != nil {
+		return nil, fmt.Errorf("[%d] Parsing was canceled: %w", int(control.offset), ctx.Err())
+	}
+	if control != nil && control.exceeded != 0 {
+		limit := jog.Limit(control.exceeded)
+		return nil, &jog.LimitError{Limit: limit, Max: opts.Limits.Get(limit), Offset: int(control.offset)}
+	}
+	return v, err
 }
 
 // Data Getters.
 func (j *rapidValue) Get(path ...string) (jog.Value, error) {
+	defer runtime.KeepAlive(j)
 	if len(path) == 0 {
-		return j, nil
+		return j.self(), nil
 	}
 
 	pathPtr := convertPath(path)
@@ -49,51 +116,68 @@ func (j *rapidValue) Get(path ...string) (jog.Value, error) {
 	}
 	childval := C.Get(j.value, pathPtr)
 	if childval == nil {
-		return nil, fmt.Errorf("Could not find a child at %s", strings.Join(path, "/"))
+		return nil, j.lookupError("value", path, pathPtr)
 	}
-	return &rapidValue{nil, childval}, nil
+	return j.child(childval), nil
 }
 
-func (j *rapidValue) GetInt(path ...string) (int, error) {
-	pathPtr := convertPath(path)
-	if pathPtr != nil {
-		defer C.free(unsafe.Pointer(pathPtr.keys))
+func (j *rapidValue) At(path *jog.Path) (jog.Value, error) {
+	defer runtime.KeepAlive(j)
+	compiled := path.Compiled("rapid", compilePath).(*rapidPath)
+	defer runtime.KeepAlive(compiled)
+	if compiled.path == nil {
+		return j.self(), nil
 	}
 
-	intval, err := C.GetInt(j.value, pathPtr)
+	childval := C.Get(j.value, compiled.path)
+	if childval == nil {
+		return nil, j.lookupError("value", path.Segments(), compiled.path)
+	}
+	return j.child(childval), nil
+}
+
+func (j *rapidValue) GetInt(path ...string) (int, error) {
+	n, err := j.getNumber("int", path)
+	if err != nil {
+		return 0, err
+	}
+	i, err := n.Int()
 	if err != nil {
-		return 0, fmt.Errorf("Could not find int value at %s", strings.Join(path, "/"))
+		return 0, jog.NumberError(err, "int", path)
 	}
-	return int(intval), nil
+	return i, nil
 }
 
 func (j *rapidValue) GetUInt(path ...string) (uint, error) {
-	pathPtr := convertPath(path)
-	if pathPtr != nil {
-		defer C.free(unsafe.Pointer(pathPtr.keys))
+	n, err := j.getNumber("uint", path)
+	if err != nil {
+		return 0, err
 	}
-
-	uintval, err := C.GetUInt(j.value, pathPtr)
+	u, err := n.Uint()
 	if err != nil {
-		return 0, fmt.Errorf("Could not find uint value at %s", strings.Join(path, "/"))
+		return 0, jog.NumberError(err, "uint", path)
 	}
-	return uint(uintval), nil
+	return u, nil
 }
 
 func (j *rapidValue) GetFloat(path ...string) (float64, error) {
-	pathPtr := convertPath(path)
-	if pathPtr != nil {
-		defer C.free(unsafe.Pointer(pathPtr.keys))
+	n, err := j.getNumber("float", path)
+	if err != nil {
+		return 0, err
 	}
+	return n.Approx(), nil
+}
 
-	dval, err := C.GetDouble(j.value, pathPtr)
+func (j *rapidValue) NumberKind(path ...string) (jog.NumberKind, error) {
+	n, err := j.getNumber("number", path)
 	if err != nil {
-		return 0, fmt.Errorf("Could not find float value at %s", strings.Join(path, "/"))
+		return 0, err
 	}
-	return float64(dval), nil
+	return jog.NumberKind(n.Flags()), nil
 }
 
 func (j *rapidValue) GetBool(path ...string) (bool, error) {
+	defer runtime.KeepAlive(j)
 	pathPtr := convertPath(path)
 	if pathPtr != nil {
 		defer C.free(unsafe.Pointer(pathPtr.keys))
@@ -101,12 +185,13 @@ func (j *rapidValue) GetBool(path ...string) (bool, error) {
 
 	bval, err := C.GetBool(j.value, pathPtr)
 	if err != nil {
-		return false, fmt.Errorf("Could not find bool value at %s", strings.Join(path, "/"))
+		return false, j.lookupError("bool", path, pathPtr)
 	}
 	return bool(bval), nil
 }
 
 func (j *rapidValue) GetString(path ...string) (string, error) {
+	defer runtime.KeepAlive(j)
 	pathPtr := convertPath(path)
 	if pathPtr != nil {
 		defer C.free(unsafe.Pointer(pathPtr.keys))
@@ -114,12 +199,13 @@ func (j *rapidValue) GetString(path ...string) (string, error) {
 
 	strval := C.GetString(j.value, pathPtr)
 	if strval == nil {
-		return "", fmt.Errorf("Could not find string value at %s", strings.Join(path, "/"))
+		return "", j.lookupError("string", path, pathPtr)
 	}
 	return C.GoString(strval), nil
 }
 
 func (j *rapidValue) GetArray(path ...string) ([]jog.Value, error) {
+	defer runtime.KeepAlive(j)
 	pathPtr := convertPath(path)
 	if pathPtr != nil {
 		defer C.free(unsafe.Pointer(pathPtr.keys))
@@ -129,7 +215,7 @@ func (j *rapidValue) GetArray(path ...string) ([]jog.Value, error) {
 	arrval := C.GetArray(j.value, pathPtr, &arrlen)
 
 	if arrval == nil {
-		return []jog.Value{}, fmt.Errorf("Could not find array value at %s", strings.Join(path, "/"))
+		return []jog.Value{}, j.lookupError("array", path, pathPtr)
 	}
 
 	length := int(arrlen)
@@ -143,13 +229,14 @@ func (j *rapidValue) GetArray(path ...string) ([]jog.Value, error) {
 	array := make([]jog.Value, length)
 	for i := 0; i < length; i++ {
 		ptr := (*unsafe.Pointer)(unsafe.Pointer(uintptr(unsafe.Pointer(arrval)) + uintptr(i)*ptrSize))
-		array[i] = &rapidValue{unsafe.Pointer(arrval), *ptr}
+		array[i] = j.child(*ptr)
 	}
-	runtime.SetFinalizer(&array, cleanupArray)
+	C.free(unsafe.Pointer(arrval))
 	return array, nil
 }
 
 func (j *rapidValue) GetObject(path ...string) (map[string]jog.Value, error) {
+	defer runtime.KeepAlive(j)
 	pathPtr := convertPath(path)
 	if pathPtr != nil {
 		defer C.free(unsafe.Pointer(pathPtr.keys))
@@ -159,7 +246,7 @@ func (j *rapidValue) GetObject(path ...string) (map[string]jog.Value, error) {
 	var memlen C.size_t
 	objval := C.GetObject(j.value, pathPtr, &memlen, &keys)
 	if objval == nil {
-		return nil, fmt.Errorf("Could not find object value at %s", strings.Join(path, "/"))
+		return nil, j.lookupError("object", path, pathPtr)
 	}
 
 	length := int(memlen)
@@ -175,20 +262,138 @@ func (j *rapidValue) GetObject(path ...string) (map[string]jog.Value, error) {
 		ptr := (*unsafe.Pointer)(unsafe.Pointer(uintptr(unsafe.Pointer(objval)) + uintptr(i)*ptrSize))
 		keyPtr := (**C.char)(unsafe.Pointer(uintptr(unsafe.Pointer(keys)) + uintptr(i)*charSize))
 		keyVal := C.GoString(*keyPtr)
-		members[keyVal] = &rapidValue{nil, *ptr}
+		members[keyVal] = j.child(*ptr)
 	}
 	C.free(unsafe.Pointer(objval))
 	C.free(unsafe.Pointer(keys))
 	return members, nil
 }
 
+func (j *rapidValue) Len(path ...string) (int, error) {
+	defer runtime.KeepAlive(j)
+	pathPtr := convertPath(path)
+	if pathPtr != nil {
+		defer C.free(unsafe.Pointer(pathPtr.keys))
+	}
+
+	length := C.Len(j.value, pathPtr)
+	if length < 0 {
+		return 0, j.lookupError("array or object", path, pathPtr)
+	}
+	return int(length), nil
+}
+
+func (j *rapidValue) Index(i int, path ...string) (jog.Value, error) {
+	e, err := j.element("value", i, path)
+	if err != nil {
+		return nil, err
+	}
+	return j.child(e.value), nil
+}
+
+func (j *rapidValue) IndexInt(i int, path ...string) (int, error) {
+	e, err := j.element("int", i, path)
+	if err != nil {
+		return 0, err
+	}
+	n, err := e.GetInt()
+	return n, jog.ElementError(err, path, i)
+}
+
+func (j *rapidValue) IndexUInt(i int, path ...string) (uint, error) {
+	e, err := j.element("uint", i, path)
+	if err != nil {
+		return 0, err
+	}
+	u, err := e.GetUInt()
+	return u, jog.ElementError(err, path, i)
+}
+
+func (j *rapidValue) IndexFloat(i int, path ...string) (float64, error) {
+	e, err := j.element("float", i, path)
+	if err != nil {
+		return 0, err
+	}
+	f, err := e.GetFloat()
+	return f, jog.ElementError(err, path, i)
+}
+
+func (j *rapidValue) IndexBool(i int, path ...string) (bool, error) {
+	e, err := j.element("bool", i, path)
+	if err != nil {
+		return false, err
+	}
+	b, err := e.GetBool()
+	return b, jog.ElementError(err, path, i)
+}
+
+func (j *rapidValue) IndexString(i int, path ...string) (string, error) {
+	e, err := j.element("string", i, path)
+	if err != nil {
+		return "", err
+	}
+	str, err := e.GetString()
+	return str, jog.ElementError(err, path, i)
+}
+
+func (j *rapidValue) Elements(path ...string) iter.Seq2[int, jog.Value] {
+	return jog.Elements(j, path...)
+}
+
+func (j *rapidValue) ArrayIterator(path ...string) (jog.ArrayIterator, error) {
+	defer runtime.KeepAlive(j)
+	pathPtr := convertPath(path)
+	if pathPtr != nil {
+		defer C.free(unsafe.Pointer(pathPtr.keys))
+	}
+
+	var length, stride C.size_t
+	first := C.Elements(j.value, pathPtr, &length, &stride)
+	if first == nil {
+		return nil, j.lookupError("array", path, pathPtr)
+	}
+	return &rapidArrayIterator{
+		first:  first,
+		length: int(length),
+		stride: uintptr(stride),
+		index:  -1,
+		elem:   rapidValue{root: j.owner()},
+	}, nil
+}
+
+func (j *rapidValue) ObjectIterator(path ...string) (jog.ObjectIterator, error) {
+	defer runtime.KeepAlive(j)
+	pathPtr := convertPath(path)
+	if pathPtr != nil {
+		defer C.free(unsafe.Pointer(pathPtr.keys))
+	}
+
+	var length, stride, offset C.size_t
+	first := C.Members(j.value, pathPtr, &length, &stride, &offset)
+	if first == nil {
+		return nil, j.lookupError("object", path, pathPtr)
+	}
+	return &rapidObjectIterator{
+		first:  first,
+		length: int(length),
+		stride: uintptr(stride),
+		offset: uintptr(offset),
+		index:  -1,
+		elem:   rapidValue{root: j.owner()},
+	}, nil
+}
+
 func (j *rapidValue) Type(path ...string) jog.Type {
+	defer runtime.KeepAlive(j)
 	pathPtr := convertPath(path)
 	if pathPtr != nil {
 		defer C.free(unsafe.Pointer(pathPtr.keys))
 	}
 
 	ct := C.Type(j.value, pathPtr)
+	if ct == nil {
+		return jog.TypeMissing
+	}
 	switch C.GoString(ct) {
 	case "BOOL":
 		return jog.TypeBool
@@ -207,7 +412,16 @@ func (j *rapidValue) Type(path ...string) jog.Type {
 	return jog.TypeUnknown
 }
 
+func (j *rapidValue) Exists(path ...string) bool {
+	return j.Type(path...) != jog.TypeMissing
+}
+
+func (j *rapidValue) IsNull(path ...string) bool {
+	return j.Type(path...) == jog.TypeNull
+}
+
 func (j *rapidValue) Stringify(path ...string) (string, error) {
+	defer runtime.KeepAlive(j)
 	pathPtr := convertPath(path)
 	if pathPtr != nil {
 		defer C.free(unsafe.Pointer(pathPtr.keys))
@@ -215,48 +429,401 @@ func (j *rapidValue) Stringify(path ...string) (string, error) {
 
 	strval := C.Stringify(j.value, pathPtr)
 	if strval == nil {
-		return "", fmt.Errorf("Could not stringify value because it's not an object or array (%s)", strings.Join(path, "/"))
+		return "", j.lookupError("value", path, pathPtr)
 	}
 	ret := C.GoString(strval)
 	C.free(unsafe.Pointer(strval))
 	return ret, nil
 }
 
+func (j *rapidValue) Extract(fields []jog.Field, results []jog.Result) {
+	defer runtime.KeepAlive(j)
+	if len(fields) == 0 {
+		return
+	}
+
+	cfields := make([]C.ExtractField, len(fields))
+	for i, field := range fields {
+		path := field.Path.Compiled("rapid", compilePath).(*rapidPath)
+		if path.path != nil {
+			cfields[i].path = *path.path
+		}
+	}
+	C.Extract(j.value, &cfields[0], C.size_t(len(cfields)))
+	runtime.KeepAlive(fields)
+
+	for i, field := range cfields {
+		r := &results[i]
+		if field.value == nil {
+			r.Status = jog.FieldMissing
+			continue
+		}
+		r.Type = rapidType(field._type)
+		switch r.Type {
+		case jog.TypeBool:
+			r.Bool = field._type == kTrueType
+		case jog.TypeNumber:
+			r.Float = float64(field.d)
+			r.Int, r.Integer = int64(field.i), bool(field.isInt)
+		case jog.TypeString:
+			r.String = C.GoStringN(field.str, C.int(field.length))
+		case jog.TypeArray, jog.TypeObject:
+			r.Value = j.child(field.value)
+		}
+		if fields[i].Type == jog.TypeUnknown {
+			r.Value = j.child(field.value)
+		}
+	}
+}
+
+func (j *rapidValue) MemoryUsage() int {
+	if j.root != nil {
+		return j.root.memory
+	}
+	return j.memory
+}
+
 // Private methods.
 
+// The rapidjson Type enum.
+const (
+	kNullType = iota
+	kFalseType
+	kTrueType
+	kObjectType
+	kArrayType
+	kStringType
+	kNumberType
+)
+
+func rapidType(t C.int) jog.Type {
+	switch t {
+	case kNullType:
+		return jog.TypeNull
+	case kFalseType, kTrueType:
+		return jog.TypeBool
+	case kObjectType:
+		return jog.TypeObject
+	case kArrayType:
+		return jog.TypeArray
+	case kStringType:
+		return jog.TypeString
+	case kNumberType:
+		return jog.TypeNumber
+	}
+	return jog.TypeUnknown
+}
+
+// The number at path, in the form rapidjson keeps it.
+func (j *rapidValue) getNumber(name string, path []string) (number.Number, error) {
+	defer runtime.KeepAlive(j)
+	pathPtr := convertPath(path)
+	if pathPtr != nil {
+		defer C.free(unsafe.Pointer(pathPtr.keys))
+	}
+
+	var i C.int64_t
+	var u C.uint64_t
+	var d C.double
+	switch C.GetNumber(j.value, pathPtr, &i, &u, &d) {
+	case C.NumberInt:
+		return number.Number{Kind: number.Int, I: int64(i)}, nil
+	case C.NumberUint:
+		return number.Number{Kind: number.Uint, U: uint64(u)}, nil
+	case C.NumberDouble:
+		return number.Number{Kind: number.Float, F: float64(d)}, nil
+	}
+	return number.Number{}, j.lookupError(name, path, pathPtr)
+}
+
+// The error for a getter that found nothing it could return at path.
+func (j *rapidValue) lookupError(expected string, path []string, pathPtr *C.struct_Path) error {
+	var depth C.size_t
+	t := rapidType(C.Locate(j.value, pathPtr, &depth))
+	if int(depth) < len(path) {
+		return jog.NotFoundError(path, int(depth), expected, t)
+	}
+	return jog.MismatchError(path, expected, t)
+}
+
+// j itself if it is the root, which holds the document, or else a new
+// wrapper of its value, in case j is reused by an iterator.
+func (j *rapidValue) self() *rapidValue {
+	if j.root == nil {
+		return j
+	}
+	return j.child(j.value)
+}
+
+// Wrap a value of the document owned by j.
+func (j *rapidValue) child(value unsafe.Pointer) *rapidValue {
+	return &rapidValue{value: value, root: j.owner()}
+}
+
+// The value owning the document of j.
+func (j *rapidValue) owner() *rapidValue {
+	if j.root != nil {
+		return j.root
+	}
+	return j
+}
+
+// Element i of the array at path, wrapped without allocating for the Index
+// getters to read.
+func (j *rapidValue) element(expected string, i int, path []string) (rapidValue, error) {
+	defer runtime.KeepAlive(j)
+	pathPtr := convertPath(path)
+	if pathPtr != nil {
+		defer C.free(unsafe.Pointer(pathPtr.keys))
+	}
+
+	if i >= 0 {
+		if value := C.Index(j.value, pathPtr, C.size_t(i)); value != nil {
+			return rapidValue{value: value, root: j.owner()}, nil
+		}
+	}
+	var depth C.size_t
+	if rapidType(C.Locate(j.value, pathPtr, &depth)) == jog.TypeArray && int(depth) == len(path) {
+		return rapidValue{}, jog.OutOfRangeError(path, i, expected)
+	}
+	return rapidValue{}, j.lookupError("array", path, pathPtr)
+}
+
+// The iterators step through the elements or members where rapidjson stores
+// them, stride bytes apart, and wrap each in turn with elem.
+type rapidArrayIterator struct {
+	first  unsafe.Pointer
+	length int
+	stride uintptr
+	index  int
+	elem   rapidValue
+}
+
+func (it *rapidArrayIterator) Next() bool {
+	if it.index+1 >= it.length {
+		it.index = it.length
+		return false
+	}
+	it.index++
+	it.elem.value = unsafe.Add(it.first, uintptr(it.index)*it.stride)
+	return true
+}
+
+func (it *rapidArrayIterator) Index() int {
+	return it.index
+}
+
+func (it *rapidArrayIterator) Value() jog.Value {
+	if it.index < 0 || it.index >= it.length {
+		return nil
+	}
+	return &it.elem
+}
+
+type rapidObjectIterator struct {
+	first  unsafe.Pointer
+	length int
+	stride uintptr
+	offset uintptr
+	index  int
+	member unsafe.Pointer
+	elem   rapidValue
+}
+
+func (it *rapidObjectIterator) Next() bool {
+	if it.index+1 >= it.length {
+		it.index = it.length
+		return false
+	}
+	it.index++
+	it.member = unsafe.Add(it.first, uintptr(it.index)*it.stride)
+	it.elem.value = unsafe.Add(it.member, it.offset)
+	return true
+}
+
+func (it *rapidObjectIterator) Key() string {
+	defer runtime.KeepAlive(it)
+	if it.index < 0 || it.index >= it.length {
+		return ""
+	}
+	var length C.size_t
+	key := C.MemberKey(it.member, &length)
+	return C.GoStringN(key, C.int(length))
+}
+
+func (it *rapidObjectIterator) Value() jog.Value {
+	if it.index < 0 || it.index >= it.length {
+		return nil
+	}
+	return &it.elem
+}
+
+// Copy data into a NUL-terminated C string, counted like the documents.
+func copyInput(data []byte) *C.char {
+	cval := (*C.char)(C.CountedMalloc(C.size_t(len(data) + 1)))
+	buf := unsafe.Slice((*byte)(unsafe.Pointer(cval)), len(data)+1)
+	copy(buf, data)
+	buf[len(data)] = 0
+	return cval
+}
+
+// Parse a C string of length bytes in place. The string is freed along with
+// the document.
+func parse(cval *C.char, length int, control *C.ParseControl) (jog.Value, error) {
+	var cerr *C.char
+	doc := C.NewDocument(cval, C.size_t(length), control, &cerr)
+	if doc == nil {
+		msg := C.GoString(cerr)
+		C.CountedFree(unsafe.Pointer(cval))
+		C.free(unsafe.Pointer(cerr))
+		return nil, errors.New(msg)
+	}
+
+	obj := &rapidValue{clean: unsafe.Pointer(cval), value: doc, memory: int(C.DocumentMemory(doc)) + length + 1}
+	runtime.SetFinalizer(obj, cleanupDocument)
+	return obj, nil
+}
+
+// A document parsed by p is freed by it instead of by a finalizer.
+func parseBytes(data []byte, opts jog.Options, control *C.ParseControl, p *Parser) (jog.Value, error) {
+	if opts.Encoding == jog.EncodingUTF8 && p == nil {
+		return parse(copyInput(data), len(data), control)
+	}
+
+	encoding := opts.Encoding
+	if encoding == jog.EncodingAuto {
+		// A byte order mark or the RFC 4627 pattern overrides the default.
+		encoding = jog.EncodingUTF8
+	} else if encoding < jog.EncodingUTF8 || encoding > jog.EncodingAuto {
+		return nil, fmt.Errorf("Unknown encoding %d!", int(encoding))
+	}
+
+	var cerr *C.char
+	cdata := (*C.char)(unsafe.Pointer(unsafe.SliceData(data)))
+	var doc unsafe.Pointer
+	switch {
+	case p == nil:
+		doc = C.NewDocumentEncoded(cdata, C.size_t(len(data)), C.int(encoding), control, &cerr)
+	case opts.Encoding == jog.EncodingUTF8:
+		doc = C.ParserParse(p.parser, cdata, C.size_t(len(data)), control, &cerr)
+	default:
+		doc = C.ParserParseEncoded(p.parser, cdata, C.size_t(len(data)), C.int(encoding), control, &cerr)
+	}
+	if doc == nil {
+		msg := C.GoString(cerr)
+		C.free(unsafe.Pointer(cerr))
+		return nil, errors.New(msg)
+	}
+
+	obj := &rapidValue{value: doc, parser: p}
+	if p == nil {
+		obj.memory = int(C.DocumentMemory(doc))
+		runtime.SetFinalizer(obj, cleanupDocument)
+	} else {
+		obj.memory = int(C.ParserMemory(p.parser))
+	}
+	return obj, nil
+}
+
+// Validate data and keep a copy of it as a lazy value, which parses the
+// subtrees it needs like New.
+func parseLazy(data []byte, opts jog.Options, control *C.ParseControl) (jog.Value, error) {
+	if opts.Encoding != jog.EncodingUTF8 {
+		var err error
+		data, err = jog.Transcode(data, opts.Encoding)
+		if err != nil {
+			return nil, err
+		}
+	}
+	data = bytes.Clone(data)
+
+	var cerr *C.char
+	cdata := (*C.char)(unsafe.Pointer(unsafe.SliceData(data)))
+	if !C.ValidateDocument(cdata, C.size_t(len(data)), control, &cerr) {
+		msg := C.GoString(cerr)
+		C.free(unsafe.Pointer(cerr))
+		return nil, errors.New(msg)
+	}
+	return lazy.New(data, func(span []byte) (jog.Value, error) {
+		return parse(copyInput(span), len(span), nil)
+	}), nil
+}
+
+// Cancel the parse behind control once ctx is done. The returned function
+// stops watching and reports whether the parse was canceled.
+func watch(ctx context.Context, control *C.ParseControl) func() bool {
+	if control == nil || ctx.Done() == nil {
+		return func() bool { return false }
+	}
+	stop := make(chan struct{})
+	canceled := make(chan bool)
+	go func() {
+		select {
+		case <-ctx.Done():
+			C.CancelParse(control)
+			canceled <- true
+		case <-stop:
+			canceled <- false
+		}
+	}()
+	return func() bool {
+		close(stop)
+		return <-canceled
+	}
+}
+
 // Finalizer to call the Document destructor.
 func cleanupDocument(j jog.Value) {
 	rapidValue, ok := j.(*rapidValue)
 	if !ok {
 		panic("cleanupDocument called on non rapidValue object!")
 	}
-	C.free(rapidValue.clean)
+	C.CountedFree(rapidValue.clean)
 	C.DeleteDocument(rapidValue.value)
 }
 
-// Finalizer to call the Array destructor.
-func cleanupArray(a *[]jog.Value) {
-	arr := *a
-	rapidValue, ok := arr[0].(*rapidValue)
-	if !ok {
-		panic("cleanupArray called on non rapidValue object!")
-	}
-	C.free(rapidValue.clean)
-}
-
-// Utility function to convert a Go slice to C struct.
-// Caller must free C.struct_Path.keys!
+// Utility function to convert a Go slice to C struct. The key lengths and
+// the keys are stored after the array pointing at them, so the caller only
+// has to free C.struct_Path.keys. Keys are found by their length, so one
+// holding a NUL byte doesn't match the key it starts with.
 func convertPath(path []string) *C.struct_Path {
 	if len(path) == 0 {
 		return nil
 	}
 
 	var c *C.char
-	ptrSize := unsafe.Sizeof(c)
-	ptr := C.malloc(C.size_t(len(path)) * C.size_t(ptrSize))
-	for i := 0; i < len(path); i++ {
-		element := (**C.char)(unsafe.Pointer(uintptr(ptr) + uintptr(i)*ptrSize))
-		*element = C.CString(path[i])
+	var n C.size_t
+	lengthsAt := len(path) * int(unsafe.Sizeof(c))
+	offset := lengthsAt + len(path)*int(unsafe.Sizeof(n))
+	size := offset
+	for _, key := range path {
+		size += len(key) + 1
+	}
+	ptr := C.malloc(C.size_t(size))
+	keys := unsafe.Slice((**C.char)(ptr), len(path))
+	lengths := unsafe.Slice((*C.size_t)(unsafe.Add(ptr, lengthsAt)), len(path))
+	buf := unsafe.Slice((*byte)(ptr), size)
+	for i, key := range path {
+		keys[i] = (*C.char)(unsafe.Pointer(&buf[offset]))
+		lengths[i] = C.size_t(len(key))
+		offset += copy(buf[offset:], key)
+		buf[offset] = 0
+		offset++
+	}
+	return &C.struct_Path{keys: (**C.char)(ptr), keyLengths: &lengths[0], length: C.size_t(len(path))}
+}
+
+// A path converted for At, freed along with the jog.Path keeping it.
+type rapidPath struct {
+	path *C.struct_Path
+}
+
+func compilePath(segments []string) any {
+	p := &rapidPath{convertPath(segments)}
+	if p.path != nil {
+		runtime.SetFinalizer(p, func(p *rapidPath) {
+			C.free(unsafe.Pointer(p.path.keys))
+		})
 	}
-	return &C.struct_Path{(**C.char)(ptr), C.size_t(len(path))}
+	return p
 }
@@ -5,24 +5,89 @@ extern "C" {
 // A path is an array of keys + length.
 typedef struct Path {
 	char** keys;
+	// The length of each key, which may hold NUL bytes.
+	size_t* keyLengths;
 	size_t length;
 } Path;
 
-// If the return value is NULL, an error message will be stored in *error.
-// The caller must free the error message if present.
-void* NewDocument(char* string, char** error);
+// Shared between Go and a running parse. Go sets canceled with CancelParse
+// from another thread and the parser checks it before every value. A limit
+// of zero is not enforced; exceeded is set to the jog.Limit that stopped
+// the parse. offset is set to where a failed parse stopped.
+typedef struct ParseControl {
+	int canceled;
+	size_t maxDepth;
+	size_t maxStringLength;
+	size_t maxMembers;
+	size_t maxMemory;
+	int exceeded;
+	size_t offset;
+} ParseControl;
+
+void CancelParse(ParseControl* control);
+
+// All native memory of documents, parsers and encoders is allocated through
+// these, so that it is counted in the MemoryStats.
+typedef struct MemoryStats {
+	int64_t inUse;
+	int64_t totalAlloc;
+	int64_t mallocs;
+	int64_t frees;
+} MemoryStats;
+
+void* CountedMalloc(size_t size);
+void* CountedRealloc(void* ptr, size_t size);
+void  CountedFree(void* ptr);
+void  GetMemoryStats(MemoryStats* stats);
+
+// Parse a NUL-terminated string of length bytes in place. If the return
+// value is NULL, an error message will be stored in *error. The caller must
+// free the error message if present. control may be NULL.
+void* NewDocument(char* string, size_t length, ParseControl* control, char** error);
+// Parse length bytes of data in the given rapidjson UTFType, or detect the
+// encoding if a byte order mark is present. data is not modified or kept.
+void* NewDocumentEncoded(const char* data, size_t length, int encoding, ParseControl* control, char** error);
+// Check length bytes of UTF-8 data like NewDocument without building a
+// document. Returns false and stores an error message in *error if invalid.
+bool  ValidateDocument(const char* data, size_t length, ParseControl* control, char** error);
 void  DeleteDocument(void* value);
+// The bytes of native memory held by a document, excluding its input.
+size_t DocumentMemory(void* value);
+
+// A parser reuses its memory pools and input buffer for every document. The
+// value it returns must not be deleted and is only valid until the next
+// parse or reset. ParserParse copies UTF-8 data and parses it in place;
+// ParserParseEncoded reads data like NewDocumentEncoded. NewParser returns
+// NULL if the pools can't be allocated.
+void* NewParser(void);
+void  DeleteParser(void* parser);
+void  ResetParser(void* parser);
+void* ParserParse(void* parser, const char* data, size_t length, ParseControl* control, char** error);
+void* ParserParseEncoded(void* parser, const char* data, size_t length, int encoding, ParseControl* control, char** error);
+// The bytes of native memory used by the current document of a parser.
+size_t ParserMemory(void* parser);
 
 // Return the child value at given path. If the path is NULL, the provided
 // value is returned as-is.
 void*        Get(void* value, Path* path);
 
+// Follow path from value as far as it leads, setting depth to the number of
+// keys followed. Returns the rapidjson Type of the value reached, for errors.
+int          Locate(void* value, Path* path, size_t* depth);
+
 // Get data at a given path. errno will be set if there's an error.
 // If path is NULL, it will return the value at the current path.
-int          GetInt(void* value, Path* path);
 bool         GetBool(void* value, Path* path);
-double       GetDouble(void* value, Path* path);
-unsigned int GetUInt(void* value, Path* path);
+
+// How GetNumber returned a number: integers in the int64 range in i, larger
+// ones in u, and others in d. -1 if there is no number at path.
+enum NumberKinds {
+	NumberInt,
+	NumberUint,
+	NumberDouble
+};
+
+int          GetNumber(void* value, Path* path, int64_t* i, uint64_t* u, double* d);
 
 // Don't free the return the value. NULL will be returned if there's an error.
 const char*  GetString(void* value, Path* path);
@@ -30,6 +95,24 @@ const char*  GetString(void* value, Path* path);
 // Caller must free the array of returned pointers.
 void**       GetArray(void* value, Path* path, size_t* length);
 
+// The number of elements of the array or members of the object at path, or
+// -1 if there is neither.
+int64_t      Len(void* value, Path* path);
+
+// Element i of the array at path, or NULL if there is no such element.
+void*        Index(void* value, Path* path, size_t i);
+
+// The first element of the array at path, or NULL if there is no array.
+// The elements are stored stride bytes apart.
+void*        Elements(void* value, Path* path, size_t* length, size_t* stride);
+
+// The first member of the object at path, or NULL if there is no object.
+// The members are stored stride bytes apart, each with its value at offset.
+void*        Members(void* value, Path* path, size_t* length, size_t* stride, size_t* offset);
+
+// The key of a member returned by Members. Don't free it.
+const char*  MemberKey(void* member, size_t* length);
+
 // Caller must free the array of returned pointers and the keys array.
 void**       GetObject(void* value, Path* path, size_t* length, char*** keys);
 
@@ -40,6 +123,53 @@ const char*  Type(void* value, Path* path);
 // Return a stringified version of the value. Caller must free.
 char*  Stringify(void* value, Path* path);
 
+// A field for Extract: the path to follow, and what was found there. type is
+// the rapidjson Type found, or -1 if the path is missing. Numbers set d, and
+// i along with isInt if they are integers that fit in an int64. Strings
+// point into the document.
+typedef struct ExtractField {
+	Path path;
+	void* value;
+	int type;
+	bool isInt;
+	int64_t i;
+	double d;
+	const char* str;
+	size_t length;
+} ExtractField;
+
+// Look up count fields under value at once.
+void   Extract(void* value, ExtractField* fields, size_t count);
+
+// An encoder writes tokens to the Go writer registered under handle. The
+// token functions return false if the writer rejected the token; the caller
+// is responsible for only passing a valid sequence.
+enum EncoderFlags {
+	EncoderASCII         = 1,
+	EncoderEscapeHTML    = 2,
+	EncoderEscapeSolidus = 4,
+	EncoderValidateUTF8  = 8
+};
+
+void* NewEncoder(uintptr_t handle, int flags);
+void  DeleteEncoder(void* encoder);
+void  EncoderFlush(void* encoder);
+
+bool  EncoderStartObject(void* encoder);
+bool  EncoderEndObject(void* encoder);
+bool  EncoderStartArray(void* encoder);
+bool  EncoderEndArray(void* encoder);
+bool  EncoderKey(void* encoder, const char* str, size_t length);
+bool  EncoderNull(void* encoder);
+bool  EncoderBool(void* encoder, bool b);
+bool  EncoderInt64(void* encoder, int64_t i);
+bool  EncoderUint64(void* encoder, uint64_t u);
+bool  EncoderDouble(void* encoder, double d);
+bool  EncoderString(void* encoder, const char* str, size_t length);
+
+// Write a whole value of a document.
+bool  EncoderValue(void* encoder, void* value);
+
 #ifdef __cplusplus
 }
 #endif
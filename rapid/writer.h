@@ -298,8 +298,8 @@ protected:
                     os_->Put(hexDigits[(unsigned char)c & 0xF]);
                 }
             }
-            else
-                Transcoder<SourceEncoding, TargetEncoding>::Transcode(is, *os_);
+            else if (!Transcoder<SourceEncoding, TargetEncoding>::Transcode(is, *os_))
+                return false;   // invalid code unit
         }
         os_->Put('\"');
         return true;
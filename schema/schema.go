@@ -0,0 +1,633 @@
+// Package schema validates jog values against JSON Schema documents.
+//
+// Schemas follow draft 2020-12: the core vocabulary (including the
+// applicator and unevaluated vocabularies) plus the validation vocabulary.
+// "format" is treated as an annotation and never asserted. Regular
+// expressions in "pattern" and "patternProperties" are compiled with Go's
+// regexp package, which is close to, but not identical to, ECMA 262.
+//
+// Schemas are loaded through any jog backend:
+//
+//	doc, _ := rapid.New(`{"type": "object", "required": ["id"]}`)
+//	s, err := schema.Compile(doc)
+//	...
+//	err = s.Validate(payload)
+package schema
+
+import (
+	"fmt"
+	"math/big"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/anantn/jog"
+)
+
+// Schema is a compiled JSON Schema. It is safe for concurrent use once
+// compiled.
+type Schema struct {
+	root *schema
+	// Schemas with a "$dynamicAnchor", by resource URI and anchor name.
+	dynamic map[string]map[string]*schema
+	// Keep the source documents alive, "enum" and "const" refer into them.
+	docs []jog.Value
+}
+
+// Compiler compiles schemas that may refer to other schema resources by URI.
+// Remote references are never fetched, every resource must be added first.
+type Compiler struct {
+	resources map[string]*resource
+	compiled  map[string]*schema
+	docs      []jog.Value
+	pending   []*schema
+}
+
+// NewCompiler returns an empty Compiler.
+func NewCompiler() *Compiler {
+	return &Compiler{
+		resources: make(map[string]*resource),
+		compiled:  make(map[string]*schema),
+	}
+}
+
+// Compile a single self-contained schema document.
+func Compile(doc jog.Value) (*Schema, error) {
+	return NewCompiler().Compile(doc)
+}
+
+// AddResource registers a schema document under the given URI, so that
+// other schemas can "$ref" it. A "$id" inside the document takes precedence.
+func (c *Compiler) AddResource(uri string, doc jog.Value) error {
+	base, err := normalizeURI(uri)
+	if err != nil {
+		return err
+	}
+	_, err = c.scan(doc, base, "")
+	if err != nil {
+		return err
+	}
+	c.docs = append(c.docs, doc)
+	return nil
+}
+
+// Compile the schema document. Any resources previously added with
+// AddResource may be referenced.
+func (c *Compiler) Compile(doc jog.Value) (*Schema, error) {
+	base, err := c.scan(doc, "", "")
+	if err != nil {
+		return nil, err
+	}
+	c.docs = append(c.docs, doc)
+
+	root, err := c.compile(doc, base, "")
+	if err != nil {
+		return nil, err
+	}
+	dynamic := make(map[string]map[string]*schema, len(c.resources))
+	for uri, res := range c.resources {
+		dynamic[uri] = make(map[string]*schema, len(res.dynamicAnchors))
+		for name := range res.dynamicAnchors {
+			dynamic[uri][name], err = c.lookup(uri, "#"+name)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	for len(c.pending) > 0 {
+		s := c.pending[0]
+		c.pending = c.pending[1:]
+		if err := c.resolveRefs(s); err != nil {
+			return nil, err
+		}
+	}
+	docs := make([]jog.Value, len(c.docs))
+	copy(docs, c.docs)
+	return &Schema{root, dynamic, docs}, nil
+}
+
+// A schema resource is a document, or a subschema with its own "$id".
+type resource struct {
+	uri            string
+	value          jog.Value
+	anchors        map[string]string
+	dynamicAnchors map[string]string
+}
+
+type schema struct {
+	// Absolute location of this schema, e.g. "urn:x#/properties/name".
+	location string
+	// Base URI of the resource this schema belongs to.
+	base string
+	// Set for "true" and "false" schemas.
+	always *bool
+
+	ref           string
+	refSchema     *schema
+	dynamicRef    string
+	dynamicSchema *schema
+	dynamicAnchor string
+
+	types         []string
+	enum          []jog.Value
+	constant      jog.Value
+	multipleOf    *big.Rat
+	maximum       *big.Rat
+	exclusiveMax  *big.Rat
+	minimum       *big.Rat
+	exclusiveMin  *big.Rat
+	maxLength     int
+	minLength     int
+	pattern       *regexp.Regexp
+	maxItems      int
+	minItems      int
+	uniqueItems   bool
+	maxContains   int
+	minContains   int
+	maxProperties int
+	minProperties int
+	required      []string
+	dependentReq  map[string][]string
+
+	allOf                 []*schema
+	anyOf                 []*schema
+	oneOf                 []*schema
+	not                   *schema
+	ifSchema              *schema
+	thenSchema            *schema
+	elseSchema            *schema
+	dependentSchemas      map[string]*schema
+	prefixItems           []*schema
+	items                 *schema
+	contains              *schema
+	properties            map[string]*schema
+	patternProperties     []patternSchema
+	additionalProperties  *schema
+	propertyNames         *schema
+	unevaluatedItems      *schema
+	unevaluatedProperties *schema
+}
+
+type patternSchema struct {
+	re     *regexp.Regexp
+	schema *schema
+}
+
+// Keywords whose values are data rather than schemas, skipped when scanning
+// for embedded resources and anchors.
+var dataKeywords = map[string]bool{
+	"enum": true, "const": true, "default": true, "examples": true,
+}
+
+// Walk a document, registering every resource and anchor it defines. Returns
+// the base URI of the document.
+func (c *Compiler) scan(doc jog.Value, base string, ptr string) (string, error) {
+	if doc.Type() != jog.TypeObject {
+		if ptr == "" {
+			c.resources[base] = &resource{base, doc, map[string]string{}, map[string]string{}}
+		}
+		return base, nil
+	}
+
+	id, err := doc.GetString("$id")
+	if err == nil {
+		base, err = resolveURI(base, id)
+		if err != nil {
+			return "", fmt.Errorf("Invalid $id at %s: %v", pointerOrRoot(ptr), err)
+		}
+		ptr = ""
+	}
+	if ptr == "" {
+		if _, ok := c.resources[base]; ok {
+			return "", fmt.Errorf("Duplicate schema resource %q", base)
+		}
+		c.resources[base] = &resource{base, doc, map[string]string{}, map[string]string{}}
+	}
+	res := c.resources[base]
+	if anchor, err := doc.GetString("$anchor"); err == nil {
+		res.anchors[anchor] = ptr
+	}
+	if anchor, err := doc.GetString("$dynamicAnchor"); err == nil {
+		res.anchors[anchor] = ptr
+		res.dynamicAnchors[anchor] = ptr
+	}
+
+	members, err := doc.GetObject()
+	if err != nil {
+		return "", err
+	}
+	for _, key := range sortedKeys(members) {
+		if dataKeywords[key] {
+			continue
+		}
+		if err := c.scanChild(members[key], base, ptr+"/"+escapePointer(key)); err != nil {
+			return "", err
+		}
+	}
+	return base, nil
+}
+
+func (c *Compiler) scanChild(v jog.Value, base string, ptr string) error {
+	switch v.Type() {
+	case jog.TypeObject:
+		_, err := c.scan(v, base, ptr)
+		return err
+	case jog.TypeArray:
+		elems, err := v.GetArray()
+		if err != nil {
+			return err
+		}
+		for i, elem := range elems {
+			if err := c.scanChild(elem, base, ptr+"/"+strconv.Itoa(i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) compile(v jog.Value, base string, ptr string) (*schema, error) {
+	if v.Type() == jog.TypeObject {
+		if id, err := v.GetString("$id"); err == nil {
+			base, err = resolveURI(base, id)
+			if err != nil {
+				return nil, err
+			}
+			ptr = ""
+		}
+	}
+	location := base + "#" + ptr
+	if s, ok := c.compiled[location]; ok {
+		return s, nil
+	}
+	s := &schema{location: location, base: base}
+	c.compiled[location] = s
+
+	switch v.Type() {
+	case jog.TypeBool:
+		b, _ := v.GetBool()
+		s.always = &b
+		return s, nil
+	case jog.TypeObject:
+	default:
+		return nil, fmt.Errorf("Schema at %s must be an object or a boolean", location)
+	}
+
+	members, err := v.GetObject()
+	if err != nil {
+		return nil, err
+	}
+	sub := func(key string) (*schema, error) {
+		return c.compile(members[key], base, ptr+"/"+escapePointer(key))
+	}
+	subArray := func(key string) ([]*schema, error) {
+		elems, err := members[key].GetArray()
+		if err != nil || len(elems) == 0 {
+			return nil, fmt.Errorf("%s at %s must be a non-empty array", key, location)
+		}
+		list := make([]*schema, len(elems))
+		for i, elem := range elems {
+			list[i], err = c.compile(elem, base, ptr+"/"+escapePointer(key)+"/"+strconv.Itoa(i))
+			if err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	}
+	subMap := func(key string) (map[string]*schema, error) {
+		props, err := members[key].GetObject()
+		if err != nil {
+			return nil, fmt.Errorf("%s at %s must be an object", key, location)
+		}
+		m := make(map[string]*schema, len(props))
+		for name, prop := range props {
+			m[name], err = c.compile(prop, base, ptr+"/"+escapePointer(key)+"/"+escapePointer(name))
+			if err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	}
+
+	s.maxLength, s.maxItems, s.maxContains, s.maxProperties = -1, -1, -1, -1
+	s.minContains = 1
+	for _, key := range sortedKeys(members) {
+		m := members[key]
+		switch key {
+		case "$ref":
+			s.ref, err = m.GetString()
+		case "$dynamicRef":
+			s.dynamicRef, err = m.GetString()
+		case "$dynamicAnchor":
+			s.dynamicAnchor, err = m.GetString()
+		case "type":
+			s.types, err = stringList(m)
+		case "enum":
+			s.enum, err = m.GetArray()
+		case "const":
+			s.constant = m
+		case "multipleOf":
+			s.multipleOf, err = number(m)
+			if err == nil && s.multipleOf.Sign() <= 0 {
+				err = fmt.Errorf("multipleOf must be strictly positive")
+			}
+		case "maximum":
+			s.maximum, err = number(m)
+		case "exclusiveMaximum":
+			s.exclusiveMax, err = number(m)
+		case "minimum":
+			s.minimum, err = number(m)
+		case "exclusiveMinimum":
+			s.exclusiveMin, err = number(m)
+		case "maxLength":
+			s.maxLength, err = count(m)
+		case "minLength":
+			s.minLength, err = count(m)
+		case "pattern":
+			s.pattern, err = pattern(m)
+		case "maxItems":
+			s.maxItems, err = count(m)
+		case "minItems":
+			s.minItems, err = count(m)
+		case "uniqueItems":
+			s.uniqueItems, err = m.GetBool()
+		case "maxContains":
+			s.maxContains, err = count(m)
+		case "minContains":
+			s.minContains, err = count(m)
+		case "maxProperties":
+			s.maxProperties, err = count(m)
+		case "minProperties":
+			s.minProperties, err = count(m)
+		case "required":
+			s.required, err = stringList(m)
+		case "dependentRequired":
+			var deps map[string]jog.Value
+			deps, err = m.GetObject()
+			s.dependentReq = make(map[string][]string, len(deps))
+			for name, dep := range deps {
+				if err != nil {
+					break
+				}
+				s.dependentReq[name], err = stringList(dep)
+			}
+		case "allOf":
+			s.allOf, err = subArray(key)
+		case "anyOf":
+			s.anyOf, err = subArray(key)
+		case "oneOf":
+			s.oneOf, err = subArray(key)
+		case "not":
+			s.not, err = sub(key)
+		case "if":
+			s.ifSchema, err = sub(key)
+		case "then":
+			s.thenSchema, err = sub(key)
+		case "else":
+			s.elseSchema, err = sub(key)
+		case "dependentSchemas":
+			s.dependentSchemas, err = subMap(key)
+		case "prefixItems":
+			s.prefixItems, err = subArray(key)
+		case "items":
+			s.items, err = sub(key)
+		case "contains":
+			s.contains, err = sub(key)
+		case "properties":
+			s.properties, err = subMap(key)
+		case "patternProperties":
+			var pats map[string]*schema
+			pats, err = subMap(key)
+			for _, p := range sortedKeys(pats) {
+				if err != nil {
+					break
+				}
+				var re *regexp.Regexp
+				re, err = regexp.Compile(p)
+				s.patternProperties = append(s.patternProperties, patternSchema{re, pats[p]})
+			}
+		case "additionalProperties":
+			s.additionalProperties, err = sub(key)
+		case "propertyNames":
+			s.propertyNames, err = sub(key)
+		case "unevaluatedItems":
+			s.unevaluatedItems, err = sub(key)
+		case "unevaluatedProperties":
+			s.unevaluatedProperties, err = sub(key)
+		case "$defs", "definitions":
+			_, err = subMap(key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s at %s: %v", key, location, err)
+		}
+	}
+	if s.ref != "" || s.dynamicRef != "" {
+		c.pending = append(c.pending, s)
+	}
+	return s, nil
+}
+
+// Resolve "$ref" and "$dynamicRef" once every reachable schema is compiled.
+func (c *Compiler) resolveRefs(s *schema) error {
+	var err error
+	if s.ref != "" {
+		s.refSchema, err = c.lookup(s.base, s.ref)
+		if err != nil {
+			return err
+		}
+	}
+	if s.dynamicRef != "" {
+		s.dynamicSchema, err = c.lookup(s.base, s.dynamicRef)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) lookup(base string, ref string) (*schema, error) {
+	uri, err := resolveURI(base, ref)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid reference %q: %v", ref, err)
+	}
+	docURI, fragment := uri, ""
+	if i := strings.IndexByte(uri, '#'); i >= 0 {
+		docURI, fragment = uri[:i], uri[i+1:]
+	}
+	res, ok := c.resources[docURI]
+	if !ok {
+		return nil, fmt.Errorf("Could not resolve reference %q, no resource %q", ref, docURI)
+	}
+
+	ptr := fragment
+	if fragment != "" && fragment[0] != '/' {
+		ptr, ok = res.anchors[fragment]
+		if !ok {
+			return nil, fmt.Errorf("Could not resolve reference %q, no anchor %q", ref, fragment)
+		}
+	} else if fragment != "" {
+		unescaped, err := url.PathUnescape(fragment)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid reference %q: %v", ref, err)
+		}
+		ptr = unescaped
+	}
+
+	target, err := resolvePointer(res.value, ptr)
+	if err != nil {
+		return nil, fmt.Errorf("Could not resolve reference %q: %v", ref, err)
+	}
+	return c.compile(target, docURI, ptr)
+}
+
+// Navigate a value by JSON Pointer (RFC 6901).
+func resolvePointer(v jog.Value, ptr string) (jog.Value, error) {
+	if ptr == "" {
+		return v, nil
+	}
+	if ptr[0] != '/' {
+		return nil, fmt.Errorf("Invalid JSON pointer %q", ptr)
+	}
+	for _, token := range strings.Split(ptr[1:], "/") {
+		token = unescapePointer(token)
+		switch v.Type() {
+		case jog.TypeObject:
+			child, err := v.Get(token)
+			if err != nil {
+				return nil, fmt.Errorf("Could not find %q in %q", token, ptr)
+			}
+			v = child
+		case jog.TypeArray:
+			elems, err := v.GetArray()
+			if err != nil {
+				return nil, err
+			}
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(elems) {
+				return nil, fmt.Errorf("Invalid array index %q in %q", token, ptr)
+			}
+			v = elems[i]
+		default:
+			return nil, fmt.Errorf("Could not find %q in %q", token, ptr)
+		}
+	}
+	return v, nil
+}
+
+// Utility functions.
+
+func normalizeURI(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	u.Fragment = ""
+	u.RawFragment = ""
+	return u.String(), nil
+}
+
+func resolveURI(base string, ref string) (string, error) {
+	r, err := url.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	if base != "" {
+		b, err := url.Parse(base)
+		if err != nil {
+			return "", err
+		}
+		if b.Opaque != "" && r.Scheme == "" {
+			// Opaque URIs like "urn:x" can only take a fragment.
+			if r.Path != "" {
+				return "", fmt.Errorf("Cannot resolve %q against %q", ref, base)
+			}
+			if r.Fragment == "" {
+				return base, nil
+			}
+			return base + "#" + r.EscapedFragment(), nil
+		}
+		r = b.ResolveReference(r)
+	}
+	s := r.String()
+	if r.Fragment == "" {
+		s = strings.TrimSuffix(s, "#")
+	}
+	return s, nil
+}
+
+func escapePointer(s string) string {
+	return strings.Replace(strings.Replace(s, "~", "~0", -1), "/", "~1", -1)
+}
+
+func unescapePointer(s string) string {
+	return strings.Replace(strings.Replace(s, "~1", "/", -1), "~0", "~", -1)
+}
+
+func pointerOrRoot(ptr string) string {
+	if ptr == "" {
+		return "the root"
+	}
+	return ptr
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func stringList(v jog.Value) ([]string, error) {
+	if v.Type() == jog.TypeString {
+		s, err := v.GetString()
+		return []string{s}, err
+	}
+	elems, err := v.GetArray()
+	if err != nil {
+		return nil, fmt.Errorf("Expected a string or an array of strings")
+	}
+	list := make([]string, len(elems))
+	for i, elem := range elems {
+		list[i], err = elem.GetString()
+		if err != nil {
+			return nil, fmt.Errorf("Expected an array of strings")
+		}
+	}
+	return list, nil
+}
+
+func count(v jog.Value) (int, error) {
+	r, err := number(v)
+	if err != nil || !r.IsInt() || r.Sign() < 0 || !r.Num().IsInt64() {
+		return 0, fmt.Errorf("Expected a non-negative integer")
+	}
+	return int(r.Num().Int64()), nil
+}
+
+func pattern(v jog.Value) (*regexp.Regexp, error) {
+	s, err := v.GetString()
+	if err != nil {
+		return nil, err
+	}
+	return regexp.Compile(s)
+}
+
+// Numbers are compared exactly, by way of their JSON text.
+func number(v jog.Value) (*big.Rat, error) {
+	if v.Type() != jog.TypeNumber {
+		return nil, fmt.Errorf("Expected a number")
+	}
+	s, err := v.Stringify()
+	if err != nil {
+		return nil, err
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, fmt.Errorf("Could not read number %q", s)
+	}
+	return r, nil
+}
@@ -0,0 +1,261 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/anantn/jog"
+	"github.com/anantn/jog/rapid"
+	"github.com/anantn/jog/yajl"
+)
+
+var parsers = map[string]func(string) (jog.Value, error){
+	"rapid": rapid.New,
+	"yajl":  yajl.New,
+}
+
+type SchemaCase struct {
+	instance string
+	valid    bool
+}
+
+func DoSchemaTests(t *testing.T, schemaDoc string, cases []SchemaCase) {
+	for name, parse := range parsers {
+		doc, err := parse(schemaDoc)
+		if err != nil {
+			t.Fatalf("[%s] Couldn't parse schema: %v\n", name, err)
+		}
+		s, err := Compile(doc)
+		if err != nil {
+			t.Fatalf("[%s] Couldn't compile schema: %v\n", name, err)
+		}
+		for _, test := range cases {
+			inst, err := parse(test.instance)
+			if err != nil {
+				t.Fatalf("[%s] Couldn't parse instance %s: %v\n", name, test.instance, err)
+			}
+			err = s.Validate(inst)
+			if test.valid && err != nil {
+				t.Fatalf("[%s] Expected %s to be valid, got %v\n", name, test.instance, err)
+			}
+			if !test.valid && err == nil {
+				t.Fatalf("[%s] Expected %s to be invalid\n", name, test.instance)
+			}
+		}
+	}
+}
+
+func TestType(t *testing.T) {
+	DoSchemaTests(t, `{"type": ["integer", "string"]}`, []SchemaCase{
+		{`1`, true},
+		{`1.0`, true},
+		{`"x"`, true},
+		{`1.5`, false},
+		{`null`, false},
+	})
+}
+
+func TestNumbers(t *testing.T) {
+	DoSchemaTests(t, `{"multipleOf": 0.01, "minimum": 0, "exclusiveMaximum": 100}`, []SchemaCase{
+		{`19.99`, true},
+		{`0`, true},
+		{`0.001`, false},
+		{`-1`, false},
+		{`100`, false},
+	})
+}
+
+func TestStrings(t *testing.T) {
+	DoSchemaTests(t, `{"minLength": 2, "maxLength": 3, "pattern": "^[a-zé]+$"}`, []SchemaCase{
+		{`"ab"`, true},
+		{`"éé"`, true},
+		{`"a"`, false},
+		{`"abcd"`, false},
+		{`"AB"`, false},
+	})
+}
+
+func TestObject(t *testing.T) {
+	schema := `{
+		"type": "object",
+		"required": ["id"],
+		"properties": {"id": {"type": "integer"}, "name": {"type": "string"}},
+		"patternProperties": {"^x-": true},
+		"additionalProperties": false,
+		"dependentRequired": {"name": ["id"]},
+		"propertyNames": {"maxLength": 8}
+	}`
+	DoSchemaTests(t, schema, []SchemaCase{
+		{`{"id": 1}`, true},
+		{`{"id": 1, "name": "jog", "x-trace": [1, 2]}`, true},
+		{`{"name": "jog"}`, false},
+		{`{"id": "1"}`, false},
+		{`{"id": 1, "other": 2}`, false},
+		{`{"id": 1, "x-very-long": 2}`, false},
+	})
+}
+
+func TestArray(t *testing.T) {
+	schema := `{
+		"prefixItems": [{"type": "string"}],
+		"items": {"type": "number"},
+		"contains": {"const": 7},
+		"maxContains": 1,
+		"uniqueItems": true
+	}`
+	DoSchemaTests(t, schema, []SchemaCase{
+		{`["a", 7]`, true},
+		{`["a", 1, 7.0]`, true},
+		{`["a", 1]`, false},
+		{`["a", 7, 7]`, false},
+		{`[1, 7]`, false},
+		{`["a", 7, 1, 1.0]`, false},
+	})
+}
+
+func TestCombinators(t *testing.T) {
+	schema := `{
+		"anyOf": [{"type": "string"}, {"type": "number"}],
+		"oneOf": [{"minimum": 10}, {"maximum": 5}],
+		"not": {"const": 3}
+	}`
+	DoSchemaTests(t, schema, []SchemaCase{
+		{`11`, true},
+		{`4`, true},
+		{`"x"`, false},
+		{`3`, false},
+		{`7`, false},
+		{`null`, false},
+	})
+}
+
+func TestConditional(t *testing.T) {
+	schema := `{
+		"if": {"properties": {"kind": {"const": "user"}}},
+		"then": {"required": ["email"]},
+		"else": {"required": ["token"]}
+	}`
+	DoSchemaTests(t, schema, []SchemaCase{
+		{`{"kind": "user", "email": "a@b"}`, true},
+		{`{"kind": "bot", "token": "t"}`, true},
+		{`{"kind": "user", "token": "t"}`, false},
+	})
+}
+
+func TestRefs(t *testing.T) {
+	schema := `{
+		"$id": "https://example.com/tree",
+		"$defs": {
+			"node": {
+				"$anchor": "node",
+				"type": "object",
+				"properties": {
+					"value": {"type": "number"},
+					"children": {"type": "array", "items": {"$ref": "#node"}}
+				}
+			}
+		},
+		"$ref": "#/$defs/node"
+	}`
+	DoSchemaTests(t, schema, []SchemaCase{
+		{`{"value": 1, "children": [{"value": 2, "children": []}]}`, true},
+		{`{"value": 1, "children": [{"value": "2"}]}`, false},
+	})
+}
+
+func TestDynamicRef(t *testing.T) {
+	schema := `{
+		"$id": "https://example.com/strict-tree",
+		"$dynamicAnchor": "node",
+		"$ref": "tree",
+		"unevaluatedProperties": false,
+		"$defs": {
+			"tree": {
+				"$id": "tree",
+				"$dynamicAnchor": "node",
+				"type": "object",
+				"properties": {
+					"data": true,
+					"children": {"type": "array", "items": {"$dynamicRef": "#node"}}
+				}
+			}
+		}
+	}`
+	DoSchemaTests(t, schema, []SchemaCase{
+		{`{"children": [{"data": 1}]}`, true},
+		{`{"children": [{"daat": 1}]}`, false},
+	})
+}
+
+func TestUnevaluated(t *testing.T) {
+	schema := `{
+		"allOf": [{"properties": {"a": true}}],
+		"anyOf": [{"properties": {"b": true}, "required": ["b"]}, true],
+		"unevaluatedProperties": false
+	}`
+	DoSchemaTests(t, schema, []SchemaCase{
+		{`{"a": 1, "b": 2}`, true},
+		{`{"a": 1, "c": 2}`, false},
+	})
+	DoSchemaTests(t, `{"prefixItems": [true], "contains": {"type": "string"}, "unevaluatedItems": false}`, []SchemaCase{
+		{`[1, "x", "y"]`, true},
+		{`[1, "x", 2]`, false},
+	})
+}
+
+func TestErrorPaths(t *testing.T) {
+	schema := `{"properties": {"friends": {"items": {"properties": {"id": {"type": "integer"}}}}}}`
+	for name, parse := range parsers {
+		doc, _ := parse(schema)
+		s, err := Compile(doc)
+		if err != nil {
+			t.Fatalf("[%s] Couldn't compile schema: %v\n", name, err)
+		}
+		inst, _ := parse(`{"friends": [{"id": 0}, {"id": "one"}]}`)
+		err = s.Validate(inst)
+		verr, ok := err.(*ValidationError)
+		if !ok || len(verr.Errors) != 1 {
+			t.Fatalf("[%s] Expected a single validation error, got %v\n", name, err)
+		}
+		e := verr.Errors[0]
+		if e.InstancePath != "/friends/1/id" {
+			t.Fatalf("[%s] Expected instance path /friends/1/id, got %s\n", name, e.InstancePath)
+		}
+		if e.SchemaPath != "#/properties/friends/items/properties/id/type" {
+			t.Fatalf("[%s] Unexpected schema path %s\n", name, e.SchemaPath)
+		}
+		if !strings.Contains(e.Error(), "Expected integer, got string") {
+			t.Fatalf("[%s] Unexpected message %q\n", name, e.Error())
+		}
+	}
+}
+
+func TestResources(t *testing.T) {
+	for name, parse := range parsers {
+		c := NewCompiler()
+		common, _ := parse(`{"$defs": {"id": {"type": "string", "minLength": 1}}}`)
+		if err := c.AddResource("https://example.com/common.json", common); err != nil {
+			t.Fatalf("[%s] Couldn't add resource: %v\n", name, err)
+		}
+		doc, _ := parse(`{"$id": "https://example.com/user.json", "properties": {"id": {"$ref": "common.json#/$defs/id"}}}`)
+		s, err := c.Compile(doc)
+		if err != nil {
+			t.Fatalf("[%s] Couldn't compile schema: %v\n", name, err)
+		}
+		bad, _ := parse(`{"id": ""}`)
+		if s.Validate(bad) == nil {
+			t.Fatalf("[%s] Expected the external reference to be applied\n", name)
+		}
+	}
+}
+
+func TestInvalidSchema(t *testing.T) {
+	for name, parse := range parsers {
+		for _, input := range []string{`{"minLength": -1}`, `{"$ref": "#/$defs/missing"}`, `{"allOf": []}`, `[]`} {
+			doc, _ := parse(input)
+			if _, err := Compile(doc); err == nil {
+				t.Fatalf("[%s] Expected %s to fail to compile\n", name, input)
+			}
+		}
+	}
+}
@@ -0,0 +1,545 @@
+package schema
+
+import (
+	"fmt"
+	"iter"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/anantn/jog"
+)
+
+// Error is a single validation failure.
+type Error struct {
+	// JSON Pointer to the failing part of the instance, "" for the root.
+	InstancePath string
+	// Absolute location of the failing keyword, e.g. "#/properties/age/minimum".
+	SchemaPath string
+	Message    string
+}
+
+func (e *Error) Error() string {
+	if e.InstancePath == "" {
+		return fmt.Sprintf("At the root: %s (%s)", e.Message, e.SchemaPath)
+	}
+	return fmt.Sprintf("At %s: %s (%s)", e.InstancePath, e.Message, e.SchemaPath)
+}
+
+// ValidationError is returned by Validate and lists every failure found.
+type ValidationError struct {
+	Errors []*Error
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	if len(msgs) == 1 {
+		return msgs[0]
+	}
+	return fmt.Sprintf("%d validation errors: %s", len(msgs), strings.Join(msgs, "; "))
+}
+
+// Validate an instance against the schema. The returned error, if any, is a
+// *ValidationError.
+func (s *Schema) Validate(v jog.Value) error {
+	val := &validator{schema: s}
+	errs, _ := val.validate(s.root, v, "")
+	if len(errs) > 0 {
+		return &ValidationError{errs}
+	}
+	return nil
+}
+
+type validator struct {
+	schema *Schema
+	// The dynamic scope, base URIs of the resources entered so far.
+	scope []string
+}
+
+// Annotations collected by successful subschemas, consumed by the
+// unevaluatedItems and unevaluatedProperties keywords.
+type annotations struct {
+	props    map[string]bool
+	items    int
+	allItems bool
+	itemSet  map[int]bool
+}
+
+func (a *annotations) merge(b *annotations) {
+	for k := range b.props {
+		a.addProp(k)
+	}
+	if b.items > a.items {
+		a.items = b.items
+	}
+	a.allItems = a.allItems || b.allItems
+	for i := range b.itemSet {
+		a.addItem(i)
+	}
+}
+
+func (a *annotations) addProp(name string) {
+	if a.props == nil {
+		a.props = make(map[string]bool)
+	}
+	a.props[name] = true
+}
+
+func (a *annotations) addItem(i int) {
+	if a.itemSet == nil {
+		a.itemSet = make(map[int]bool)
+	}
+	a.itemSet[i] = true
+}
+
+func (a *annotations) evaluated(i int) bool {
+	return a.allItems || i < a.items || a.itemSet[i]
+}
+
+func (v *validator) validate(s *schema, inst jog.Value, ipath string) ([]*Error, *annotations) {
+	ann := &annotations{}
+	if s.always != nil {
+		if !*s.always {
+			return []*Error{{ipath, s.location, "The false schema never matches"}}, ann
+		}
+		return nil, ann
+	}
+
+	if len(v.scope) == 0 || v.scope[len(v.scope)-1] != s.base {
+		v.scope = append(v.scope, s.base)
+		defer func() { v.scope = v.scope[:len(v.scope)-1] }()
+	}
+
+	var errs []*Error
+	fail := func(keyword string, format string, args ...interface{}) {
+		errs = append(errs, &Error{ipath, s.location + "/" + keyword, fmt.Sprintf(format, args...)})
+	}
+	// Apply a subschema whose failures fail this schema.
+	apply := func(sub *schema, child jog.Value, path string) bool {
+		subErrs, subAnn := v.validate(sub, child, path)
+		if len(subErrs) > 0 {
+			errs = append(errs, subErrs...)
+			return false
+		}
+		if path == ipath {
+			ann.merge(subAnn)
+		}
+		return true
+	}
+	// Apply a subschema only to find out whether it matches.
+	test := func(sub *schema, child jog.Value, path string) ([]*Error, *annotations) {
+		return v.validate(sub, child, path)
+	}
+
+	if s.refSchema != nil {
+		apply(s.refSchema, inst, ipath)
+	}
+	if s.dynamicSchema != nil {
+		apply(v.dynamicTarget(s), inst, ipath)
+	}
+
+	t := inst.Type()
+	if len(s.types) > 0 {
+		matched := false
+		for _, name := range s.types {
+			if typeMatches(name, inst, t) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			fail("type", "Expected %s, got %s", strings.Join(s.types, " or "), typeName(t))
+		}
+	}
+	if s.enum != nil {
+		matched := false
+		for _, e := range s.enum {
+			if jog.Equal(e, inst) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			fail("enum", "Value is not one of the enumerated values")
+		}
+	}
+	if s.constant != nil && !jog.Equal(s.constant, inst) {
+		fail("const", "Value does not equal the constant")
+	}
+
+	switch t {
+	case jog.TypeNumber:
+		v.validateNumber(s, inst, fail)
+	case jog.TypeString:
+		str, _ := inst.GetString()
+		length := utf8.RuneCountInString(str)
+		if s.maxLength >= 0 && length > s.maxLength {
+			fail("maxLength", "String is longer than %d characters", s.maxLength)
+		}
+		if length < s.minLength {
+			fail("minLength", "String is shorter than %d characters", s.minLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(str) {
+			fail("pattern", "String does not match pattern %q", s.pattern.String())
+		}
+	case jog.TypeArray:
+		elems, _ := inst.GetArray()
+		if s.maxItems >= 0 && len(elems) > s.maxItems {
+			fail("maxItems", "Array has more than %d items", s.maxItems)
+		}
+		if len(elems) < s.minItems {
+			fail("minItems", "Array has fewer than %d items", s.minItems)
+		}
+		if s.uniqueItems {
+		unique:
+			for i := range elems {
+				for j := i + 1; j < len(elems); j++ {
+					if jog.Equal(elems[i], elems[j]) {
+						fail("uniqueItems", "Items %d and %d are equal", i, j)
+						break unique
+					}
+				}
+			}
+		}
+		for i, sub := range s.prefixItems {
+			if i >= len(elems) {
+				break
+			}
+			apply(sub, elems[i], ipath+"/"+strconv.Itoa(i))
+			ann.items = i + 1
+		}
+		if s.items != nil {
+			for i := len(s.prefixItems); i < len(elems); i++ {
+				apply(s.items, elems[i], ipath+"/"+strconv.Itoa(i))
+			}
+			ann.allItems = true
+		}
+		if s.contains != nil {
+			matches := 0
+			for i, elem := range elems {
+				if subErrs, _ := test(s.contains, elem, ipath+"/"+strconv.Itoa(i)); len(subErrs) == 0 {
+					matches++
+					ann.addItem(i)
+				}
+			}
+			if matches < s.minContains {
+				if s.minContains == 1 {
+					fail("contains", "Array does not contain a matching item")
+				} else {
+					fail("minContains", "Array contains %d matching items, expected at least %d", matches, s.minContains)
+				}
+			}
+			if s.maxContains >= 0 && matches > s.maxContains {
+				fail("maxContains", "Array contains %d matching items, expected at most %d", matches, s.maxContains)
+			}
+		}
+	case jog.TypeObject:
+		members, _ := inst.GetObject()
+		if s.maxProperties >= 0 && len(members) > s.maxProperties {
+			fail("maxProperties", "Object has more than %d properties", s.maxProperties)
+		}
+		if len(members) < s.minProperties {
+			fail("minProperties", "Object has fewer than %d properties", s.minProperties)
+		}
+		for _, name := range s.required {
+			if _, ok := members[name]; !ok {
+				fail("required", "Missing required property %q", name)
+			}
+		}
+		for _, name := range sortedKeys(s.dependentReq) {
+			if _, ok := members[name]; !ok {
+				continue
+			}
+			for _, dep := range s.dependentReq[name] {
+				if _, ok := members[dep]; !ok {
+					fail("dependentRequired/"+escapePointer(name), "Property %q requires property %q", name, dep)
+				}
+			}
+		}
+		for _, name := range sortedKeys(members) {
+			child := ipath + "/" + escapePointer(name)
+			matched := false
+			if sub, ok := s.properties[name]; ok {
+				apply(sub, members[name], child)
+				matched = true
+			}
+			for _, p := range s.patternProperties {
+				if p.re.MatchString(name) {
+					apply(p.schema, members[name], child)
+					matched = true
+				}
+			}
+			if !matched && s.additionalProperties != nil {
+				apply(s.additionalProperties, members[name], child)
+				matched = true
+			}
+			if matched {
+				ann.addProp(name)
+			}
+			if s.propertyNames != nil {
+				if subErrs, _ := test(s.propertyNames, nameValue(name), child); len(subErrs) > 0 {
+					fail("propertyNames", "Property name %q is invalid: %s", name, subErrs[0].Message)
+				}
+			}
+		}
+		for _, name := range sortedKeys(s.dependentSchemas) {
+			if _, ok := members[name]; ok {
+				apply(s.dependentSchemas[name], inst, ipath)
+			}
+		}
+	}
+
+	for _, sub := range s.allOf {
+		apply(sub, inst, ipath)
+	}
+	if s.anyOf != nil {
+		var branchErrs []*Error
+		matched := false
+		for _, sub := range s.anyOf {
+			subErrs, subAnn := test(sub, inst, ipath)
+			if len(subErrs) == 0 {
+				matched = true
+				ann.merge(subAnn)
+			}
+			branchErrs = append(branchErrs, subErrs...)
+		}
+		if !matched {
+			fail("anyOf", "Value does not match any of the anyOf schemas")
+			errs = append(errs, branchErrs...)
+		}
+	}
+	if s.oneOf != nil {
+		var branchErrs []*Error
+		var matched []int
+		for i, sub := range s.oneOf {
+			subErrs, subAnn := test(sub, inst, ipath)
+			if len(subErrs) == 0 {
+				matched = append(matched, i)
+				ann.merge(subAnn)
+			}
+			branchErrs = append(branchErrs, subErrs...)
+		}
+		switch len(matched) {
+		case 0:
+			fail("oneOf", "Value does not match any of the oneOf schemas")
+			errs = append(errs, branchErrs...)
+		case 1:
+		default:
+			fail("oneOf", "Value matches oneOf schemas %d and %d, expected exactly one", matched[0], matched[1])
+		}
+	}
+	if s.not != nil {
+		if subErrs, _ := test(s.not, inst, ipath); len(subErrs) == 0 {
+			fail("not", "Value must not match the not schema")
+		}
+	}
+	if s.ifSchema != nil {
+		if subErrs, subAnn := test(s.ifSchema, inst, ipath); len(subErrs) == 0 {
+			ann.merge(subAnn)
+			if s.thenSchema != nil {
+				apply(s.thenSchema, inst, ipath)
+			}
+		} else if s.elseSchema != nil {
+			apply(s.elseSchema, inst, ipath)
+		}
+	}
+
+	// The unevaluated keywords see the annotations of everything above.
+	if s.unevaluatedItems != nil && t == jog.TypeArray {
+		elems, _ := inst.GetArray()
+		for i, elem := range elems {
+			if !ann.evaluated(i) {
+				apply(s.unevaluatedItems, elem, ipath+"/"+strconv.Itoa(i))
+			}
+		}
+		ann.allItems = true
+	}
+	if s.unevaluatedProperties != nil && t == jog.TypeObject {
+		members, _ := inst.GetObject()
+		for _, name := range sortedKeys(members) {
+			if !ann.props[name] {
+				apply(s.unevaluatedProperties, members[name], ipath+"/"+escapePointer(name))
+			}
+		}
+		for name := range members {
+			ann.addProp(name)
+		}
+	}
+	return errs, ann
+}
+
+func (v *validator) validateNumber(s *schema, inst jog.Value, fail func(string, string, ...interface{})) {
+	r, err := number(inst)
+	if err != nil {
+		fail("type", "%v", err)
+		return
+	}
+	if s.multipleOf != nil && !new(big.Rat).Quo(r, s.multipleOf).IsInt() {
+		fail("multipleOf", "Number is not a multiple of %s", s.multipleOf.RatString())
+	}
+	if s.maximum != nil && r.Cmp(s.maximum) > 0 {
+		fail("maximum", "Number is greater than %s", s.maximum.RatString())
+	}
+	if s.exclusiveMax != nil && r.Cmp(s.exclusiveMax) >= 0 {
+		fail("exclusiveMaximum", "Number is not less than %s", s.exclusiveMax.RatString())
+	}
+	if s.minimum != nil && r.Cmp(s.minimum) < 0 {
+		fail("minimum", "Number is less than %s", s.minimum.RatString())
+	}
+	if s.exclusiveMin != nil && r.Cmp(s.exclusiveMin) <= 0 {
+		fail("exclusiveMinimum", "Number is not greater than %s", s.exclusiveMin.RatString())
+	}
+}
+
+// Resolve a "$dynamicRef". If the statically resolved schema declares a
+// matching "$dynamicAnchor", the outermost resource in the dynamic scope
+// that declares the same anchor wins.
+func (v *validator) dynamicTarget(s *schema) *schema {
+	target := s.dynamicSchema
+	name := s.dynamicRef[strings.IndexByte(s.dynamicRef, '#')+1:]
+	if target.dynamicAnchor == "" || target.dynamicAnchor != name {
+		return target
+	}
+	for _, base := range v.scope {
+		if d, ok := v.schema.dynamic[base][name]; ok {
+			return d
+		}
+	}
+	return target
+}
+
+func typeMatches(name string, inst jog.Value, t jog.Type) bool {
+	switch name {
+	case "integer":
+		if t != jog.TypeNumber {
+			return false
+		}
+		r, err := number(inst)
+		return err == nil && r.IsInt()
+	case "number":
+		return t == jog.TypeNumber
+	}
+	return name == typeName(t)
+}
+
+func typeName(t jog.Type) string {
+	switch t {
+	case jog.TypeBool:
+		return "boolean"
+	case jog.TypeNull:
+		return "null"
+	case jog.TypeArray:
+		return "array"
+	case jog.TypeNumber:
+		return "number"
+	case jog.TypeString:
+		return "string"
+	case jog.TypeObject:
+		return "object"
+	}
+	return "unknown"
+}
+
+// nameValue wraps a property name so that propertyNames can validate it like
+// any other string instance.
+type nameValue string
+
+func (n nameValue) Type(path ...string) jog.Type {
+	if len(path) > 0 {
+		return jog.TypeMissing
+	}
+	return jog.TypeString
+}
+
+func (n nameValue) Exists(path ...string) bool {
+	return n.Type(path...) != jog.TypeMissing
+}
+
+func (n nameValue) IsNull(path ...string) bool {
+	return n.Type(path...) == jog.TypeNull
+}
+
+func (n nameValue) Stringify(path ...string) (string, error) {
+	return strconv.Quote(string(n)), nil
+}
+
+func (n nameValue) Get(path ...string) (jog.Value, error) {
+	if len(path) > 0 {
+		return nil, jog.NotFoundError(path, 0, "value", jog.TypeString)
+	}
+	return n, nil
+}
+
+func (n nameValue) At(path *jog.Path) (jog.Value, error) {
+	return n.Get(path.Segments()...)
+}
+
+func (n nameValue) GetString(path ...string) (string, error) {
+	if len(path) > 0 {
+		return "", jog.NotFoundError(path, 0, "string", jog.TypeString)
+	}
+	return string(n), nil
+}
+
+func (n nameValue) GetInt(path ...string) (int, error)       { return 0, n.mismatch(path, "int") }
+func (n nameValue) GetUInt(path ...string) (uint, error)     { return 0, n.mismatch(path, "uint") }
+func (n nameValue) GetFloat(path ...string) (float64, error) { return 0, n.mismatch(path, "float") }
+func (n nameValue) GetBool(path ...string) (bool, error)     { return false, n.mismatch(path, "bool") }
+func (n nameValue) NumberKind(path ...string) (jog.NumberKind, error) {
+	return 0, n.mismatch(path, "number")
+}
+
+func (n nameValue) GetArray(path ...string) ([]jog.Value, error) {
+	return nil, n.mismatch(path, "array")
+}
+
+func (n nameValue) GetObject(path ...string) (map[string]jog.Value, error) {
+	return nil, n.mismatch(path, "object")
+}
+
+func (n nameValue) Len(path ...string) (int, error) {
+	return 0, n.mismatch(path, "array or object")
+}
+
+func (n nameValue) Index(i int, path ...string) (jog.Value, error) {
+	return nil, n.mismatch(path, "array")
+}
+
+func (n nameValue) IndexInt(i int, path ...string) (int, error) { return 0, n.mismatch(path, "array") }
+func (n nameValue) IndexUInt(i int, path ...string) (uint, error) {
+	return 0, n.mismatch(path, "array")
+}
+func (n nameValue) IndexFloat(i int, path ...string) (float64, error) {
+	return 0, n.mismatch(path, "array")
+}
+func (n nameValue) IndexBool(i int, path ...string) (bool, error) {
+	return false, n.mismatch(path, "array")
+}
+func (n nameValue) IndexString(i int, path ...string) (string, error) {
+	return "", n.mismatch(path, "array")
+}
+
+func (n nameValue) Elements(path ...string) iter.Seq2[int, jog.Value] {
+	return jog.Elements(n, path...)
+}
+
+func (n nameValue) ArrayIterator(path ...string) (jog.ArrayIterator, error) {
+	return nil, n.mismatch(path, "array")
+}
+
+func (n nameValue) ObjectIterator(path ...string) (jog.ObjectIterator, error) {
+	return nil, n.mismatch(path, "object")
+}
+
+func (n nameValue) MemoryUsage() int { return 0 }
+
+func (n nameValue) mismatch(path []string, expected string) error {
+	if len(path) > 0 {
+		return jog.NotFoundError(path, 0, expected, jog.TypeString)
+	}
+	return jog.MismatchError(path, expected, jog.TypeString)
+}
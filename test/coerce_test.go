@@ -0,0 +1,261 @@
+package test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/anantn/jog"
+	"github.com/anantn/jog/tree"
+)
+
+var NUMBERS = `{"int":36,"neg":-5,"frac":2.5,"whole":2.0,"exp":1e2,"big":9223372036854775807,"min":-9223372036854775808,"huge":18446744073709551615,"precise":9007199254740993,"str":"12","strfrac":"2.5","strbad":"0x10","t":"true","yes":"yes","list":["1",2.0],"nested":{"n":"7"}}`
+
+// Every implementation of jog.Value, eager and lazy.
+func numberParsers() map[string]func(string) (jog.Value, error) {
+	all := map[string]func(string) (jog.Value, error){
+		"tree": func(s string) (jog.Value, error) { return tree.Parse(s) },
+	}
+	for name, parse := range optionParsers {
+		all[name] = func(s string) (jog.Value, error) { return parse([]byte(s), jog.Options{}) }
+		all[name+"/lazy"] = func(s string) (jog.Value, error) { return parse([]byte(s), lazy) }
+	}
+	return all
+}
+
+func TestStrictNumbers(t *testing.T) {
+	// A missing value means the getter fails.
+	ints := map[string]any{"int": 36, "neg": -5, "big": 9223372036854775807, "min": -9223372036854775808, "precise": 9007199254740993}
+	uints := map[string]any{"int": uint(36), "big": uint(9223372036854775807), "huge": uint(18446744073709551615), "precise": uint(9007199254740993)}
+	floats := map[string]any{"int": 36.0, "neg": -5.0, "frac": 2.5, "whole": 2.0, "exp": 100.0, "big": 9223372036854775807.0, "min": -9223372036854775808.0, "huge": 18446744073709551615.0, "precise": 9007199254740992.0}
+	for name, parse := range numberParsers() {
+		v, err := parse(NUMBERS)
+		if err != nil {
+			t.Fatalf("[%s] Couldn't parse numbers: %v\n", name, err)
+		}
+		for _, key := range []string{"int", "neg", "frac", "whole", "exp", "big", "min", "huge", "precise", "str", "t"} {
+			i, err := v.GetInt(key)
+			checkNumber(t, name, "GetInt", key, ints[key], i, err)
+			u, err := v.GetUInt(key)
+			checkNumber(t, name, "GetUInt", key, uints[key], u, err)
+			f, err := v.GetFloat(key)
+			checkNumber(t, name, "GetFloat", key, floats[key], f, err)
+		}
+		if _, err := v.GetInt("huge"); !errors.Is(err, jog.ErrOverflow) {
+			t.Fatalf("[%s] Expected a range error, got %v\n", name, err)
+		}
+	}
+}
+
+func checkNumber[T comparable](t *testing.T, name, getter, key string, want any, got T, err error) {
+	if want == nil {
+		if err == nil {
+			t.Fatalf("[%s] Expected %s(%s) to fail, got %v\n", name, getter, key, got)
+		}
+		return
+	}
+	if err != nil || want.(T) != got {
+		t.Fatalf("[%s] Expected %s(%s) to be %v, got %v (%v)\n", name, getter, key, want, got, err)
+	}
+}
+
+func TestCoerce(t *testing.T) {
+	for name, parse := range numberParsers() {
+		v, _ := parse(NUMBERS)
+		c := jog.Coerce(v)
+		ints := map[string]int{"int": 36, "whole": 2, "exp": 100, "str": 12}
+		for key, want := range ints {
+			if got, err := c.GetInt(key); err != nil || got != want {
+				t.Fatalf("[%s] Expected %s to coerce to %d, got %d (%v)\n", name, key, want, got, err)
+			}
+		}
+		if got, err := c.GetUInt("str"); err != nil || got != 12 {
+			t.Fatalf("[%s] Expected str to coerce to 12, got %d (%v)\n", name, got, err)
+		}
+		if got, err := c.GetFloat("strfrac"); err != nil || got != 2.5 {
+			t.Fatalf("[%s] Expected strfrac to coerce to 2.5, got %v (%v)\n", name, got, err)
+		}
+		for _, key := range []string{"frac", "strfrac"} {
+			if _, err := c.GetInt(key); !errors.Is(err, jog.ErrOverflow) {
+				t.Fatalf("[%s] Expected %s to lose precision as an int, got %v\n", name, key, err)
+			}
+		}
+		if _, err := c.GetFloat("precise"); !errors.Is(err, jog.ErrOverflow) {
+			t.Fatalf("[%s] Expected precise to lose precision as a float, got %v\n", name, err)
+		}
+		if _, err := c.GetUInt("neg"); err == nil {
+			t.Fatalf("[%s] Expected a negative uint to fail\n", name)
+		}
+		for _, key := range []string{"strbad", "yes", "t"} {
+			if _, err := c.GetInt(key); err == nil {
+				t.Fatalf("[%s] Expected %s not to coerce to an int\n", name, key)
+			}
+		}
+		if b, err := c.GetBool("t"); err != nil || !b {
+			t.Fatalf("[%s] Expected t to coerce to true, got %v (%v)\n", name, b, err)
+		}
+		if _, err := c.GetBool("yes"); err == nil {
+			t.Fatalf("[%s] Expected yes not to coerce to a bool\n", name)
+		}
+		for key, want := range map[string]string{"int": "36", "frac": "2.5", "str": "12"} {
+			if got, err := c.GetString(key); err != nil || got != want {
+				t.Fatalf("[%s] Expected %s to coerce to %q, got %q (%v)\n", name, key, want, got, err)
+			}
+		}
+		if n, err := c.GetInt("nested", "n"); err != nil || n != 7 {
+			t.Fatalf("[%s] Expected nested/n to coerce to 7, got %d (%v)\n", name, n, err)
+		}
+		nested, _ := c.Get("nested")
+		if n, err := nested.GetInt("n"); err != nil || n != 7 {
+			t.Fatalf("[%s] Expected children to coerce, got %d (%v)\n", name, n, err)
+		}
+		list, _ := c.GetArray("list")
+		for i, elem := range list {
+			if n, err := elem.GetInt(); err != nil || n != i+1 {
+				t.Fatalf("[%s] Expected list/%d to coerce to %d, got %d (%v)\n", name, i, i+1, n, err)
+			}
+		}
+		if _, err := v.GetInt("str"); err == nil {
+			t.Fatalf("[%s] Expected the document itself to stay strict\n", name)
+		}
+	}
+}
+
+func TestNumberKind(t *testing.T) {
+	const (
+		i32 = jog.NumberInt32
+		u32 = jog.NumberUint32
+		i64 = jog.NumberInt64
+		u64 = jog.NumberUint64
+	)
+	kinds := map[string]jog.NumberKind{
+		"zero":   i32 | u32 | i64 | u64,
+		"neg":    i32 | i64,
+		"minI32": i32 | i64,
+		"maxU32": u32 | i64 | u64,
+		"above":  i64 | u64,
+		"min":    i64,
+		"huge":   u64,
+		"over":   jog.NumberFloat,
+		"whole":  jog.NumberFloat,
+		"exp":    jog.NumberFloat,
+	}
+	doc := `{"zero":0,"neg":-5,"minI32":-2147483648,"maxU32":4294967295,"above":4294967296,"min":-9223372036854775808,"huge":18446744073709551615,"over":18446744073709551616,"whole":2.0,"exp":1e2,"str":"-7","nested":{"n":7}}`
+	for name, parse := range numberParsers() {
+		v, err := parse(doc)
+		if err != nil {
+			t.Fatalf("[%s] Parse failed: %v\n", name, err)
+		}
+		for key, want := range kinds {
+			if got, err := v.NumberKind(key); err != nil || got != want {
+				t.Fatalf("[%s] Expected %s to be %s, got %s (%v)\n", name, key, want, got, err)
+			}
+			if got, _ := jog.CompilePath(key).NumberKind(v); got != want {
+				t.Fatalf("[%s] Expected the compiled path %s to be %s, got %s\n", name, key, want, got)
+			}
+		}
+		if got, err := v.NumberKind("nested", "n"); err != nil || got != i32|u32|i64|u64 {
+			t.Fatalf("[%s] Expected nested/n to be an integer, got %s (%v)\n", name, got, err)
+		}
+		if _, err := v.NumberKind("str"); !errors.Is(err, jog.ErrTypeMismatch) {
+			t.Fatalf("[%s] Expected a string to be a mismatch, got %v\n", name, err)
+		}
+		if _, err := v.NumberKind("missing"); !errors.Is(err, jog.ErrNotFound) {
+			t.Fatalf("[%s] Expected a missing number not to be found, got %v\n", name, err)
+		}
+		if got, err := jog.Coerce(v).NumberKind("str"); err != nil || got != i32|i64 {
+			t.Fatalf("[%s] Expected str to coerce to a negative integer, got %s (%v)\n", name, got, err)
+		}
+	}
+	if s := (jog.NumberInt64 | jog.NumberUint64).String(); s != "int64|uint64" {
+		t.Fatalf("Expected int64|uint64, got %s\n", s)
+	}
+	if jog.NumberFloat.IsInteger() || !jog.NumberInt64.IsInteger() {
+		t.Fatalf("Expected only integers to be integers\n")
+	}
+}
+
+// Coercion reads numbers as the backend keeps them, so it agrees on every
+// backend for numbers a float64 can't hold exactly.
+func TestCoerceAcrossBackends(t *testing.T) {
+	doc := `{"pi":3.141592653589793238,"big":123456789012345678901234567890,"tenth":0.10000000000000001,"whole":9007199254740993.0,"exp":1e3,"huge":18446744073709551615}`
+	texts := map[string]string{
+		"pi":    "3.141592653589793",
+		"big":   "1.2345678901234568e+29",
+		"tenth": "0.1",
+		"whole": "9007199254740992",
+		"exp":   "1000",
+		"huge":  "18446744073709551615",
+	}
+	for name, parse := range numberParsers() {
+		v, err := parse(doc)
+		if err != nil {
+			t.Fatalf("[%s] Parse failed: %v\n", name, err)
+		}
+		c := jog.Coerce(v)
+		for key, want := range texts {
+			if got, err := c.GetString(key); err != nil || got != want {
+				t.Fatalf("[%s] Expected %s to coerce to %q, got %q (%v)\n", name, key, want, got, err)
+			}
+		}
+		if i, err := c.GetInt("whole"); err != nil || i != 9007199254740992 {
+			t.Fatalf("[%s] Expected whole to coerce to 2^53, got %d (%v)\n", name, i, err)
+		}
+		if f, err := c.GetFloat("pi"); err != nil || f != 3.141592653589793 {
+			t.Fatalf("[%s] Expected pi to read as a float64, got %v (%v)\n", name, f, err)
+		}
+		if _, err := c.GetInt("big"); !errors.Is(err, jog.ErrOverflow) {
+			t.Fatalf("[%s] Expected big to overflow an int, got %v\n", name, err)
+		}
+	}
+}
+
+// A Value counting the lookups its getters make with a path.
+type countingValue struct {
+	jog.Value
+	lookups *int
+}
+
+func (c countingValue) count(path []string) {
+	if len(path) > 0 {
+		*c.lookups++
+	}
+}
+
+func (c countingValue) Get(path ...string) (jog.Value, error) {
+	c.count(path)
+	return c.Value.Get(path...)
+}
+
+func (c countingValue) Type(path ...string) jog.Type {
+	c.count(path)
+	return c.Value.Type(path...)
+}
+
+func (c countingValue) GetString(path ...string) (string, error) {
+	c.count(path)
+	return c.Value.GetString(path...)
+}
+
+func (c countingValue) Stringify(path ...string) (string, error) {
+	c.count(path)
+	return c.Value.Stringify(path...)
+}
+
+func TestCoerceLooksUpOnce(t *testing.T) {
+	v, _ := tree.Parse(NUMBERS)
+	lookups := 0
+	c := jog.Coerce(countingValue{v, &lookups})
+	for _, get := range []func() error{
+		func() error { _, err := c.GetInt("nested", "n"); return err },
+		func() error { _, err := c.GetUInt("big"); return err },
+		func() error { _, err := c.GetFloat("frac"); return err },
+		func() error { _, err := c.NumberKind("str"); return err },
+		func() error { _, err := c.GetBool("t"); return err },
+		func() error { _, err := c.GetString("int"); return err },
+	} {
+		lookups = 0
+		if err := get(); err != nil || lookups != 1 {
+			t.Fatalf("Expected one lookup, got %d (%v)\n", lookups, err)
+		}
+	}
+}
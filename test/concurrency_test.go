@@ -0,0 +1,134 @@
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/anantn/jog"
+)
+
+// Run with -race to check that reading a document takes no shared state.
+const readers = 16
+
+// Read every part of the sample document through the getters.
+func readSample(v jog.Value) string {
+	var out strings.Builder
+	index, _ := v.GetInt("index")
+	balance, _ := v.GetString("balance")
+	active, _ := v.GetBool("isActive")
+	latitude, _ := v.GetFloat("latitude")
+	age, _ := v.GetUInt("details", "age")
+	fmt.Fprintf(&out, "%d %s %v %v %d %s|", index, balance, active, latitude, age, v.Type("friends"))
+
+	tags, _ := v.GetArray("tags")
+	for _, tag := range tags {
+		s, _ := tag.GetString()
+		fmt.Fprintf(&out, "%s,", s)
+	}
+	details, _ := v.GetObject("details")
+	for _, k := range []string{"age", "eyeColor", "longitude"} {
+		s, _ := details[k].Stringify()
+		fmt.Fprintf(&out, "%s=%s,", k, s)
+	}
+	friends, _ := v.Get("friends")
+	elems, _ := friends.GetArray()
+	for _, friend := range elems {
+		name, _ := friend.GetString("name")
+		fmt.Fprintf(&out, "%s;", name)
+	}
+
+	s, _ := v.Stringify()
+	out.WriteString(s)
+	return out.String()
+}
+
+func TestConcurrentReads(t *testing.T) {
+	for i, parse := range parsers {
+		doc, err := parse(SAMPLE)
+		if err != nil {
+			t.Fatalf("Couldn't parse sample: %v\n", err)
+		}
+		want := readSample(doc)
+		encoded := make(map[int]string)
+		for j, newEncoder := range encoders {
+			var buf bytes.Buffer
+			e := newEncoder(&buf)
+			e.Value(doc)
+			e.Close()
+			encoded[j] = buf.String()
+		}
+
+		var wg sync.WaitGroup
+		errs := make(chan string, readers)
+		for r := 0; r < readers; r++ {
+			wg.Add(1)
+			go func(r int) {
+				defer wg.Done()
+				for n := 0; n < 50; n++ {
+					if got := readSample(doc); got != want {
+						errs <- fmt.Sprintf("[%d] Expected %s, got %s", i, want, got)
+						return
+					}
+					j := (r + n) % len(encoders)
+					var buf bytes.Buffer
+					e := encoders[j](&buf)
+					e.Value(doc)
+					if err := e.Close(); err != nil || buf.String() != encoded[j] {
+						errs <- fmt.Sprintf("[%d] Expected %s from encoder %d, got %s (%v)", i, encoded[j], j, buf.String(), err)
+						return
+					}
+					other, err := parsers[(r+n)%len(parsers)](SAMPLE)
+					if err != nil || !jog.Equal(doc, other) {
+						errs <- fmt.Sprintf("[%d] Expected a concurrent parse to equal the sample (%v)", i, err)
+						return
+					}
+				}
+			}(r)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Fatalf("%s\n", err)
+		}
+	}
+}
+
+func TestChildrenOutliveDocument(t *testing.T) {
+	for i, parse := range parsers {
+		doc, _ := parse(SAMPLE)
+		friends, _ := doc.Get("friends")
+		tags, _ := doc.GetArray("tags")
+		details, _ := doc.GetObject("details")
+		doc = nil
+		for n := 0; n < 3; n++ {
+			runtime.GC()
+		}
+
+		var wg sync.WaitGroup
+		errs := make(chan string, readers)
+		for r := 0; r < readers; r++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				var name string
+				if elems, _ := friends.GetArray(); len(elems) == 3 {
+					name, _ = elems[1].GetString("name")
+				}
+				tag, _ := tags[6].GetString()
+				color, _ := details["eyeColor"].GetString()
+				if name != "Gilbert Rasmussen" || tag != "in" || color != "brown" {
+					errs <- fmt.Sprintf("[%d] Expected children to outlive the document, got %q, %q and %q", i, name, tag, color)
+				}
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Fatalf("%s\n", err)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/anantn/jog"
+	"github.com/anantn/jog/jogtest"
+	"github.com/anantn/jog/tree"
+)
+
+func TestConformance(t *testing.T) {
+	for name, parse := range optionParsers {
+		t.Run(name, func(t *testing.T) {
+			jogtest.RunConformance(t, func(data []byte) (jog.Value, error) {
+				return parse(data, jog.Options{})
+			})
+		})
+		t.Run(name+"/lazy", func(t *testing.T) {
+			jogtest.RunConformance(t, func(data []byte) (jog.Value, error) {
+				return parse(data, lazy)
+			})
+		})
+	}
+	t.Run("tree", func(t *testing.T) {
+		jogtest.RunConformance(t, func(data []byte) (jog.Value, error) {
+			v, err := tree.Parse(string(data))
+			if err != nil {
+				return nil, err
+			}
+			return v, nil
+		})
+	})
+}
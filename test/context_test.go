@@ -0,0 +1,61 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anantn/jog"
+	"github.com/anantn/jog/rapid"
+	"github.com/anantn/jog/yajl"
+)
+
+var contextParsers = map[string]func(context.Context, []byte, jog.Options) (jog.Value, error){
+	"rapid": rapid.NewContext,
+	"yajl":  yajl.NewContext,
+}
+
+func TestContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for name, parse := range contextParsers {
+		if _, err := parse(ctx, []byte(`[1]`), jog.Options{}); !errors.Is(err, context.Canceled) {
+			t.Fatalf("[%s] Expected context.Canceled, got %v\n", name, err)
+		}
+	}
+}
+
+func TestContextDeadline(t *testing.T) {
+	huge := []byte("[" + strings.Repeat(`{"a":[1,2.5,"x"]},`, 1<<20) + "null]")
+	for name, parse := range contextParsers {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		_, err := parse(ctx, huge, jog.Options{})
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("[%s] Expected context.DeadlineExceeded, got %v\n", name, err)
+		}
+		if !strings.HasPrefix(err.Error(), "[") || strings.HasPrefix(err.Error(), "[0]") {
+			t.Fatalf("[%s] Expected the offset reached in %v\n", name, err)
+		}
+	}
+}
+
+func TestContextCompletes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for name, parse := range contextParsers {
+		v, err := parse(ctx, []byte(SAMPLE), jog.Options{})
+		if err != nil {
+			t.Fatalf("[%s] Couldn't parse with a live context: %v\n", name, err)
+		}
+		want, _ := parsers[0](SAMPLE)
+		if !jog.Equal(v, want) {
+			t.Fatalf("[%s] Expected the sample document\n", name)
+		}
+		if _, err := parse(ctx, []byte(`[1,`), jog.Options{}); err == nil || errors.Is(err, context.Canceled) {
+			t.Fatalf("[%s] Expected a syntax error, got %v\n", name, err)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/anantn/jog"
+	"github.com/anantn/jog/rapid"
+	"github.com/anantn/jog/yajl"
+)
+
+func TestDiff(t *testing.T) {
+	changed := `{"index": 0, "_id": "54c7fff8e3268528239d9cb1", "guid": "b4940c5c-82ee-4f5e-bd02-f847fe2b9fc6",
+		"isActive": "yes", "balance": "$1,750.21", "details": {"age": 37, "eyeColor": "brown", "longitude": 102.5639770001},
+		"registered": "2014-10-12T09:38:08 +07:00", "latitude": -59.816976, "tags": ["nisi", "sint", "aute", "tempor", "sit", "esse"],
+		"friends": [{"id": 0, "name": "Case Gross"}, {"id": 1, "name": "Gilbert R."}, {"id": 2, "name": "Harris Huff"}], "company": "jog"}`
+	for _, obj := range GetSamples(t) {
+		for _, parse := range []func(string) (jog.Value, error){rapid.New, yajl.New} {
+			other, err := parse(changed)
+			if err != nil {
+				t.Fatalf("Couldn't parse changed sample: %v\n", err)
+			}
+			if changes := jog.Diff(obj, obj); len(changes) != 0 {
+				t.Fatalf("Expected no changes, got %v\n", changes)
+			}
+
+			opts := jog.DiffOptions{Tolerance: 1e-6, Ignore: []string{"/friends/*/name"}}
+			changes := opts.Diff(obj, other)
+			expected := []struct {
+				kind jog.ChangeKind
+				ptr  string
+			}{
+				{jog.ChangeAdded, "/company"},
+				{jog.ChangeChanged, "/details/age"},
+				{jog.ChangeTypeChanged, "/isActive"},
+				{jog.ChangeRemoved, "/tags/6"},
+			}
+			if len(changes) != len(expected) {
+				t.Fatalf("Expected %d changes, got:\n%s", len(expected), jog.FormatDiff(changes))
+			}
+			for i, e := range expected {
+				if changes[i].Kind != e.kind || changes[i].Pointer() != e.ptr {
+					t.Fatalf("Expected %v at %s, got %v at %s\n", e.kind, e.ptr, changes[i].Kind, changes[i].Pointer())
+				}
+			}
+
+			out := jog.FormatDiff(changes)
+			want := "@@ /company @@\n+\"jog\"\n@@ /details/age @@\n-36\n+37\n@@ /isActive (bool -> string) @@\n-true\n+\"yes\"\n@@ /tags/6 @@\n-\"in\"\n"
+			if out != want {
+				t.Fatalf("Unexpected rendering:\n%s", out)
+			}
+
+			if changes := jog.Diff(obj, other); len(changes) != 6 {
+				t.Fatalf("Expected 6 changes without options, got:\n%s", jog.FormatDiff(changes))
+			}
+		}
+	}
+}
+
+// "/" is the member with the empty key, not the whole document.
+func TestDiffIgnoreEmptyKey(t *testing.T) {
+	for _, parse := range []func(string) (jog.Value, error){rapid.New, yajl.New} {
+		a, _ := parse(`{"":{"x":1},"b":1}`)
+		b, _ := parse(`{"":{"x":2},"b":2}`)
+		changes := jog.DiffOptions{Ignore: []string{"/"}}.Diff(a, b)
+		if len(changes) != 1 || changes[0].Pointer() != "/b" {
+			t.Fatalf("Expected only /b to change, got:\n%s", jog.FormatDiff(changes))
+		}
+		if changes := (jog.DiffOptions{Ignore: []string{""}}).Diff(a, b); len(changes) != 0 {
+			t.Fatalf("Expected the whole document to be ignored, got:\n%s", jog.FormatDiff(changes))
+		}
+	}
+}
+
+// Numbers that differ only in how a backend keeps them are not changes, and
+// numbers that do differ are, whichever backends parsed the two sides.
+func TestDiffNumbersAcrossBackends(t *testing.T) {
+	before := `{"pi":3.141592653589793238,"big":123456789012345678901234567890,"n":1.0,"id":9007199254740993}`
+	after := `{"pi":3.1415926535897932,"big":1.2345678901234568e29,"n":1,"id":9007199254740992}`
+	for _, parseA := range []func(string) (jog.Value, error){rapid.New, yajl.New} {
+		for _, parseB := range []func(string) (jog.Value, error){rapid.New, yajl.New} {
+			a, _ := parseA(before)
+			b, _ := parseB(after)
+			changes := jog.Diff(a, b)
+			if len(changes) != 1 || changes[0].Kind != jog.ChangeChanged || changes[0].Pointer() != "/id" {
+				t.Fatalf("Expected only /id to change, got:\n%s", jog.FormatDiff(changes))
+			}
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/anantn/jog"
+	"github.com/anantn/jog/rapid"
+	"github.com/anantn/jog/yajl"
+)
+
+var encoders = []func(io.Writer) jog.Encoder{rapid.NewEncoder, yajl.NewEncoder}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestEncoder(t *testing.T) {
+	for _, newEncoder := range encoders {
+		var buf bytes.Buffer
+		e := newEncoder(&buf)
+		e.BeginObject()
+		e.Key("name")
+		e.String("Jürgen \"J\"\n")
+		e.Key("age")
+		e.Int64(-36)
+		e.Key("id")
+		e.Uint64(math.MaxUint64)
+		e.Key("ratio")
+		e.Float64(0.1)
+		e.Key("tags")
+		e.BeginArray()
+		e.Bool(true)
+		e.Null()
+		e.BeginObject()
+		e.EndObject()
+		e.EndArray()
+		e.EndObject()
+		if err := e.Close(); err != nil {
+			t.Fatalf("Couldn't close encoder: %v\n", err)
+		}
+
+		expected := `{"name":"Jürgen \"J\"\n","age":-36,"id":18446744073709551615,"ratio":0.1,"tags":[true,null,{}]}`
+		for _, parse := range parsers {
+			got, err := parse(buf.String())
+			if err != nil {
+				t.Fatalf("Couldn't parse encoder output %s: %v\n", buf.String(), err)
+			}
+			want, _ := parse(expected)
+			if !jog.Equal(got, want) {
+				t.Fatalf("Expected %s, got %s\n", expected, buf.String())
+			}
+		}
+	}
+}
+
+func TestEncoderScalar(t *testing.T) {
+	for _, newEncoder := range encoders {
+		var buf bytes.Buffer
+		e := newEncoder(&buf)
+		if err := e.String("alone"); err != nil {
+			t.Fatalf("Couldn't encode a scalar document: %v\n", err)
+		}
+		if err := e.Close(); err != nil || buf.String() != `"alone"` {
+			t.Fatalf("Expected \"alone\", got %s (%v)\n", buf.String(), err)
+		}
+	}
+}
+
+func TestEncoderStructure(t *testing.T) {
+	invalid := []func(e jog.Encoder) error{
+		func(e jog.Encoder) error { return e.Key("a") },
+		func(e jog.Encoder) error { e.BeginArray(); return e.Key("a") },
+		func(e jog.Encoder) error { e.BeginObject(); return e.Int64(1) },
+		func(e jog.Encoder) error { e.BeginObject(); e.Key("a"); return e.Key("b") },
+		func(e jog.Encoder) error { e.BeginObject(); e.Key("a"); return e.EndObject() },
+		func(e jog.Encoder) error { e.BeginArray(); return e.EndObject() },
+		func(e jog.Encoder) error { return e.EndArray() },
+		func(e jog.Encoder) error { e.Null(); return e.Null() },
+		func(e jog.Encoder) error { e.BeginArray(); e.EndArray(); return e.BeginArray() },
+		func(e jog.Encoder) error { e.BeginArray(); return e.Float64(math.NaN()) },
+		func(e jog.Encoder) error { e.BeginArray(); return e.Close() },
+		func(e jog.Encoder) error { e.Null(); e.Close(); return e.Null() },
+	}
+	for _, newEncoder := range encoders {
+		for i, test := range invalid {
+			var buf bytes.Buffer
+			e := newEncoder(&buf)
+			if err := test(e); err == nil {
+				t.Fatalf("Expected invalid token sequence %d to fail\n", i)
+			}
+			e.Close()
+		}
+	}
+}
+
+func TestEncoderStreaming(t *testing.T) {
+	for _, newEncoder := range encoders {
+		var buf bytes.Buffer
+		e := newEncoder(&buf)
+		e.BeginArray()
+		for i := 0; i < 10000; i++ {
+			e.String("element")
+		}
+		e.EndArray()
+		if err := e.Close(); err != nil {
+			t.Fatalf("Couldn't close encoder: %v\n", err)
+		}
+		expected := "[" + strings.TrimSuffix(strings.Repeat(`"element",`, 10000), ",") + "]"
+		if buf.String() != expected {
+			t.Fatalf("Expected %d bytes of output, got %d\n", len(expected), buf.Len())
+		}
+
+		e = newEncoder(failingWriter{})
+		e.BeginArray()
+		var err error
+		for i := 0; i < 10000 && err == nil; i++ {
+			err = e.String("element")
+		}
+		if err == nil {
+			err = e.EndArray()
+		}
+		if err == nil {
+			err = e.Close()
+		}
+		if err == nil || err.Error() != "disk full" {
+			t.Fatalf("Expected the write error, got %v\n", err)
+		}
+	}
+}
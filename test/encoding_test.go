@@ -0,0 +1,125 @@
+package test
+
+import (
+	"encoding/binary"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/anantn/jog"
+	"github.com/anantn/jog/rapid"
+	"github.com/anantn/jog/yajl"
+)
+
+var optionParsers = map[string]func([]byte, jog.Options) (jog.Value, error){
+	"rapid": rapid.NewWithOptions,
+	"yajl":  yajl.NewWithOptions,
+}
+
+func encode(s string, enc jog.Encoding, bom bool) []byte {
+	var order binary.AppendByteOrder = binary.LittleEndian
+	if enc == jog.EncodingUTF16BE || enc == jog.EncodingUTF32BE {
+		order = binary.BigEndian
+	}
+	var out []byte
+	switch enc {
+	case jog.EncodingUTF16LE, jog.EncodingUTF16BE:
+		units := utf16.Encode([]rune(s))
+		if bom {
+			units = append([]uint16{0xFEFF}, units...)
+		}
+		for _, u := range units {
+			out = order.AppendUint16(out, u)
+		}
+	case jog.EncodingUTF32LE, jog.EncodingUTF32BE:
+		if bom {
+			out = order.AppendUint32(out, 0xFEFF)
+		}
+		for _, r := range s {
+			out = order.AppendUint32(out, uint32(r))
+		}
+	default:
+		if bom {
+			out = append(out, 0xEF, 0xBB, 0xBF)
+		}
+		out = append(out, s...)
+	}
+	return out
+}
+
+func TestEncodings(t *testing.T) {
+	input := `{"name":"Jürgen","city":"東京","emoji":"😀","list":[1,2.5,true,null]}`
+	encodings := []jog.Encoding{jog.EncodingUTF8, jog.EncodingUTF16LE, jog.EncodingUTF16BE, jog.EncodingUTF32LE, jog.EncodingUTF32BE}
+	for name, parse := range optionParsers {
+		want, _ := parse([]byte(input), jog.Options{})
+		for _, enc := range encodings {
+			for _, bom := range []bool{false, true} {
+				data := encode(input, enc, bom)
+				for _, given := range []jog.Encoding{enc, jog.EncodingAuto} {
+					if enc == jog.EncodingUTF8 && given == enc && bom {
+						continue
+					}
+					v, err := parse(data, jog.Options{Encoding: given})
+					if err != nil {
+						t.Fatalf("[%s] Couldn't parse %s (bom %v) as %s: %v\n", name, enc, bom, given, err)
+					}
+					if !jog.Equal(v, want) {
+						got, _ := v.Stringify()
+						t.Fatalf("[%s] Expected %s from %s, got %s\n", name, input, enc, got)
+					}
+					if s, _ := v.GetString("emoji"); s != "😀" {
+						t.Fatalf("[%s] Expected 😀 from %s, got %q\n", name, enc, s)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestMalformedEncodings(t *testing.T) {
+	loneSurrogate := []byte{0xFF, 0xFE, '[', 0, '"', 0, 0x00, 0xD8, '"', 0, ']', 0}
+	reversedPair := []byte{'[', 0, '"', 0, 0x00, 0xDC, 0x00, 0xD8, '"', 0, ']', 0}
+	truncated := append(encode(`[1, 2]`, jog.EncodingUTF16LE, true), ' ')
+	tooLarge := append(encode(`["`, jog.EncodingUTF32BE, false), 0x00, 0x11, 0x00, 0x00)
+	tooLarge = append(tooLarge, encode(`"]`, jog.EncodingUTF32BE, false)...)
+	surrogate := append(encode(`["`, jog.EncodingUTF32LE, false), 0x00, 0xD8, 0x00, 0x00)
+	surrogate = append(surrogate, encode(`"]`, jog.EncodingUTF32LE, false)...)
+	cases := []struct {
+		data []byte
+		enc  jog.Encoding
+	}{
+		{loneSurrogate, jog.EncodingAuto},
+		{reversedPair, jog.EncodingUTF16LE},
+		{truncated, jog.EncodingAuto},
+		{truncated, jog.EncodingUTF16LE},
+		{tooLarge, jog.EncodingUTF32BE},
+		{surrogate, jog.EncodingAuto},
+	}
+	for name, parse := range optionParsers {
+		for i, test := range cases {
+			if _, err := parse(test.data, jog.Options{Encoding: test.enc}); err == nil {
+				t.Fatalf("[%s] Expected malformed input %d to fail\n", name, i)
+			}
+		}
+	}
+}
+
+func TestDetectEncoding(t *testing.T) {
+	cases := []struct {
+		data []byte
+		enc  jog.Encoding
+		bom  int
+	}{
+		{[]byte(`{}`), jog.EncodingUTF8, 0},
+		{[]byte("\xEF\xBB\xBF[]"), jog.EncodingUTF8, 3},
+		{encode(`[1]`, jog.EncodingUTF16LE, false), jog.EncodingUTF16LE, 0},
+		{encode(`[1]`, jog.EncodingUTF16BE, true), jog.EncodingUTF16BE, 2},
+		{encode(`1`, jog.EncodingUTF32LE, false), jog.EncodingUTF32LE, 0},
+		{encode(`1`, jog.EncodingUTF32BE, true), jog.EncodingUTF32BE, 4},
+	}
+	for _, test := range cases {
+		enc, bom := jog.DetectEncoding(test.data)
+		if enc != test.enc || bom != test.bom {
+			t.Fatalf("Expected %s with a %d byte BOM for % X, got %s and %d\n", test.enc, test.bom, test.data, enc, bom)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/anantn/jog"
+	"github.com/anantn/jog/rapid"
+	"github.com/anantn/jog/yajl"
+)
+
+func TestEqual(t *testing.T) {
+	cases := []struct {
+		a, b  string
+		equal bool
+	}{
+		{`{"a":1,"b":[true,null,"x"]}`, `{ "b" : [true, null, "x"], "a" : 1.0 }`, true},
+		{`[1e2, 0.5, -0]`, `[100, 5e-1, 0]`, true},
+		{`{"a":1}`, `{"a":1,"b":2}`, false},
+		{`[1,2]`, `[2,1]`, false},
+		{`"1"`, `1`, false},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d"}}`, false},
+		{`[0.1, 1e19]`, `[0.10000000000000001, 10000000000000000000]`, true},
+		{`9007199254740993`, `9007199254740992.0`, false},
+	}
+	for _, test := range cases {
+		ra, _ := rapid.New(test.a)
+		ya, _ := yajl.New(test.a)
+		rb, _ := rapid.New(test.b)
+		yb, _ := yajl.New(test.b)
+		for _, pair := range [][2]jog.Value{{ra, yb}, {ya, rb}, {ra, rb}, {ya, yb}} {
+			if jog.Equal(pair[0], pair[1]) != test.equal {
+				t.Fatalf("Expected Equal(%s, %s) to be %v\n", test.a, test.b, test.equal)
+			}
+			if (jog.Compare(pair[0], pair[1]) == 0) != test.equal {
+				t.Fatalf("Expected Compare(%s, %s) to agree with Equal\n", test.a, test.b)
+			}
+			if test.equal && jog.Hash(pair[0]) != jog.Hash(pair[1]) {
+				t.Fatalf("Expected Hash(%s) to equal Hash(%s)\n", test.a, test.b)
+			}
+		}
+	}
+	// The same value parsed by both backends hashes the same.
+	for _, obj := range GetSamples(t) {
+		if jog.Hash(obj) != jog.Hash(GetSamples(t)[0]) {
+			t.Fatalf("Expected the sample to hash the same on every backend\n")
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	ordered := []string{
+		`null`, `false`, `true`, `-1e19`, `-9223372036854775808`, `-1.5`, `0`, `2`, `1e3`, `9007199254740992.0`,
+		`9007199254740993`, `9223372036854775807`, `9223372036854775808`, `1.8446744073709552e19`, `1e20`, `""`, `"a"`, `"ab"`, `"b"`, `"é"`,
+		`[]`, `[1]`, `[1,2]`, `[2]`, `{}`, `{"a":1}`, `{"a":1,"b":0}`, `{"a":2}`, `{"b":0}`,
+	}
+	for _, parse := range []func(string) (jog.Value, error){rapid.New, yajl.New} {
+		values := make([]jog.Value, len(ordered))
+		for i, doc := range ordered {
+			v, err := parse(doc)
+			if err != nil {
+				t.Fatalf("Couldn't parse %s: %v\n", doc, err)
+			}
+			values[i] = v
+		}
+		for i := range values {
+			for j := range values {
+				got := jog.Compare(values[i], values[j])
+				want := 0
+				if i < j {
+					want = -1
+				} else if i > j {
+					want = 1
+				}
+				if got != want {
+					t.Fatalf("Expected Compare(%s, %s) to be %d, got %d\n", ordered[i], ordered[j], want, got)
+				}
+			}
+		}
+	}
+}
+
+// Backends keep numbers they can't hold exactly in different forms: rapid
+// prints its double again, and yajl and the tree keep the text. Every pair
+// of them agrees on these numbers all the same.
+var PRECISE = `[0.10000000000000001, 3.141592653589793238, 123456789012345678901234567890, -0.0, 1.5e300, 18446744073709551615, -9223372036854775808]`
+
+func TestEqualAcrossBackends(t *testing.T) {
+	parsers := numberParsers()
+	for nameA, parseA := range parsers {
+		a, err := parseA(PRECISE)
+		if err != nil {
+			t.Fatalf("[%s] Parse failed: %v\n", nameA, err)
+		}
+		for nameB, parseB := range parsers {
+			b, _ := parseB(PRECISE)
+			if !jog.Equal(a, b) || jog.Compare(a, b) != 0 || jog.Hash(a) != jog.Hash(b) {
+				t.Fatalf("[%s] Expected the numbers to equal those of %s, got Compare %d\n", nameA, nameB, jog.Compare(a, b))
+			}
+			if changes := jog.Diff(a, b); len(changes) != 0 {
+				t.Fatalf("[%s] Expected no changes from %s, got:\n%s", nameA, nameB, jog.FormatDiff(changes))
+			}
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/anantn/jog"
+)
+
+var LOOKUPS = `{"a":{"b":[1,2]},"s":"str","frac":2.5,"huge":18446744073709551615,"precise":9007199254740993}`
+
+func checkPathError(t *testing.T, name string, err error, want jog.PathError) {
+	var pe *jog.PathError
+	if !errors.As(err, &pe) {
+		t.Fatalf("[%s] Expected a *jog.PathError, got %T: %v\n", name, err, err)
+	}
+	if !errors.Is(err, want.Err) {
+		t.Fatalf("[%s] Expected %v, got %v\n", name, want.Err, err)
+	}
+	if !slices.Equal(pe.Path, want.Path) || pe.Segment != want.Segment || pe.Expected != want.Expected || pe.Actual != want.Actual {
+		t.Fatalf("[%s] Expected %+v, got %+v\n", name, want, *pe)
+	}
+}
+
+func TestLookupErrors(t *testing.T) {
+	for name, parse := range numberParsers() {
+		v, err := parse(LOOKUPS)
+		if err != nil {
+			t.Fatalf("[%s] Parse failed: %v\n", name, err)
+		}
+		for _, view := range []struct {
+			name string
+			v    jog.Value
+		}{{name, v}, {name + "/coerced", jog.Coerce(v)}} {
+			name, v := view.name, view.v
+
+			_, err = v.Get("a", "missing")
+			checkPathError(t, name, err, jog.PathError{Path: []string{"a", "missing"}, Segment: 1, Expected: "value", Actual: jog.TypeObject, Err: jog.ErrNotFound})
+			_, err = v.GetInt("a", "b", "0")
+			checkPathError(t, name, err, jog.PathError{Path: []string{"a", "b", "0"}, Segment: 2, Expected: "int", Actual: jog.TypeArray, Err: jog.ErrNotFound})
+			_, err = v.GetString("s", "x")
+			checkPathError(t, name, err, jog.PathError{Path: []string{"s", "x"}, Segment: 1, Expected: "string", Actual: jog.TypeString, Err: jog.ErrNotFound})
+			_, err = v.GetObject("a", "b")
+			checkPathError(t, name, err, jog.PathError{Path: []string{"a", "b"}, Segment: 2, Expected: "object", Actual: jog.TypeArray, Err: jog.ErrTypeMismatch})
+			_, err = v.GetInt("huge")
+			checkPathError(t, name, err, jog.PathError{Path: []string{"huge"}, Segment: 1, Expected: "int", Actual: jog.TypeNumber, Err: jog.ErrOverflow})
+			_, err = jog.Coerce(v).GetFloat("precise")
+			checkPathError(t, name, err, jog.PathError{Path: []string{"precise"}, Segment: 1, Expected: "float", Actual: jog.TypeNumber, Err: jog.ErrOverflow})
+
+			// Errors from a compiled path include the whole path.
+			a := mustGet(t, v, "a")
+			_, err = jog.CompilePath("b").GetBool(a)
+			checkPathError(t, name, err, jog.PathError{Path: []string{"b"}, Segment: 1, Expected: "bool", Actual: jog.TypeArray, Err: jog.ErrTypeMismatch})
+			_, err = jog.CompilePath("a", "c").GetString(v)
+			checkPathError(t, name, err, jog.PathError{Path: []string{"a", "c"}, Segment: 1, Expected: "string", Actual: jog.TypeObject, Err: jog.ErrNotFound})
+		}
+
+		// Only the strict getters refuse these.
+		_, err = v.GetInt("s")
+		checkPathError(t, name, err, jog.PathError{Path: []string{"s"}, Segment: 1, Expected: "int", Actual: jog.TypeString, Err: jog.ErrTypeMismatch})
+		_, err = v.GetInt("frac")
+		checkPathError(t, name, err, jog.PathError{Path: []string{"frac"}, Segment: 1, Expected: "int", Actual: jog.TypeNumber, Err: jog.ErrTypeMismatch})
+		if _, err = jog.Coerce(v).GetInt("frac"); !errors.Is(err, jog.ErrOverflow) {
+			t.Fatalf("[%s] Expected a coerced 2.5 to lose precision as an int, got %v\n", name, err)
+		}
+	}
+}
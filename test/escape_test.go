@@ -0,0 +1,112 @@
+package test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/anantn/jog"
+	"github.com/anantn/jog/rapid"
+	"github.com/anantn/jog/yajl"
+)
+
+var optionEncoders = map[string]func(io.Writer, jog.WriterOptions) jog.Encoder{
+	"rapid": rapid.NewEncoderWithOptions,
+	"yajl":  yajl.NewEncoderWithOptions,
+}
+
+var stringifiers = map[string]func(jog.Value, jog.WriterOptions) (string, error){
+	"rapid": rapid.StringifyWithOptions,
+	"yajl":  yajl.StringifyWithOptions,
+}
+
+func TestEscaping(t *testing.T) {
+	input := `{"html":"<script>a && b</script>","path":"a/b","text":"Jürgen 東京 😀\t\u0001"}`
+	cases := []struct {
+		opts   jog.WriterOptions
+		output string
+	}{
+		{jog.WriterOptions{}, "{\"html\":\"<script>a && b</script>\",\"path\":\"a/b\",\"text\":\"Jürgen 東京 😀\\t\\u0001\"}"},
+		{jog.WriterOptions{ASCII: true}, `{"html":"<script>a && b</script>","path":"a/b","text":"J\u00FCrgen \u6771\u4EAC \uD83D\uDE00\t\u0001"}`},
+		{jog.WriterOptions{HTMLSafe: true}, "{\"html\":\"\\u003cscript\\u003ea \\u0026\\u0026 b\\u003c/script\\u003e\",\"path\":\"a/b\",\"text\":\"Jürgen 東京 😀\\t\\u0001\"}"},
+		{jog.WriterOptions{EscapeSolidus: true}, "{\"html\":\"<script>a && b<\\/script>\",\"path\":\"a\\/b\",\"text\":\"Jürgen 東京 😀\\t\\u0001\"}"},
+		{jog.WriterOptions{ASCII: true, HTMLSafe: true, EscapeSolidus: true}, `{"html":"\u003cscript\u003ea \u0026\u0026 b\u003c\/script\u003e","path":"a\/b","text":"J\u00FCrgen \u6771\u4EAC \uD83D\uDE00\t\u0001"}`},
+	}
+	for name, stringify := range stringifiers {
+		for _, parse := range parsers {
+			v, err := parse(input)
+			if err != nil {
+				t.Fatalf("Couldn't parse %s: %v\n", input, err)
+			}
+			for _, test := range cases {
+				got, err := stringify(v, test.opts)
+				if err != nil {
+					t.Fatalf("[%s] Couldn't stringify with %+v: %v\n", name, test.opts, err)
+				}
+				if got != test.output {
+					t.Fatalf("[%s] Expected %s with %+v, got %s\n", name, test.output, test.opts, got)
+				}
+			}
+		}
+	}
+}
+
+func TestValidateUTF8(t *testing.T) {
+	invalid := []string{"\xff", "a\xc3", "\xc0\xaf", "\xed\xa0\x80", "\xf4\x90\x80\x80"}
+	for name, newEncoder := range optionEncoders {
+		for _, s := range invalid {
+			var buf bytes.Buffer
+			e := newEncoder(&buf, jog.WriterOptions{})
+			if err := e.String(s); err != nil {
+				t.Fatalf("[%s] Expected %q to pass without validation: %v\n", name, s, err)
+			}
+			e.Close()
+
+			for _, opts := range []jog.WriterOptions{{ValidateUTF8: true}, {ASCII: true}} {
+				buf.Reset()
+				e = newEncoder(&buf, opts)
+				e.BeginObject()
+				if err := e.Key(s); err == nil {
+					t.Fatalf("[%s] Expected key %q to fail with %+v\n", name, s, opts)
+				}
+				e.Key("k")
+				if err := e.String(s); err == nil {
+					t.Fatalf("[%s] Expected string %q to fail with %+v\n", name, s, opts)
+				}
+				if err := e.String("ok"); err != nil {
+					t.Fatalf("[%s] Expected a valid string to pass after a rejected one: %v\n", name, err)
+				}
+				e.EndObject()
+				if err := e.Close(); err != nil || buf.String() != `{"k":"ok"}` {
+					t.Fatalf("[%s] Expected {\"k\":\"ok\"}, got %s (%v)\n", name, buf.String(), err)
+				}
+			}
+		}
+	}
+}
+
+func TestEncodeForeignValue(t *testing.T) {
+	input := `{"b":[1,-2,18446744073709551615,"x"],"a":{"c":null,"d":false}}`
+	for name, newEncoder := range optionEncoders {
+		for _, parse := range parsers {
+			v, _ := parse(input)
+			var buf bytes.Buffer
+			e := newEncoder(&buf, jog.WriterOptions{})
+			e.BeginArray()
+			if err := e.Value(v); err != nil {
+				t.Fatalf("[%s] Couldn't encode value: %v\n", name, err)
+			}
+			e.EndArray()
+			if err := e.Close(); err != nil {
+				t.Fatalf("[%s] Couldn't close encoder: %v\n", name, err)
+			}
+			got, err := parse(buf.String())
+			if err != nil {
+				t.Fatalf("[%s] Couldn't parse %s: %v\n", name, buf.String(), err)
+			}
+			if elem, _ := got.GetArray(); len(elem) != 1 || !jog.Equal(elem[0], v) {
+				t.Fatalf("[%s] Expected [%s], got %s\n", name, input, buf.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/anantn/jog"
+)
+
+var PRESENCE = `{"a":null,"b":{"c":null,"d":0,"e":""},"f":[null],"g":false}`
+
+func TestExists(t *testing.T) {
+	type check struct {
+		path   []string
+		typ    jog.Type
+		exists bool
+		null   bool
+	}
+	checks := []check{
+		{nil, jog.TypeObject, true, false},
+		{[]string{"a"}, jog.TypeNull, true, true},
+		{[]string{"b", "c"}, jog.TypeNull, true, true},
+		{[]string{"b", "d"}, jog.TypeNumber, true, false},
+		{[]string{"b", "e"}, jog.TypeString, true, false},
+		{[]string{"g"}, jog.TypeBool, true, false},
+		{[]string{"missing"}, jog.TypeMissing, false, false},
+		{[]string{"b", "missing"}, jog.TypeMissing, false, false},
+		// Paths through nulls, arrays and scalars find nothing.
+		{[]string{"a", "x"}, jog.TypeMissing, false, false},
+		{[]string{"f", "0"}, jog.TypeMissing, false, false},
+		{[]string{"b", "d", "x"}, jog.TypeMissing, false, false},
+	}
+	for name, parse := range numberParsers() {
+		v, err := parse(PRESENCE)
+		if err != nil {
+			t.Fatalf("[%s] Parse failed: %v\n", name, err)
+		}
+		for _, view := range []jog.Value{v, jog.Coerce(v)} {
+			for _, c := range checks {
+				if typ := view.Type(c.path...); typ != c.typ {
+					t.Fatalf("[%s] Expected %v to be %s, got %s\n", name, c.path, c.typ, typ)
+				}
+				if exists := view.Exists(c.path...); exists != c.exists {
+					t.Fatalf("[%s] Expected Exists(%v) to be %v\n", name, c.path, c.exists)
+				}
+				if null := view.IsNull(c.path...); null != c.null {
+					t.Fatalf("[%s] Expected IsNull(%v) to be %v\n", name, c.path, c.null)
+				}
+				p := jog.CompilePath(c.path...)
+				if p.Type(view) != c.typ || p.Exists(view) != c.exists || p.IsNull(view) != c.null {
+					t.Fatalf("[%s] Expected the compiled path %s to agree with %v\n", name, p, c.path)
+				}
+			}
+		}
+	}
+	if s := jog.TypeMissing.String(); s != "missing" {
+		t.Fatalf("Expected TypeMissing to print as missing, got %s\n", s)
+	}
+}
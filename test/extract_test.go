@@ -0,0 +1,138 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/anantn/jog"
+)
+
+var sampleFields = []jog.Field{
+	{Path: jog.CompilePath("details", "age"), Type: jog.TypeNumber},
+	{Path: jog.CompilePath("details", "longitude"), Type: jog.TypeNumber},
+	{Path: jog.CompilePath("isActive"), Type: jog.TypeBool},
+	{Path: jog.CompilePath("guid"), Type: jog.TypeString},
+	{Path: jog.CompilePath("tags"), Type: jog.TypeArray},
+	{Path: jog.CompilePath("missing"), Type: jog.TypeString},
+	{Path: jog.CompilePath("tags", "0"), Type: jog.TypeString},
+	{Path: jog.CompilePath("details"), Type: jog.TypeArray},
+	{Path: jog.CompilePath("latitude"), Type: jog.TypeUnknown},
+	{Path: jog.CompilePath(), Type: jog.TypeObject},
+}
+
+func TestExtract(t *testing.T) {
+	expected := []jog.Result{
+		{Type: jog.TypeNumber, Int: 36, Float: 36, Integer: true},
+		{Type: jog.TypeNumber, Float: 102.563977},
+		{Type: jog.TypeBool, Bool: true},
+		{Type: jog.TypeString, String: "b4940c5c-82ee-4f5e-bd02-f847fe2b9fc6"},
+		{Type: jog.TypeArray},
+		{Status: jog.FieldMissing},
+		{Status: jog.FieldMissing},
+		{Status: jog.FieldMismatch, Type: jog.TypeObject},
+		{Type: jog.TypeNumber, Float: -59.816976},
+		{Type: jog.TypeObject},
+	}
+	for name, parse := range optionParsers {
+		for _, opts := range []jog.Options{{}, lazy} {
+			v, _ := parse([]byte(SAMPLE), opts)
+			results := jog.Extract(v, sampleFields)
+			for i, r := range results {
+				want := expected[i]
+				if r.Value != nil {
+					found, _ := sampleFields[i].Path.Get(v)
+					if !jog.Equal(r.Value, found) {
+						t.Fatalf("[%s] Expected the value at %s\n", name, sampleFields[i].Path)
+					}
+					want.Value = r.Value
+				}
+				if r != want {
+					t.Fatalf("[%s] Expected %+v at %s, got %+v\n", name, want, sampleFields[i].Path, r)
+				}
+			}
+			if results[4].Value == nil || results[8].Value == nil || results[9].Value == nil {
+				t.Fatalf("[%s] Expected values for the array, object and untyped fields\n", name)
+			}
+		}
+	}
+}
+
+func TestExtractNumbers(t *testing.T) {
+	input := `{"big":9223372036854775807,"huge":18446744073709551615,"neg":-12,"exp":1e2,"frac":1.0}`
+	fields := []jog.Field{}
+	for _, key := range []string{"big", "huge", "neg", "exp", "frac"} {
+		fields = append(fields, jog.Field{Path: jog.CompilePath(key), Type: jog.TypeNumber})
+	}
+	expected := []jog.Result{
+		{Type: jog.TypeNumber, Int: 9223372036854775807, Float: 9223372036854775807, Integer: true},
+		{Type: jog.TypeNumber, Float: 18446744073709551615},
+		{Type: jog.TypeNumber, Int: -12, Float: -12, Integer: true},
+		{Type: jog.TypeNumber, Float: 100},
+		{Type: jog.TypeNumber, Float: 1},
+	}
+	for name, parse := range optionParsers {
+		for _, opts := range []jog.Options{{}, lazy} {
+			v, err := parse([]byte(input), opts)
+			if err != nil {
+				t.Fatalf("[%s] Couldn't parse %s: %v\n", name, input, err)
+			}
+			for i, r := range jog.Extract(v, fields) {
+				if r != expected[i] {
+					t.Fatalf("[%s] Expected %+v at %s, got %+v\n", name, expected[i], fields[i].Path, r)
+				}
+			}
+		}
+	}
+}
+
+// A key holding a NUL byte is not the key it starts with, in a batch as in
+// a single lookup.
+func TestExtractNulKey(t *testing.T) {
+	fields := []jog.Field{
+		{Path: jog.CompilePath("a\x00b"), Type: jog.TypeNumber},
+		{Path: jog.CompilePath("a"), Type: jog.TypeNumber},
+	}
+	for name, parse := range optionParsers {
+		for _, opts := range []jog.Options{{}, lazy} {
+			v, _ := parse([]byte(`{"a":1}`), opts)
+			results := jog.Extract(v, fields)
+			if results[0].Status != jog.FieldMissing {
+				t.Fatalf("[%s] Expected a\\x00b to be missing, got %+v\n", name, results[0])
+			}
+			if _, err := v.Get("a\x00b"); err == nil {
+				t.Fatalf("[%s] Expected Get to agree with Extract\n", name)
+			}
+			if results[1].Status != jog.FieldFound || results[1].Int != 1 {
+				t.Fatalf("[%s] Expected a to be 1, got %+v\n", name, results[1])
+			}
+		}
+	}
+}
+
+func BenchmarkExtract(b *testing.B) {
+	for name, parse := range optionParsers {
+		v, _ := parse([]byte(SAMPLE), jog.Options{})
+		b.Run(name+"/getters", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				v.GetInt("details", "age")
+				v.GetFloat("details", "longitude")
+				v.GetBool("isActive")
+				v.GetString("guid")
+				v.GetString("registered")
+				v.GetFloat("latitude")
+			}
+		})
+		fields := []jog.Field{
+			{Path: jog.CompilePath("details", "age"), Type: jog.TypeNumber},
+			{Path: jog.CompilePath("details", "longitude"), Type: jog.TypeNumber},
+			{Path: jog.CompilePath("isActive"), Type: jog.TypeBool},
+			{Path: jog.CompilePath("guid"), Type: jog.TypeString},
+			{Path: jog.CompilePath("registered"), Type: jog.TypeString},
+			{Path: jog.CompilePath("latitude"), Type: jog.TypeNumber},
+		}
+		b.Run(name+"/extract", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				jog.Extract(v, fields)
+			}
+		})
+	}
+}
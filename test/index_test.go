@@ -0,0 +1,84 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/anantn/jog"
+)
+
+func TestIndexAllocations(t *testing.T) {
+	for name, parse := range optionParsers {
+		v, _ := parse([]byte(SAMPLE), jog.Options{})
+		tags := mustGet(t, v, "tags")
+		friends := mustGet(t, v, "friends")
+		allocs := testing.AllocsPerRun(100, func() {
+			if n, err := tags.Len(); err != nil || n != 7 {
+				t.Fatalf("[%s] Expected 7 tags, got %d (%v)\n", name, n, err)
+			}
+			if n, err := friends.Len(); err != nil || n != 3 {
+				t.Fatalf("[%s] Expected 3 friends, got %d (%v)\n", name, n, err)
+			}
+			if s, err := tags.IndexString(1); err != nil || s != "sint" {
+				t.Fatalf("[%s] Expected sint, got %q (%v)\n", name, s, err)
+			}
+		})
+		// Only the Go string of the tag is allocated.
+		if allocs > 1 {
+			t.Fatalf("[%s] Expected at most 1 allocation, got %v\n", name, allocs)
+		}
+	}
+}
+
+func TestCoercedIndex(t *testing.T) {
+	for name, parse := range numberParsers() {
+		v, err := parse(`{"list":["1",2.0,"true",7]}`)
+		if err != nil {
+			t.Fatalf("[%s] Parse failed: %v\n", name, err)
+		}
+		c := jog.Coerce(v)
+		if i, err := c.IndexInt(0, "list"); err != nil || i != 1 {
+			t.Fatalf("[%s] Expected \"1\" to coerce to 1, got %d (%v)\n", name, i, err)
+		}
+		if u, err := c.IndexUInt(1, "list"); err != nil || u != 2 {
+			t.Fatalf("[%s] Expected 2.0 to coerce to 2, got %d (%v)\n", name, u, err)
+		}
+		if b, err := c.IndexBool(2, "list"); err != nil || !b {
+			t.Fatalf("[%s] Expected \"true\" to coerce to true, got %v (%v)\n", name, b, err)
+		}
+		if s, err := c.IndexString(3, "list"); err != nil || s != "7" {
+			t.Fatalf("[%s] Expected 7 to coerce to \"7\", got %q (%v)\n", name, s, err)
+		}
+		e, err := c.Index(0, "list")
+		if err != nil {
+			t.Fatalf("[%s] Couldn't get element 0: %v\n", name, err)
+		}
+		if f, err := e.GetFloat(); err != nil || f != 1 {
+			t.Fatalf("[%s] Expected the element to be coerced too, got %v (%v)\n", name, f, err)
+		}
+		_, err = c.IndexInt(4, "list")
+		checkPathError(t, name, err, jog.PathError{Path: []string{"list", "4"}, Segment: 1, Expected: "int", Actual: jog.TypeArray, Err: jog.ErrNotFound})
+	}
+}
+
+func BenchmarkIndex(b *testing.B) {
+	for name, parse := range optionParsers {
+		v, _ := parse([]byte(SAMPLE), jog.Options{})
+		b.Run(name+"/GetArray", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				friends, _ := v.GetArray("friends")
+				friends[2].GetInt("id")
+			}
+		})
+		b.Run(name+"/Index", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				friend, _ := v.Index(2, "friends")
+				friend.GetInt("id")
+			}
+		})
+		b.Run(name+"/Len", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				v.Len("friends")
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package test
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/anantn/jog"
+)
+
+// A document with an array of n objects, each with an id, and an object
+// with n members.
+func largeDocument(n int) []byte {
+	var items, members strings.Builder
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			items.WriteByte(',')
+			members.WriteByte(',')
+		}
+		items.WriteString(`{"id":` + strconv.Itoa(i) + `}`)
+		members.WriteString(`"k` + strconv.Itoa(i) + `":[]`)
+	}
+	return []byte(`{"items":[` + items.String() + `],"members":{` + members.String() + `}}`)
+}
+
+// Stepping through a large array or object allocates the same few times as
+// a small one.
+func TestIteratorAllocations(t *testing.T) {
+	const n = 100000
+	data := largeDocument(n)
+	for name, parse := range optionParsers {
+		for _, opts := range []jog.Options{{}, lazy} {
+			v, err := parse(data, opts)
+			if err != nil {
+				t.Fatalf("[%s] Parse failed: %v\n", name, err)
+			}
+			count := 0
+			allocs := testing.AllocsPerRun(5, func() {
+				count = 0
+				for _, item := range v.Elements("items") {
+					if n, _ := item.Len(); n == 1 {
+						count++
+					}
+				}
+				it, _ := v.ObjectIterator("members")
+				for it.Next() {
+					if n, err := it.Value().Len(); err == nil && n == 0 {
+						count++
+					}
+				}
+			})
+			if count != 2*n {
+				t.Fatalf("[%s] Expected %d values, got %d\n", name, 2*n, count)
+			}
+			if allocs > 20 {
+				t.Fatalf("[%s] Expected a few allocations, got %v\n", name, allocs)
+			}
+		}
+	}
+}
+
+func BenchmarkIterator(b *testing.B) {
+	data := largeDocument(100000)
+	for name, parse := range optionParsers {
+		v, _ := parse(data, jog.Options{})
+		b.Run(name+"/GetArray", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				items, _ := v.GetArray("items")
+				for _, item := range items {
+					item.Len()
+				}
+			}
+		})
+		b.Run(name+"/Elements", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for _, item := range v.Elements("items") {
+					item.Len()
+				}
+			}
+		})
+		b.Run(name+"/ObjectIterator", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				it, _ := v.ObjectIterator("members")
+				for it.Next() {
+					it.Value().Len()
+				}
+			}
+		})
+	}
+}
@@ -4,8 +4,6 @@ import (
 	"testing"
 
 	"github.com/anantn/jog"
-	"github.com/anantn/jog/rapid"
-	"github.com/anantn/jog/yajl"
 )
 
 var SAMPLE = `{"index":0,"_id":"54c7fff8e3268528239d9cb1","guid":"b4940c5c-82ee-4f5e-bd02-f847fe2b9fc6","isActive":true,"balance":"$1,750.21","details":{"age":36,"eyeColor":"brown","longitude":102.563977},"registered":"2014-10-12T09:38:08 +07:00","latitude":-59.816976,"tags":["nisi","sint","aute","tempor","sit","esse","in"],"friends":[{"id":0,"name":"Case Gross"},{"id":1,"name":"Gilbert Rasmussen"},{"id":2,"name":"Harris Huff"}]}`
@@ -16,15 +14,15 @@ type TestCase struct {
 }
 
 func GetSamples(t *testing.T) []jog.Value {
-	robj, err := rapid.New(SAMPLE)
-	if err != nil {
-		t.Fatalf("Couldn't parse sample JSON with Rapid: %v\n", err)
-	}
-	yobj, err := yajl.New(SAMPLE)
-	if err != nil {
-		t.Fatalf("Couldn't parse sample JSON with YAJL: %v\n", err)
+	var samples []jog.Value
+	for name, parse := range optionParsers {
+		v, err := parse([]byte(SAMPLE), jog.Options{})
+		if err != nil {
+			t.Fatalf("[%s] Couldn't parse sample JSON: %v\n", name, err)
+		}
+		samples = append(samples, v)
 	}
-	return []jog.Value{robj, yobj}
+	return samples
 }
 
 func DoTests(t *testing.T, objs []jog.Value, cases []TestCase) {
@@ -127,6 +125,8 @@ func DoTests(t *testing.T, objs []jog.Value, cases []TestCase) {
 				if got != val {
 					t.Fatalf("Expected %v, got %v\n", val, got)
 				}
+			default:
+				t.Fatalf("Unsupported expected value %#v\n", val)
 			}
 		}
 	}
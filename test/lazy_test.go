@@ -0,0 +1,164 @@
+package test
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/anantn/jog"
+)
+
+var lazy = jog.Options{Lazy: true}
+
+func TestLazyMatchesEager(t *testing.T) {
+	inputs := []string{
+		SAMPLE,
+		growingDocument(50),
+		` {"a\"b":1,"cd":{"x":[1,-2.5e3,"é\n"]},"a":true,"a":false,"e":{},"f":[]} `,
+		`42`,
+		`"s"`,
+		`null`,
+		`[[[]],[{}]]`,
+	}
+	for name, parse := range optionParsers {
+		for _, input := range inputs {
+			eager, err := parse([]byte(input), jog.Options{})
+			if err != nil {
+				t.Fatalf("[%s] Couldn't parse %s: %v\n", name, input, err)
+			}
+			v, err := parse([]byte(input), lazy)
+			if err != nil {
+				t.Fatalf("[%s] Couldn't parse %s lazily: %v\n", name, input, err)
+			}
+			if !jog.Equal(v, eager) {
+				t.Fatalf("[%s] Expected %s to read the same lazily\n", name, input)
+			}
+			want, _ := eager.Stringify()
+			if got, err := v.Stringify(); err != nil || got != want {
+				t.Fatalf("[%s] Expected %s, got %s (%v)\n", name, want, got, err)
+			}
+		}
+		eager, _ := parse([]byte(SAMPLE), jog.Options{})
+		v, _ := parse([]byte(SAMPLE), lazy)
+		if want, got := readSample(eager), readSample(v); got != want {
+			t.Fatalf("[%s] Expected %s, got %s\n", name, want, got)
+		}
+		if _, err := v.GetInt("tags"); err == nil {
+			t.Fatalf("[%s] Expected GetInt on an array to fail\n", name)
+		}
+		if _, err := v.Get("tags", "0"); err == nil {
+			t.Fatalf("[%s] Expected a path through an array to fail\n", name)
+		}
+		if v.Type("missing") != jog.TypeMissing {
+			t.Fatalf("[%s] Expected a missing type for a missing member\n", name)
+		}
+	}
+}
+
+func TestLazyErrors(t *testing.T) {
+	inputs := []string{`{"a":`, `[1,]`, `{"a" 1}`, `[1] 2`, ``}
+	for name, parse := range optionParsers {
+		for _, input := range inputs {
+			_, eagerErr := parse([]byte(input), jog.Options{})
+			_, err := parse([]byte(input), lazy)
+			if err == nil || err.Error() != eagerErr.Error() {
+				t.Fatalf("[%s] Expected %v for %q, got %v\n", name, eagerErr, input, err)
+			}
+		}
+		limits := jog.Options{Lazy: true, Limits: jog.Limits{MaxDepth: 2, MaxMembers: 2}}
+		for _, input := range []string{`[[[1]]]`, `{"a":[1,2,3]}`} {
+			_, eagerErr := parse([]byte(input), jog.Options{Limits: limits.Limits})
+			_, err := parse([]byte(input), limits)
+			if err == nil || err.Error() != eagerErr.Error() {
+				t.Fatalf("[%s] Expected %v for %s, got %v\n", name, eagerErr, input, err)
+			}
+		}
+	}
+}
+
+func TestLazyParsesOnDemand(t *testing.T) {
+	for name, parse := range optionParsers {
+		v, _ := parse([]byte(SAMPLE), lazy)
+		if v.MemoryUsage() != 0 {
+			t.Fatalf("[%s] Expected nothing to be parsed yet, got %d bytes\n", name, v.MemoryUsage())
+		}
+		if s, _ := v.GetString("friends", "x"); s != "" || v.Type("details") != jog.TypeObject {
+			t.Fatalf("[%s] Expected the structure without parsing\n", name)
+		}
+		if v.MemoryUsage() != 0 {
+			t.Fatalf("[%s] Expected lookups not to parse, got %d bytes\n", name, v.MemoryUsage())
+		}
+		if age, _ := v.GetInt("details", "age"); age != 36 || v.MemoryUsage() == 0 {
+			t.Fatalf("[%s] Expected the age to be parsed, got %d and %d bytes\n", name, age, v.MemoryUsage())
+		}
+	}
+}
+
+func TestLazyComments(t *testing.T) {
+	input := "{/* a */\"a\": [1, // b\n 2], \"c\": \"/*\"}\n// end"
+	v, err := optionParsers["yajl"]([]byte(input), lazy)
+	if err != nil {
+		t.Fatalf("Couldn't parse comments lazily: %v\n", err)
+	}
+	eager, _ := optionParsers["yajl"]([]byte(input), jog.Options{})
+	if !jog.Equal(v, eager) {
+		t.Fatalf("Expected comments to be skipped\n")
+	}
+}
+
+func TestLazyConcurrentReads(t *testing.T) {
+	for name, parse := range optionParsers {
+		eager, _ := parse([]byte(SAMPLE), jog.Options{})
+		want := readSample(eager)
+		v, _ := parse([]byte(SAMPLE), lazy)
+		var wg sync.WaitGroup
+		errs := make(chan string, readers)
+		for r := 0; r < readers; r++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if got := readSample(v); got != want {
+					errs <- fmt.Sprintf("[%s] Expected %s, got %s", name, want, got)
+				}
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Fatalf("%s\n", err)
+		}
+	}
+}
+
+// A 200 KB payload of which a request only reads a few fields.
+func largePayload() []byte {
+	var b strings.Builder
+	b.WriteString(`{"id":12345,"items":`)
+	b.WriteString(growingDocument(2000))
+	b.WriteString(`,"meta":{"owner":"jog","version":3},"status":"ok"}`)
+	return []byte(b.String())
+}
+
+func BenchmarkParseFewGets(b *testing.B) {
+	data := largePayload()
+	for _, mode := range []struct {
+		name string
+		opts jog.Options
+	}{{"eager", jog.Options{}}, {"lazy", lazy}} {
+		for name, parse := range optionParsers {
+			b.Run(name+"/"+mode.name, func(b *testing.B) {
+				b.SetBytes(int64(len(data)))
+				for i := 0; i < b.N; i++ {
+					v, err := parse(data, mode.opts)
+					if err != nil {
+						b.Fatal(err)
+					}
+					v.GetInt("id")
+					v.GetString("meta", "owner")
+					v.GetString("status")
+				}
+			})
+		}
+	}
+}
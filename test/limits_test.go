@@ -0,0 +1,156 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/anantn/jog"
+	"github.com/anantn/jog/merge"
+	"github.com/anantn/jog/rapid"
+	"github.com/anantn/jog/tree"
+	"github.com/anantn/jog/yajl"
+)
+
+func TestLimits(t *testing.T) {
+	cases := []struct {
+		input  string
+		limits jog.Limits
+		limit  jog.Limit
+		offset int
+	}{
+		{`[1,2,3]`, jog.Limits{MaxSize: 5}, jog.LimitSize, 5},
+		{`{"a":[[1]]}`, jog.Limits{MaxDepth: 2}, jog.LimitDepth, 7},
+		{`[[{}]]`, jog.Limits{MaxDepth: 1}, jog.LimitDepth, 2},
+		{`["ab","abcd"]`, jog.Limits{MaxStringLength: 3}, jog.LimitStringLength, 12},
+		{`{"abcd":1}`, jog.Limits{MaxStringLength: 3}, jog.LimitStringLength, 7},
+		{`["éé"]`, jog.Limits{MaxStringLength: 3}, jog.LimitStringLength, 7},
+		{`[1,2,3]`, jog.Limits{MaxMembers: 2}, jog.LimitMembers, 6},
+		{`{"a":1,"b":2,"c":3}`, jog.Limits{MaxMembers: 2}, jog.LimitMembers, 16},
+		{`{"a":[[],{},"x"]}`, jog.Limits{MaxMembers: 2}, jog.LimitMembers, 15},
+	}
+	for name, parse := range optionParsers {
+		for _, test := range cases {
+			_, err := parse([]byte(test.input), jog.Options{Limits: test.limits})
+			var limitErr *jog.LimitError
+			if !errors.As(err, &limitErr) {
+				t.Fatalf("[%s] Expected a LimitError for %s, got %v\n", name, test.input, err)
+			}
+			if limitErr.Limit != test.limit || limitErr.Max != test.limits.Get(test.limit) || limitErr.Offset != test.offset {
+				t.Fatalf("[%s] Expected %s of %d at %d for %s, got %v\n", name, test.limit, test.limits.Get(test.limit), test.offset, test.input, err)
+			}
+		}
+	}
+}
+
+func TestWithinLimits(t *testing.T) {
+	limits := jog.Limits{MaxSize: len(SAMPLE), MaxDepth: 3, MaxStringLength: 36, MaxMembers: 10}
+	for name, parse := range optionParsers {
+		v, err := parse([]byte(SAMPLE), jog.Options{Limits: limits})
+		if err != nil {
+			t.Fatalf("[%s] Couldn't parse within %+v: %v\n", name, limits, err)
+		}
+		want, _ := parsers[0](SAMPLE)
+		if !jog.Equal(v, want) {
+			t.Fatalf("[%s] Expected the sample document\n", name)
+		}
+		if _, err := parse([]byte(`[1,`), jog.Options{Limits: limits}); err == nil || errors.As(err, new(*jog.LimitError)) {
+			t.Fatalf("[%s] Expected a syntax error, got %v\n", name, err)
+		}
+	}
+}
+
+func TestLimitsEncoded(t *testing.T) {
+	data := encode(`{"key":"value"}`, jog.EncodingUTF16LE, true)
+	for name, parse := range optionParsers {
+		_, err := parse(data, jog.Options{Encoding: jog.EncodingAuto, Limits: jog.Limits{MaxStringLength: 4}})
+		var limitErr *jog.LimitError
+		if !errors.As(err, &limitErr) || limitErr.Limit != jog.LimitStringLength {
+			t.Fatalf("[%s] Expected MaxStringLength to be exceeded, got %v\n", name, err)
+		}
+	}
+}
+
+func TestDeepNesting(t *testing.T) {
+	depth := 1 << 20
+	input := []byte(strings.Repeat("[", depth) + strings.Repeat("]", depth))
+	for name, parse := range optionParsers {
+		if _, err := parse(input, jog.Options{}); err != nil {
+			t.Fatalf("[%s] Couldn't parse %d nested arrays: %v\n", name, depth, err)
+		}
+		_, err := parse(input, jog.Options{Limits: jog.Limits{MaxDepth: 64}})
+		var limitErr *jog.LimitError
+		if !errors.As(err, &limitErr) || limitErr.Limit != jog.LimitDepth || limitErr.Offset != 65 {
+			t.Fatalf("[%s] Expected MaxDepth to be exceeded at 65, got %v\n", name, err)
+		}
+	}
+}
+
+func nested(depth int) []byte {
+	return []byte(strings.Repeat("[", depth) + strings.Repeat("]", depth))
+}
+
+// rapid writes any depth it parses, natively or not. yajl's generator stops
+// past yajl.MaxDepth.
+func TestDeepNestingStringify(t *testing.T) {
+	for _, opts := range []jog.Options{{}, lazy} {
+		deep := nested(1 << 20)
+		v, err := rapid.NewWithOptions(deep, opts)
+		if err != nil {
+			t.Fatalf("Parse failed: %v\n", err)
+		}
+		if s, err := v.Stringify(); err != nil || s != string(deep) {
+			t.Fatalf("Expected rapid to stringify %d nested arrays, got %v\n", 1<<20, err)
+		}
+		// Lazy values are written token by token, which gets slow this deep.
+		if !opts.Lazy {
+			var buf bytes.Buffer
+			if err := encodeValue(rapid.NewEncoder(&buf), v); err != nil || buf.String() != string(deep) {
+				t.Fatalf("Expected the rapid encoder to write %d nested arrays, got %v\n", 1<<20, err)
+			}
+		}
+
+		v, _ = yajl.NewWithOptions(nested(yajl.MaxDepth), opts)
+		if s, err := v.Stringify(); err != nil || s != string(nested(yajl.MaxDepth)) {
+			t.Fatalf("Expected yajl to stringify %d nested arrays, got %v\n", yajl.MaxDepth, err)
+		}
+		for _, depth := range []int{yajl.MaxDepth + 1, 1 << 16} {
+			v, err := yajl.NewWithOptions(nested(depth), opts)
+			if err != nil {
+				t.Fatalf("Parse failed: %v\n", err)
+			}
+			if _, err := v.Stringify(); err != yajl.ErrMaxDepth {
+				t.Fatalf("Expected yajl to fail on %d nested arrays, got %v\n", depth, err)
+			}
+			if err := encodeValue(yajl.NewEncoder(io.Discard), v); err != yajl.ErrMaxDepth {
+				t.Fatalf("Expected the yajl encoder to fail on %d nested arrays, got %v\n", depth, err)
+			}
+		}
+	}
+}
+
+func encodeValue(e jog.Encoder, v jog.Value) error {
+	if err := e.Value(v); err != nil {
+		e.Close()
+		return err
+	}
+	return e.Close()
+}
+
+// Trees copy documents of any depth, beyond what encoding/json decodes.
+func TestDeepNestingCopy(t *testing.T) {
+	for name, parse := range optionParsers {
+		for _, depth := range []int{200, 20000} {
+			v, _ := parse(nested(depth), jog.Options{})
+			merged, err := merge.MergePatch(tree.Object(), v)
+			if err != nil {
+				t.Fatalf("[%s] Couldn't merge %d nested arrays: %v\n", name, depth, err)
+			}
+			if !jog.Equal(merged, v) {
+				t.Fatalf("[%s] Expected the merge to keep %d nested arrays\n", name, depth)
+			}
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package test
+
+import (
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/anantn/jog"
+	"github.com/anantn/jog/rapid"
+	"github.com/anantn/jog/yajl"
+)
+
+var backendStats = map[string]func() jog.MemoryStats{
+	"rapid": rapid.Stats,
+	"yajl":  yajl.Stats,
+}
+
+// Collect garbage and wait for the finalizers it queued to run. The
+// finalizer goroutine runs queued finalizers a batch at a time, so once one
+// queued by a second collection has run, all those of the first have.
+func runFinalizers() {
+	for i := 0; i < 2; i++ {
+		done := make(chan bool)
+		sentinel := &struct{ p *int }{}
+		runtime.SetFinalizer(sentinel, func(*struct{ p *int }) { close(done) })
+		sentinel = nil
+		runtime.GC()
+		<-done
+	}
+}
+
+// Finalizers of earlier tests free memory at any time, so only the
+// monotonic counters are compared exactly.
+func TestMemoryStats(t *testing.T) {
+	input := growingDocument(1000)
+	for name, parse := range optionParsers {
+		stats := backendStats[name]
+		runFinalizers()
+		before := stats()
+		doc, err := parse([]byte(input), jog.Options{})
+		if err != nil {
+			t.Fatalf("[%s] Couldn't parse: %v\n", name, err)
+		}
+		during := stats()
+		if during.TotalAlloc-before.TotalAlloc < int64(len(input)) || during.Mallocs <= before.Mallocs {
+			t.Fatalf("[%s] Expected the document to be counted, got %+v then %+v\n", name, before, during)
+		}
+		if total := jog.Stats(); total.TotalAlloc < during.TotalAlloc || total.Mallocs < during.Mallocs {
+			t.Fatalf("[%s] Expected jog.Stats to include %+v, got %+v\n", name, during, total)
+		}
+		usage := int64(doc.MemoryUsage())
+		if usage <= 0 || during.InUse-before.InUse < usage {
+			t.Fatalf("[%s] Expected the %d bytes of the document to be in use, got %+v then %+v\n", name, usage, before, during)
+		}
+		runtime.KeepAlive(doc)
+
+		runFinalizers()
+		if after := stats(); during.InUse-after.InUse < usage || after.Frees <= during.Frees {
+			t.Fatalf("[%s] Expected the document of %d bytes to be freed, got %+v then %+v\n", name, usage, during, after)
+		}
+	}
+}
+
+func TestMemoryUsage(t *testing.T) {
+	for name, parse := range optionParsers {
+		small, _ := parse([]byte(SAMPLE), jog.Options{})
+		large, _ := parse([]byte(growingDocument(1000)), jog.Options{})
+		if small.MemoryUsage() <= len(SAMPLE)/2 || large.MemoryUsage() <= small.MemoryUsage() {
+			t.Fatalf("[%s] Expected usage to grow with the document, got %d and %d\n", name, small.MemoryUsage(), large.MemoryUsage())
+		}
+		friends, _ := small.Get("friends")
+		if friends.MemoryUsage() != small.MemoryUsage() {
+			t.Fatalf("[%s] Expected a child to report its document, got %d for %d\n", name, friends.MemoryUsage(), small.MemoryUsage())
+		}
+	}
+	for name, newParser := range newParsers {
+		p := newParser(jog.Options{})
+		large, _ := p.Parse([]byte(growingDocument(1000)))
+		largeUsage := large.MemoryUsage()
+		small, _ := p.Parse([]byte(SAMPLE))
+		if small.MemoryUsage() <= 0 || small.MemoryUsage() >= largeUsage {
+			t.Fatalf("[%s] Expected a parser to report its current document, got %d after %d\n", name, small.MemoryUsage(), largeUsage)
+		}
+	}
+}
+
+func TestMemoryBudget(t *testing.T) {
+	inputs := []string{
+		growingDocument(100),
+		`"` + strings.Repeat("x", 10000) + `"`,
+	}
+	for name, parse := range optionParsers {
+		for _, input := range inputs {
+			_, err := parse([]byte(input), jog.Options{Limits: jog.Limits{MaxMemory: 4096}})
+			var limitErr *jog.LimitError
+			if !errors.As(err, &limitErr) || limitErr.Limit != jog.LimitMemory || limitErr.Max != 4096 || limitErr.Offset == 0 {
+				t.Fatalf("[%s] Expected MaxMemory to be exceeded by %.20s, got %v\n", name, input, err)
+			}
+		}
+		if _, err := parse([]byte(SAMPLE), jog.Options{Limits: jog.Limits{MaxMemory: 1 << 20}}); err != nil {
+			t.Fatalf("[%s] Couldn't parse within the memory budget: %v\n", name, err)
+		}
+	}
+	for name, newParser := range newParsers {
+		p := newParser(jog.Options{Limits: jog.Limits{MaxMemory: 1 << 16}})
+		if _, err := p.Parse([]byte(growingDocument(10000))); !errors.As(err, new(*jog.LimitError)) {
+			t.Fatalf("[%s] Expected a parser to enforce MaxMemory, got %v\n", name, err)
+		}
+		if _, err := p.Parse([]byte(SAMPLE)); err != nil {
+			t.Fatalf("[%s] Couldn't parse within the memory budget: %v\n", name, err)
+		}
+	}
+}
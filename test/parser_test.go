@@ -0,0 +1,112 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/anantn/jog"
+	"github.com/anantn/jog/rapid"
+	"github.com/anantn/jog/yajl"
+)
+
+var newParsers = map[string]func(jog.Options) jog.Parser{
+	"rapid": func(opts jog.Options) jog.Parser { return rapid.NewParser(opts) },
+	"yajl":  func(opts jog.Options) jog.Parser { return yajl.NewParser(opts) },
+}
+
+// Documents of growing size, so the parser has to outgrow its memory.
+func growingDocument(n int) string {
+	var b strings.Builder
+	b.WriteString("[")
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		fmt.Fprintf(&b, `{"id":%d,"name":"item %d","tags":["a","b"],"score":%d.5}`, i, i, i)
+	}
+	b.WriteString("]")
+	return b.String()
+}
+
+func TestParserReuse(t *testing.T) {
+	for name, newParser := range newParsers {
+		p := newParser(jog.Options{})
+		for n := 0; n < 200; n += 7 {
+			input := growingDocument(n)
+			if n%3 == 0 {
+				input = SAMPLE
+			}
+			v, err := p.Parse([]byte(input))
+			if err != nil {
+				t.Fatalf("[%s] Couldn't parse document %d: %v\n", name, n, err)
+			}
+			want, _ := parsers[0](input)
+			if !jog.Equal(v, want) {
+				t.Fatalf("[%s] Expected document %d to equal a fresh parse\n", name, n)
+			}
+			if _, err := p.Parse([]byte(`{"a":`)); err == nil {
+				t.Fatalf("[%s] Expected a syntax error after document %d\n", name, n)
+			}
+			p.Reset()
+		}
+	}
+}
+
+func TestParserOptions(t *testing.T) {
+	for name, newParser := range newParsers {
+		p := newParser(jog.Options{Encoding: jog.EncodingAuto, Limits: jog.Limits{MaxDepth: 3}})
+		v, err := p.Parse(encode(SAMPLE, jog.EncodingUTF16LE, true))
+		if err != nil {
+			t.Fatalf("[%s] Couldn't parse an encoded document: %v\n", name, err)
+		}
+		want, _ := parsers[0](SAMPLE)
+		if !jog.Equal(v, want) {
+			t.Fatalf("[%s] Expected the sample document\n", name)
+		}
+		_, err = p.Parse([]byte(`[[[[1]]]]`))
+		var limitErr *jog.LimitError
+		if !errors.As(err, &limitErr) || limitErr.Limit != jog.LimitDepth {
+			t.Fatalf("[%s] Expected MaxDepth to be exceeded, got %v\n", name, err)
+		}
+	}
+}
+
+func TestParserPool(t *testing.T) {
+	want, _ := parsers[0](SAMPLE)
+	wantSample := readSample(want)
+	for name, newParser := range newParsers {
+		pool := jog.NewParserPool(func() jog.Parser { return newParser(jog.Options{}) })
+		var wg sync.WaitGroup
+		errs := make(chan string, readers)
+		for r := 0; r < readers; r++ {
+			wg.Add(1)
+			go func(r int) {
+				defer wg.Done()
+				for n := 0; n < 50; n++ {
+					p := pool.Get()
+					input := growingDocument((r + n) % 20)
+					v, err := p.Parse([]byte(input))
+					other, _ := parsers[0](input)
+					if err != nil || !jog.Equal(v, other) {
+						errs <- fmt.Sprintf("[%s] Expected a pooled parse to equal a fresh parse (%v)", name, err)
+						return
+					}
+					v, err = p.Parse([]byte(SAMPLE))
+					if err != nil || readSample(v) != wantSample {
+						errs <- fmt.Sprintf("[%s] Expected the sample from a pooled parser (%v)", name, err)
+						return
+					}
+					pool.Put(p)
+				}
+			}(r)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Fatalf("%s\n", err)
+		}
+	}
+}
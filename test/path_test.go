@@ -0,0 +1,124 @@
+package test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/anantn/jog"
+)
+
+var (
+	agePath     = jog.CompilePath("details", "age")
+	missingPath = jog.CompilePath("details", "missing")
+)
+
+func TestCompiledPath(t *testing.T) {
+	for name, parse := range optionParsers {
+		for _, opts := range []jog.Options{{}, lazy} {
+			v, err := parse([]byte(SAMPLE), opts)
+			if err != nil {
+				t.Fatalf("[%s] Couldn't parse sample: %v\n", name, err)
+			}
+			if age, err := agePath.GetInt(v); err != nil || age != 36 {
+				t.Fatalf("[%s] Expected age 36, got %d (%v)\n", name, age, err)
+			}
+			want, _ := v.GetString("guid")
+			if got, err := jog.CompilePath("guid").GetString(v); err != nil || got != want {
+				t.Fatalf("[%s] Expected guid %s, got %s (%v)\n", name, want, got, err)
+			}
+			details, err := jog.CompilePath("details").Get(v)
+			if err != nil || !jog.Equal(details, mustGet(t, v, "details")) {
+				t.Fatalf("[%s] Expected the details object (%v)\n", name, err)
+			}
+			if root, err := jog.CompilePath().Get(v); err != nil || !jog.Equal(root, v) {
+				t.Fatalf("[%s] Expected an empty path to find the root (%v)\n", name, err)
+			}
+			if _, err := missingPath.Get(v); err == nil {
+				t.Fatalf("[%s] Expected an error for a missing member\n", name)
+			}
+			if typ := missingPath.Type(v); typ != jog.TypeMissing {
+				t.Fatalf("[%s] Expected a missing type for a missing member, got %s\n", name, typ)
+			}
+			// Paths through arrays and scalars find nothing.
+			if _, err := jog.CompilePath("tags", "0").Get(v); err == nil {
+				t.Fatalf("[%s] Expected a path through an array to fail\n", name)
+			}
+			if _, err := v.GetInt("details", "age", "years"); err == nil {
+				t.Fatalf("[%s] Expected a path through a number to fail\n", name)
+			}
+		}
+	}
+}
+
+// A compiled path is followed natively without converting its keys again,
+// so a lookup allocates nothing but the Value it returns.
+func TestCompiledPathAllocations(t *testing.T) {
+	for name, parse := range optionParsers {
+		v, _ := parse([]byte(SAMPLE), jog.Options{})
+		v.At(agePath)
+		var age jog.Value
+		before := jog.Stats()
+		allocs := testing.AllocsPerRun(100, func() {
+			age, _ = v.At(agePath)
+		})
+		if n, err := age.GetInt(); err != nil || n != 36 {
+			t.Fatalf("[%s] Expected age 36, got %d (%v)\n", name, n, err)
+		}
+		if after := jog.Stats(); after.Mallocs != before.Mallocs {
+			t.Fatalf("[%s] Expected no native allocations, got %d\n", name, after.Mallocs-before.Mallocs)
+		}
+		if allocs > 1 {
+			t.Fatalf("[%s] Expected at most 1 allocation, got %v\n", name, allocs)
+		}
+	}
+}
+
+func TestCompiledPathConcurrent(t *testing.T) {
+	for name, parse := range optionParsers {
+		v, _ := parse([]byte(SAMPLE), jog.Options{})
+		path := jog.CompilePath("details", "age")
+		var wg sync.WaitGroup
+		errs := make(chan error, readers)
+		for r := 0; r < readers; r++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 100; i++ {
+					if _, err := path.GetInt(v); err != nil {
+						errs <- err
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Fatalf("[%s] Couldn't read the age concurrently: %v\n", name, err)
+		}
+	}
+}
+
+func mustGet(t *testing.T, v jog.Value, path ...string) jog.Value {
+	n, err := v.Get(path...)
+	if err != nil {
+		t.Fatalf("Couldn't get %v: %v\n", path, err)
+	}
+	return n
+}
+
+func BenchmarkPathLookup(b *testing.B) {
+	for name, parse := range optionParsers {
+		v, _ := parse([]byte(SAMPLE), jog.Options{})
+		b.Run(name+"/strings", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				v.GetInt("details", "age")
+			}
+		})
+		b.Run(name+"/compiled", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				agePath.GetInt(v)
+			}
+		})
+	}
+}
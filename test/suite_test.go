@@ -0,0 +1,138 @@
+package test
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/anantn/jog"
+	"github.com/anantn/jog/tree"
+)
+
+// The test_parsing corpus of https://github.com/nst/JSONTestSuite. Parsers
+// must accept y_ files and reject n_ files; RFC 8259 leaves i_ files to them.
+const suiteDir = "testdata/JSONTestSuite"
+
+var updateReports = flag.Bool("update", false, "Rewrite the JSONTestSuite compliance reports")
+
+var suiteParsers = map[string]func([]byte) (jog.Value, error){
+	"rapid": func(data []byte) (jog.Value, error) { return optionParsers["rapid"](data, jog.Options{}) },
+	"yajl":  func(data []byte) (jog.Value, error) { return optionParsers["yajl"](data, jog.Options{}) },
+	"tree": func(data []byte) (jog.Value, error) {
+		v, err := tree.Parse(string(data))
+		if err != nil {
+			return nil, err
+		}
+		return v, nil
+	},
+}
+
+func suiteFiles(t *testing.T) map[string][]byte {
+	paths, err := filepath.Glob(filepath.Join(suiteDir, "test_parsing", "*.json"))
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("Couldn't find the JSONTestSuite files: %v\n", err)
+	}
+	files := map[string][]byte{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Couldn't read %s: %v\n", path, err)
+		}
+		files[filepath.Base(path)] = data
+	}
+	return files
+}
+
+// The report lists where a parser deviates from RFC 8259 and what it does
+// with each implementation-defined case.
+func suiteReport(name string, files map[string][]byte, accepts map[string]bool) string {
+	names := make([]string, 0, len(files))
+	for file := range files {
+		names = append(names, file)
+	}
+	slices.Sort(names)
+	result := func(file string) string {
+		if accepts[file] {
+			return "accepted"
+		}
+		return "rejected"
+	}
+	var deviations, defined []string
+	counts := map[string][2]int{}
+	for _, file := range names {
+		prefix := file[:2]
+		c := counts[prefix]
+		c[1]++
+		switch {
+		case prefix == "i_":
+			defined = append(defined, file+" "+result(file))
+		case accepts[file] == (prefix == "y_"):
+			c[0]++
+		default:
+			deviations = append(deviations, file+" "+result(file))
+		}
+		counts[prefix] = c
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "# JSONTestSuite test_parsing results for %s, written by\n", name)
+	fmt.Fprintf(&out, "# go test ./test -run TestJSONTestSuite -update\n")
+	fmt.Fprintf(&out, "#\n# y_ accepted: %d/%d\n", counts["y_"][0], counts["y_"][1])
+	fmt.Fprintf(&out, "# n_ rejected: %d/%d\n", counts["n_"][0], counts["n_"][1])
+	fmt.Fprintf(&out, "\n# Deviations from RFC 8259.\n")
+	for _, line := range deviations {
+		fmt.Fprintln(&out, line)
+	}
+	fmt.Fprintf(&out, "\n# Implementation-defined cases.\n")
+	for _, line := range defined {
+		fmt.Fprintln(&out, line)
+	}
+	return out.String()
+}
+
+func TestJSONTestSuite(t *testing.T) {
+	files := suiteFiles(t)
+	for name, parse := range suiteParsers {
+		accepts := map[string]bool{}
+		for file, data := range files {
+			_, err := parse(data)
+			accepts[file] = err == nil
+		}
+
+		// Lazy documents validate up front, so they accept the same files.
+		if lazyParse, ok := optionParsers[name]; ok {
+			for file, data := range files {
+				if _, err := lazyParse(data, lazy); (err == nil) != accepts[file] {
+					t.Fatalf("[%s] Expected lazy parsing of %s to agree with eager parsing, got %v\n", name, file, err)
+				}
+			}
+		}
+
+		path := filepath.Join(suiteDir, name+".txt")
+		report := suiteReport(name, files, accepts)
+		if *updateReports {
+			if err := os.WriteFile(path, []byte(report), 0644); err != nil {
+				t.Fatalf("[%s] Couldn't write the report: %v\n", name, err)
+			}
+			continue
+		}
+		want, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("[%s] Couldn't read the report, run with -update to write it: %v\n", name, err)
+		}
+		if string(want) != report {
+			wantLines := strings.Split(string(want), "\n")
+			var changed []string
+			for _, line := range strings.Split(report, "\n") {
+				if !slices.Contains(wantLines, line) {
+					changed = append(changed, line)
+				}
+			}
+			t.Fatalf("[%s] Results differ from %s, run with -update to accept them:\n%s\n", name, path, strings.Join(changed, "\n"))
+		}
+	}
+}
@@ -0,0 +1,756 @@
+// Package tree implements jog.Value with plain Go data structures.
+//
+// Parsed documents from the C backends are read-only. A tree is the value to
+// use when a document has to be built or modified in Go, for instance the
+// result of applying a patch. Trees keep object members in insertion order
+// and numbers as their JSON text, so copying a document into a tree and
+// stringifying it again does not reformat anything.
+package tree
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/anantn/jog"
+	"github.com/anantn/jog/internal/number"
+)
+
+// Value is a JSON value held in Go memory. Like other jog.Values it may be
+// read from many goroutines at once, but Set, Delete and the other mutators
+// need exclusive access.
+type Value struct {
+	kind    jog.Type
+	boolean bool
+	text    string
+	elems   []*Value
+	keys    []string
+	members map[string]*Value
+}
+
+// Constructors.
+
+func Null() *Value {
+	return &Value{kind: jog.TypeNull}
+}
+
+func Bool(b bool) *Value {
+	return &Value{kind: jog.TypeBool, boolean: b}
+}
+
+func String(s string) *Value {
+	return &Value{kind: jog.TypeString, text: s}
+}
+
+func Int(i int64) *Value {
+	return &Value{kind: jog.TypeNumber, text: strconv.FormatInt(i, 10)}
+}
+
+func Uint(i uint64) *Value {
+	return &Value{kind: jog.TypeNumber, text: strconv.FormatUint(i, 10)}
+}
+
+// Float fails for NaN and the infinities, which JSON has no text for.
+func Float(f float64) (*Value, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, fmt.Errorf("Invalid JSON number %v", f)
+	}
+	return &Value{kind: jog.TypeNumber, text: strconv.FormatFloat(f, 'g', -1, 64)}, nil
+}
+
+// Number is built from its JSON text, which is kept verbatim.
+func Number(text string) (*Value, error) {
+	if !json.Valid([]byte(text)) || !isNumber(text) {
+		return nil, fmt.Errorf("Invalid JSON number %q", text)
+	}
+	return &Value{kind: jog.TypeNumber, text: text}, nil
+}
+
+func Array(elems ...*Value) *Value {
+	return &Value{kind: jog.TypeArray, elems: elems}
+}
+
+// Object returns an empty object, use Set to add members.
+func Object() *Value {
+	return &Value{kind: jog.TypeObject, members: map[string]*Value{}}
+}
+
+// Parse JSON text into a tree. Of duplicate keys the first is kept, as the
+// C backends find it.
+func Parse(val string) (*Value, error) {
+	dec := json.NewDecoder(strings.NewReader(val))
+	dec.UseNumber()
+	v, err := parseValue(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("The document root must not be followed by other values.")
+	}
+	return v, nil
+}
+
+// Copy any jog.Value into a new tree, keeping member order and number text.
+// The value is walked rather than serialized, so it copies at any depth.
+func Copy(v jog.Value) (*Value, error) {
+	if t, ok := v.(*Value); ok {
+		return t.Clone(), nil
+	}
+	return copyValue(v)
+}
+
+// Clone returns a deep copy.
+func (v *Value) Clone() *Value {
+	c := *v
+	if v.elems != nil {
+		c.elems = make([]*Value, len(v.elems))
+		for i, elem := range v.elems {
+			c.elems[i] = elem.Clone()
+		}
+	}
+	if v.members != nil {
+		c.keys = make([]string, len(v.keys))
+		copy(c.keys, v.keys)
+		c.members = make(map[string]*Value, len(v.members))
+		for k, member := range v.members {
+			c.members[k] = member.Clone()
+		}
+	}
+	return &c
+}
+
+// Mutators.
+
+// Set adds or replaces an object member. New members go last.
+func (v *Value) Set(key string, val *Value) error {
+	if v.kind != jog.TypeObject {
+		return errors.New("Set called on a non-object value!")
+	}
+	if _, ok := v.members[key]; !ok {
+		v.keys = append(v.keys, key)
+	}
+	v.members[key] = val
+	return nil
+}
+
+// Delete removes an object member, it is an error if it does not exist.
+func (v *Value) Delete(key string) error {
+	if v.kind != jog.TypeObject {
+		return errors.New("Delete called on a non-object value!")
+	}
+	if _, ok := v.members[key]; !ok {
+		return fmt.Errorf("Could not find member %q", key)
+	}
+	delete(v.members, key)
+	for i, k := range v.keys {
+		if k == key {
+			v.keys = append(v.keys[:i], v.keys[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// Keys returns the object member names in order.
+func (v *Value) Keys() []string {
+	return v.keys
+}
+
+// Elem returns the array element at index i, or nil.
+func (v *Value) Elem(i int) *Value {
+	if i < 0 || i >= len(v.elems) {
+		return nil
+	}
+	return v.elems[i]
+}
+
+// Member returns the object member with the given name, or nil.
+func (v *Value) Member(key string) *Value {
+	return v.members[key]
+}
+
+// Insert an array element at index i, 0 <= i <= Len().
+func (v *Value) Insert(i int, val *Value) error {
+	if v.kind != jog.TypeArray {
+		return errors.New("Insert called on a non-array value!")
+	}
+	if i < 0 || i > len(v.elems) {
+		return fmt.Errorf("Index %d out of range", i)
+	}
+	v.elems = append(v.elems, nil)
+	copy(v.elems[i+1:], v.elems[i:])
+	v.elems[i] = val
+	return nil
+}
+
+// Append adds array elements at the end.
+func (v *Value) Append(vals ...*Value) error {
+	if v.kind != jog.TypeArray {
+		return errors.New("Append called on a non-array value!")
+	}
+	v.elems = append(v.elems, vals...)
+	return nil
+}
+
+// Replace the array element at index i.
+func (v *Value) Replace(i int, val *Value) error {
+	if v.kind != jog.TypeArray {
+		return errors.New("Replace called on a non-array value!")
+	}
+	if i < 0 || i >= len(v.elems) {
+		return fmt.Errorf("Index %d out of range", i)
+	}
+	v.elems[i] = val
+	return nil
+}
+
+// Remove the array element at index i.
+func (v *Value) Remove(i int) error {
+	if v.kind != jog.TypeArray {
+		return errors.New("Remove called on a non-array value!")
+	}
+	if i < 0 || i >= len(v.elems) {
+		return fmt.Errorf("Index %d out of range", i)
+	}
+	v.elems = append(v.elems[:i], v.elems[i+1:]...)
+	return nil
+}
+
+// Data Getters.
+
+func (v *Value) get(expected string, path []string) (*Value, error) {
+	n := v
+	for segment, part := range path {
+		if n.kind != jog.TypeObject {
+			return nil, jog.NotFoundError(path, segment, expected, n.kind)
+		}
+		child, ok := n.members[part]
+		if !ok {
+			return nil, jog.NotFoundError(path, segment, expected, jog.TypeObject)
+		}
+		n = child
+	}
+	return n, nil
+}
+
+// The array at path.
+func (v *Value) array(path []string) (*Value, error) {
+	n, err := v.get("array", path)
+	if err != nil {
+		return nil, err
+	}
+	if n.kind != jog.TypeArray {
+		return nil, jog.MismatchError(path, "array", n.kind)
+	}
+	return n, nil
+}
+
+func (v *Value) element(expected string, i int, path []string) (*Value, error) {
+	n, err := v.array(path)
+	if err != nil {
+		return nil, err
+	}
+	if i < 0 || i >= len(n.elems) {
+		return nil, jog.OutOfRangeError(path, i, expected)
+	}
+	return n.elems[i], nil
+}
+
+func (v *Value) Get(path ...string) (jog.Value, error) {
+	n, err := v.get("value", path)
+	if err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+func (v *Value) At(path *jog.Path) (jog.Value, error) {
+	return v.Get(path.Segments()...)
+}
+
+func (v *Value) GetInt(path ...string) (int, error) {
+	n, err := v.get("int", path)
+	if err != nil {
+		return 0, err
+	}
+	if n.kind != jog.TypeNumber {
+		return 0, jog.MismatchError(path, "int", n.kind)
+	}
+	i, err := number.Parse(n.text).Int()
+	if err != nil {
+		return 0, jog.NumberError(err, "int", path)
+	}
+	return i, nil
+}
+
+func (v *Value) GetUInt(path ...string) (uint, error) {
+	n, err := v.get("uint", path)
+	if err != nil {
+		return 0, err
+	}
+	if n.kind != jog.TypeNumber {
+		return 0, jog.MismatchError(path, "uint", n.kind)
+	}
+	u, err := number.Parse(n.text).Uint()
+	if err != nil {
+		return 0, jog.NumberError(err, "uint", path)
+	}
+	return u, nil
+}
+
+func (v *Value) GetFloat(path ...string) (float64, error) {
+	n, err := v.get("float", path)
+	if err != nil {
+		return 0, err
+	}
+	if n.kind != jog.TypeNumber {
+		return 0, jog.MismatchError(path, "float", n.kind)
+	}
+	return number.Parse(n.text).Approx(), nil
+}
+
+func (v *Value) NumberKind(path ...string) (jog.NumberKind, error) {
+	n, err := v.get("number", path)
+	if err != nil {
+		return 0, err
+	}
+	if n.kind != jog.TypeNumber {
+		return 0, jog.MismatchError(path, "number", n.kind)
+	}
+	return jog.NumberKind(number.Parse(n.text).Flags()), nil
+}
+
+func (v *Value) GetBool(path ...string) (bool, error) {
+	n, err := v.get("bool", path)
+	if err != nil {
+		return false, err
+	}
+	if n.kind != jog.TypeBool {
+		return false, jog.MismatchError(path, "bool", n.kind)
+	}
+	return n.boolean, nil
+}
+
+func (v *Value) GetString(path ...string) (string, error) {
+	n, err := v.get("string", path)
+	if err != nil {
+		return "", err
+	}
+	if n.kind != jog.TypeString {
+		return "", jog.MismatchError(path, "string", n.kind)
+	}
+	return n.text, nil
+}
+
+func (v *Value) GetArray(path ...string) ([]jog.Value, error) {
+	n, err := v.get("array", path)
+	if err != nil {
+		return nil, err
+	}
+	if n.kind != jog.TypeArray {
+		return nil, jog.MismatchError(path, "array", n.kind)
+	}
+	arr := make([]jog.Value, len(n.elems))
+	for i, elem := range n.elems {
+		arr[i] = elem
+	}
+	return arr, nil
+}
+
+func (v *Value) GetObject(path ...string) (map[string]jog.Value, error) {
+	n, err := v.get("object", path)
+	if err != nil {
+		return nil, err
+	}
+	if n.kind != jog.TypeObject {
+		return nil, jog.MismatchError(path, "object", n.kind)
+	}
+	bag := make(map[string]jog.Value, len(n.members))
+	for k, member := range n.members {
+		bag[k] = member
+	}
+	return bag, nil
+}
+
+func (v *Value) Len(path ...string) (int, error) {
+	n, err := v.get("array or object", path)
+	if err != nil {
+		return 0, err
+	}
+	switch n.kind {
+	case jog.TypeArray:
+		return len(n.elems), nil
+	case jog.TypeObject:
+		return len(n.keys), nil
+	}
+	return 0, jog.MismatchError(path, "array or object", n.kind)
+}
+
+func (v *Value) Index(i int, path ...string) (jog.Value, error) {
+	e, err := v.element("value", i, path)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (v *Value) IndexInt(i int, path ...string) (int, error) {
+	e, err := v.element("int", i, path)
+	if err != nil {
+		return 0, err
+	}
+	r, err := e.GetInt()
+	return r, jog.ElementError(err, path, i)
+}
+
+func (v *Value) IndexUInt(i int, path ...string) (uint, error) {
+	e, err := v.element("uint", i, path)
+	if err != nil {
+		return 0, err
+	}
+	r, err := e.GetUInt()
+	return r, jog.ElementError(err, path, i)
+}
+
+func (v *Value) IndexFloat(i int, path ...string) (float64, error) {
+	e, err := v.element("float", i, path)
+	if err != nil {
+		return 0, err
+	}
+	r, err := e.GetFloat()
+	return r, jog.ElementError(err, path, i)
+}
+
+func (v *Value) IndexBool(i int, path ...string) (bool, error) {
+	e, err := v.element("bool", i, path)
+	if err != nil {
+		return false, err
+	}
+	r, err := e.GetBool()
+	return r, jog.ElementError(err, path, i)
+}
+
+func (v *Value) IndexString(i int, path ...string) (string, error) {
+	e, err := v.element("string", i, path)
+	if err != nil {
+		return "", err
+	}
+	r, err := e.GetString()
+	return r, jog.ElementError(err, path, i)
+}
+
+func (v *Value) Elements(path ...string) iter.Seq2[int, jog.Value] {
+	return jog.Elements(v, path...)
+}
+
+func (v *Value) ArrayIterator(path ...string) (jog.ArrayIterator, error) {
+	n, err := v.array(path)
+	if err != nil {
+		return nil, err
+	}
+	return &arrayIterator{elems: n.elems, index: -1}, nil
+}
+
+func (v *Value) ObjectIterator(path ...string) (jog.ObjectIterator, error) {
+	n, err := v.get("object", path)
+	if err != nil {
+		return nil, err
+	}
+	if n.kind != jog.TypeObject {
+		return nil, jog.MismatchError(path, "object", n.kind)
+	}
+	return &objectIterator{keys: n.keys, members: n.members, index: -1}, nil
+}
+
+func (v *Value) Type(path ...string) jog.Type {
+	n, err := v.get("value", path)
+	if err != nil {
+		return jog.TypeMissing
+	}
+	return n.kind
+}
+
+func (v *Value) Exists(path ...string) bool {
+	return v.Type(path...) != jog.TypeMissing
+}
+
+func (v *Value) IsNull(path ...string) bool {
+	return v.Type(path...) == jog.TypeNull
+}
+
+func (v *Value) Stringify(path ...string) (string, error) {
+	n, err := v.get("value", path)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	n.write(&buf)
+	return buf.String(), nil
+}
+
+// A tree is kept in Go memory, so it holds no native memory.
+func (v *Value) MemoryUsage() int {
+	return 0
+}
+
+// Private methods.
+
+// The iterators return the elements and members themselves, which stay
+// valid after the next step.
+type arrayIterator struct {
+	elems []*Value
+	index int
+}
+
+func (it *arrayIterator) Next() bool {
+	if it.index+1 >= len(it.elems) {
+		it.index = len(it.elems)
+		return false
+	}
+	it.index++
+	return true
+}
+
+func (it *arrayIterator) Index() int {
+	return it.index
+}
+
+func (it *arrayIterator) Value() jog.Value {
+	if it.index < 0 || it.index >= len(it.elems) {
+		return nil
+	}
+	return it.elems[it.index]
+}
+
+type objectIterator struct {
+	keys    []string
+	members map[string]*Value
+	index   int
+}
+
+func (it *objectIterator) Next() bool {
+	if it.index+1 >= len(it.keys) {
+		it.index = len(it.keys)
+		return false
+	}
+	it.index++
+	return true
+}
+
+func (it *objectIterator) Key() string {
+	if it.index < 0 || it.index >= len(it.keys) {
+		return ""
+	}
+	return it.keys[it.index]
+}
+
+func (it *objectIterator) Value() jog.Value {
+	if it.index < 0 || it.index >= len(it.keys) {
+		return nil
+	}
+	return it.members[it.keys[it.index]]
+}
+
+func (v *Value) write(buf *bytes.Buffer) {
+	switch v.kind {
+	case jog.TypeNull:
+		buf.WriteString("null")
+	case jog.TypeBool:
+		buf.WriteString(strconv.FormatBool(v.boolean))
+	case jog.TypeNumber:
+		buf.WriteString(v.text)
+	case jog.TypeString:
+		writeString(buf, v.text)
+	case jog.TypeArray:
+		buf.WriteByte('[')
+		for i, elem := range v.elems {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			elem.write(buf)
+		}
+		buf.WriteByte(']')
+	case jog.TypeObject:
+		buf.WriteByte('{')
+		for i, k := range v.keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeString(buf, k)
+			buf.WriteByte(':')
+			v.members[k].write(buf)
+		}
+		buf.WriteByte('}')
+	}
+}
+
+// Strings are escaped like the backends' writers do: quotes, backslashes
+// and control characters only.
+func writeString(buf *bytes.Buffer, s string) {
+	const hex = "0123456789ABCDEF"
+	buf.WriteByte('"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c >= utf8.RuneSelf {
+			r, size := utf8.DecodeRuneInString(s[i:])
+			buf.WriteRune(r)
+			i += size
+			continue
+		}
+		switch c {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if c < 0x20 {
+				buf.WriteString(`\u00`)
+				buf.WriteByte(hex[c>>4])
+				buf.WriteByte(hex[c&0xF])
+			} else {
+				buf.WriteByte(c)
+			}
+		}
+		i++
+	}
+	buf.WriteByte('"')
+}
+
+func parseValue(dec *json.Decoder) (*Value, error) {
+	tok, err := dec.Token()
+	if err == io.EOF {
+		return nil, errors.New("The document is empty.")
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case nil:
+		return Null(), nil
+	case bool:
+		return Bool(t), nil
+	case json.Number:
+		return &Value{kind: jog.TypeNumber, text: string(t)}, nil
+	case string:
+		return String(t), nil
+	case json.Delim:
+		if t == '[' {
+			arr := Array()
+			for dec.More() {
+				elem, err := parseValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				arr.elems = append(arr.elems, elem)
+			}
+			_, err = dec.Token()
+			return arr, err
+		}
+		obj := Object()
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			member, err := parseValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj.addMember(key.(string), member)
+		}
+		_, err = dec.Token()
+		return obj, err
+	}
+	return nil, fmt.Errorf("Unexpected token %v", tok)
+}
+
+// Walk a value of any backend with its iterators, which keep member order
+// and duplicate keys like the document does.
+func copyValue(v jog.Value) (*Value, error) {
+	switch t := v.Type(); t {
+	case jog.TypeNull:
+		return Null(), nil
+	case jog.TypeBool:
+		b, err := v.GetBool()
+		if err != nil {
+			return nil, err
+		}
+		return Bool(b), nil
+	case jog.TypeNumber:
+		text, err := v.Stringify()
+		if err != nil {
+			return nil, err
+		}
+		return &Value{kind: jog.TypeNumber, text: text}, nil
+	case jog.TypeString:
+		s, err := v.GetString()
+		if err != nil {
+			return nil, err
+		}
+		return String(s), nil
+	case jog.TypeArray:
+		it, err := v.ArrayIterator()
+		if err != nil {
+			return nil, err
+		}
+		arr := Array()
+		for it.Next() {
+			elem, err := copyValue(it.Value())
+			if err != nil {
+				return nil, err
+			}
+			arr.elems = append(arr.elems, elem)
+		}
+		return arr, nil
+	case jog.TypeObject:
+		it, err := v.ObjectIterator()
+		if err != nil {
+			return nil, err
+		}
+		obj := Object()
+		for it.Next() {
+			member, err := copyValue(it.Value())
+			if err != nil {
+				return nil, err
+			}
+			obj.addMember(it.Key(), member)
+		}
+		return obj, nil
+	default:
+		return nil, fmt.Errorf("Could not copy a value of type %s", t)
+	}
+}
+
+// Add a member read from a document. rapid and yajl find the first of
+// duplicate keys, so the later ones are dropped.
+func (v *Value) addMember(key string, member *Value) {
+	if _, ok := v.members[key]; !ok {
+		v.keys = append(v.keys, key)
+		v.members[key] = member
+	}
+}
+
+func isNumber(text string) bool {
+	if text == "" {
+		return false
+	}
+	c := text[0]
+	return c == '-' || (c >= '0' && c <= '9')
+}
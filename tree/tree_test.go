@@ -0,0 +1,99 @@
+package tree
+
+import (
+	"math"
+	"testing"
+
+	"github.com/anantn/jog"
+	"github.com/anantn/jog/rapid"
+	"github.com/anantn/jog/yajl"
+)
+
+var SAMPLE = `{"index":0,"name":"jog","tags":["a","b"],"details":{"age":36,"ratio":-0.5,"big":12345678901234567890,"ok":true,"none":null},"esc":"a\"b\\c\n\u0001"}`
+
+func TestRoundTrip(t *testing.T) {
+	v, err := Parse(SAMPLE)
+	if err != nil {
+		t.Fatalf("Couldn't parse sample: %v\n", err)
+	}
+	got, _ := v.Stringify()
+	if got != SAMPLE {
+		t.Fatalf("Expected %s, got %s\n", SAMPLE, got)
+	}
+	if v.Type("details", "none") != jog.TypeNull {
+		t.Fatalf("Expected details/none to be null\n")
+	}
+	if age, _ := v.GetInt("details", "age"); age != 36 {
+		t.Fatalf("Expected details/age to be 36, got %d\n", age)
+	}
+	if _, err := v.GetInt("details", "ratio"); err == nil {
+		t.Fatalf("Expected GetInt to fail on a fraction\n")
+	}
+	if s, _ := v.GetString("esc"); s != "a\"b\\c\n\x01" {
+		t.Fatalf("Unexpected string %q\n", s)
+	}
+}
+
+func TestCopy(t *testing.T) {
+	for _, parse := range []func(string) (jog.Value, error){rapid.New, yajl.New} {
+		src, err := parse(`{"b":1,"a":[true,null,"x"]}`)
+		if err != nil {
+			t.Fatalf("Couldn't parse: %v\n", err)
+		}
+		v, err := Copy(src)
+		if err != nil {
+			t.Fatalf("Couldn't copy: %v\n", err)
+		}
+		if keys := v.Keys(); len(keys) != 2 || keys[0] != "b" || keys[1] != "a" {
+			t.Fatalf("Expected member order to be kept, got %v\n", keys)
+		}
+	}
+}
+
+func TestDuplicateKeys(t *testing.T) {
+	doc := `{"a":1,"b":2,"a":3}`
+	parsers := map[string]func(string) (jog.Value, error){"tree": func(s string) (jog.Value, error) { return Parse(s) }, "rapid": rapid.New, "yajl": yajl.New}
+	for name, parse := range parsers {
+		src, _ := parse(doc)
+		if a, err := src.GetInt("a"); err != nil || a != 1 {
+			t.Fatalf("[%s] Expected the first a, got %d (%v)\n", name, a, err)
+		}
+		v, err := Copy(src)
+		if err != nil {
+			t.Fatalf("[%s] Couldn't copy: %v\n", name, err)
+		}
+		if a, _ := v.GetInt("a"); a != 1 {
+			t.Fatalf("[%s] Expected the copy to keep the first a, got %d\n", name, a)
+		}
+		if s, _ := v.Stringify(); s != `{"a":1,"b":2}` {
+			t.Fatalf("[%s] Expected the later a to be dropped, got %s\n", name, s)
+		}
+	}
+}
+
+func TestMutate(t *testing.T) {
+	obj := Object()
+	obj.Set("list", Array(Int(1), Int(3)))
+	obj.Set("name", String("jog"))
+	half, _ := Float(2.5)
+	obj.Member("list").Insert(1, half)
+	obj.Member("list").Append(Null())
+	obj.Set("name", Bool(false))
+	if err := obj.Delete("missing"); err == nil {
+		t.Fatalf("Expected deleting a missing member to fail\n")
+	}
+	got, _ := obj.Stringify()
+	if got != `{"list":[1,2.5,3,null],"name":false}` {
+		t.Fatalf("Unexpected result %s\n", got)
+	}
+	for _, f := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		if v, err := Float(f); err == nil {
+			t.Fatalf("Expected %v not to be a JSON number, got %v\n", f, v)
+		}
+	}
+	clone := obj.Clone()
+	clone.Member("list").Remove(0)
+	if n, _ := obj.Member("list").Len(); n != 4 {
+		t.Fatalf("Clone shares storage with the original\n")
+	}
+}
@@ -121,6 +121,39 @@ struct yajl_val_s
 YAJL_API yajl_val yajl_tree_parse (const char *input,
                                    char *error_buffer, size_t error_buffer_size);
 
+/** Parse events passed to a yajl_tree_hook. */
+typedef enum {
+    yajl_tree_event_null,
+    yajl_tree_event_boolean,
+    yajl_tree_event_number,
+    yajl_tree_event_string,
+    yajl_tree_event_map_key,
+    yajl_tree_event_start_map,
+    yajl_tree_event_end_map,
+    yajl_tree_event_start_array,
+    yajl_tree_event_end_array
+} yajl_tree_event;
+
+/**
+ * Called before every parse event with the length of the number, string or
+ * map key, and 0 otherwise. Returning zero cancels the parse.
+ */
+typedef int (*yajl_tree_hook)(void *ctx, yajl_tree_event event, size_t length);
+
+/**
+ * Parse \em input_length bytes of JSON data like \em yajl_tree_parse, calling
+ * \em hook with \em hook_ctx before every event unless it is \c NULL. The
+ * parser and the tree are allocated with \em alloc_funcs, or the default
+ * functions if it is \c NULL; free the tree with \em yajl_tree_free_alloc
+ * and the same functions. If \em bytes_consumed is not \c NULL, it receives
+ * the offset where a failed parse stopped.
+ */
+YAJL_API yajl_val yajl_tree_parse_hook (const char *input, size_t input_length,
+                                        char *error_buffer, size_t error_buffer_size,
+                                        yajl_tree_hook hook, void *hook_ctx,
+                                        yajl_alloc_funcs *alloc_funcs,
+                                        size_t *bytes_consumed);
+
 
 /**
  * Free a parse tree returned by "yajl_tree_parse".
@@ -130,6 +163,13 @@ YAJL_API yajl_val yajl_tree_parse (const char *input,
  */
 YAJL_API void yajl_tree_free (yajl_val v);
 
+/**
+ * Free a parse tree allocated with \em alloc_funcs by
+ * "yajl_tree_parse_hook". \c NULL functions free a tree allocated with the
+ * default functions.
+ */
+YAJL_API void yajl_tree_free_alloc (yajl_val v, yajl_alloc_funcs *alloc_funcs);
+
 /**
  * Access a nested value inside a tree.
  *
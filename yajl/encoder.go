@@ -0,0 +1,379 @@
+package yajl
+
+// #include <stdint.h>
+// #include <string.h>
+// #include "jog.h"
+import "C"
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"runtime"
+	"runtime/cgo"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+	"unsafe"
+
+	"github.com/anantn/jog"
+)
+
+// MaxDepth is the deepest nesting of arrays and objects that yajl's
+// generator writes, one less than YAJL_MAX_DEPTH. A deeper document parses,
+// but Stringify and the Encoder fail on it with ErrMaxDepth.
+const MaxDepth = 127
+
+// ErrMaxDepth is returned when a value nests deeper than MaxDepth.
+var ErrMaxDepth = errors.New("Could not encode, maximum depth exceeded!")
+
+// The print callback writes into a sink rather than the encoder itself, so
+// the cgo handle does not keep the encoder reachable and its finalizer can
+// still run.
+type sink struct {
+	w     *bufio.Writer
+	err   error
+	ascii bool
+	html  bool
+}
+
+type yajlEncoder struct {
+	gen      C.yajl_gen
+	handle   cgo.Handle
+	out      *sink
+	state    jog.EncoderState
+	validate bool
+}
+
+// NewEncoder returns an Encoder writing compact JSON to w through a yajl
+// generator.
+func NewEncoder(w io.Writer) jog.Encoder {
+	return NewEncoderWithOptions(w, jog.WriterOptions{})
+}
+
+// NewEncoderWithOptions returns an Encoder that escapes strings as opts
+// asks. yajl escapes the solidus itself, the ASCII and HTML escapes are
+// applied as its output is printed.
+func NewEncoderWithOptions(w io.Writer, opts jog.WriterOptions) jog.Encoder {
+	out := &sink{w: bufio.NewWriter(w), ascii: opts.ASCII, html: opts.HTMLSafe}
+	e := &yajlEncoder{handle: cgo.NewHandle(out), out: out}
+	e.validate = opts.ASCII || opts.ValidateUTF8
+	e.gen = C.jog_gen_alloc(C.uintptr_t(e.handle), cbool(opts.EscapeSolidus), cbool(e.validate))
+	if e.gen == nil {
+		e.handle.Delete()
+		out.err = errors.New("Could not allocate generator!")
+		return e
+	}
+	runtime.SetFinalizer(e, cleanupEncoder)
+	return e
+}
+
+// StringifyWithOptions serializes a value like Stringify, escaping strings
+// as opts asks.
+func StringifyWithOptions(v jog.Value, opts jog.WriterOptions) (string, error) {
+	var buf bytes.Buffer
+	e := NewEncoderWithOptions(&buf, opts)
+	if err := e.Value(v); err != nil {
+		e.Close()
+		return "", err
+	}
+	if err := e.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Non-ASCII bytes and <, > and & only occur inside strings, and yajl prints
+// each run of unescaped string bytes whole, so they can be escaped here
+// without splitting a character.
+//
+//export yajlPrint
+func yajlPrint(handle C.uintptr_t, str *C.char, length C.size_t) {
+	out := cgo.Handle(handle).Value().(*sink)
+	if out.err != nil {
+		return
+	}
+	data := unsafe.Slice((*byte)(unsafe.Pointer(str)), int(length))
+	if !out.ascii && !out.html {
+		_, out.err = out.w.Write(data)
+		return
+	}
+	const hex = "0123456789ABCDEF"
+	start := 0
+	for i := 0; i < len(data); {
+		c := data[i]
+		var esc string
+		size := 1
+		switch {
+		case out.html && c == '<':
+			esc = `\u003c`
+		case out.html && c == '>':
+			esc = `\u003e`
+		case out.html && c == '&':
+			esc = `\u0026`
+		case out.ascii && c >= utf8.RuneSelf:
+			var r rune
+			r, size = utf8.DecodeRune(data[i:])
+			var buf []byte
+			for _, u := range utf16.Encode([]rune{r}) {
+				buf = append(buf, '\\', 'u', hex[u>>12], hex[u>>8&0xF], hex[u>>4&0xF], hex[u&0xF])
+			}
+			esc = string(buf)
+		default:
+			i++
+			continue
+		}
+		out.w.Write(data[start:i])
+		out.w.WriteString(esc)
+		i += size
+		start = i
+	}
+	_, out.err = out.w.Write(data[start:])
+}
+
+func (e *yajlEncoder) BeginObject() error {
+	if err := e.check(e.state.Begin(jog.TypeObject)); err != nil {
+		return err
+	}
+	return e.status(C.yajl_gen_map_open(e.gen))
+}
+
+func (e *yajlEncoder) EndObject() error {
+	if err := e.check(e.state.End(jog.TypeObject)); err != nil {
+		return err
+	}
+	return e.status(C.yajl_gen_map_close(e.gen))
+}
+
+func (e *yajlEncoder) BeginArray() error {
+	if err := e.check(e.state.Begin(jog.TypeArray)); err != nil {
+		return err
+	}
+	return e.status(C.yajl_gen_array_open(e.gen))
+}
+
+func (e *yajlEncoder) EndArray() error {
+	if err := e.check(e.state.End(jog.TypeArray)); err != nil {
+		return err
+	}
+	return e.status(C.yajl_gen_array_close(e.gen))
+}
+
+func (e *yajlEncoder) Key(k string) error {
+	if err := e.checkString(k); err != nil {
+		return err
+	}
+	if err := e.check(e.state.Key()); err != nil {
+		return err
+	}
+	return e.string(k)
+}
+
+func (e *yajlEncoder) Null() error {
+	if err := e.check(e.state.Value(jog.TypeNull)); err != nil {
+		return err
+	}
+	return e.status(C.yajl_gen_null(e.gen))
+}
+
+func (e *yajlEncoder) Bool(b bool) error {
+	if err := e.check(e.state.Value(jog.TypeBool)); err != nil {
+		return err
+	}
+	val := C.int(0)
+	if b {
+		val = 1
+	}
+	return e.status(C.yajl_gen_bool(e.gen, val))
+}
+
+func (e *yajlEncoder) Int64(i int64) error {
+	if err := e.check(e.state.Value(jog.TypeNumber)); err != nil {
+		return err
+	}
+	return e.status(C.yajl_gen_integer(e.gen, C.longlong(i)))
+}
+
+// yajl has no unsigned integers, the digits are written verbatim.
+func (e *yajlEncoder) Uint64(u uint64) error {
+	if err := e.check(e.state.Value(jog.TypeNumber)); err != nil {
+		return err
+	}
+	return e.number(strconv.FormatUint(u, 10))
+}
+
+// yajl_gen_double prints 20 significant digits, so the shortest form that
+// round-trips is formatted here instead.
+func (e *yajlEncoder) Float64(f float64) error {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return fmt.Errorf("Could not encode %v, JSON has no such number", f)
+	}
+	if err := e.check(e.state.Value(jog.TypeNumber)); err != nil {
+		return err
+	}
+	return e.number(strconv.FormatFloat(f, 'g', -1, 64))
+}
+
+func (e *yajlEncoder) String(s string) error {
+	if err := e.checkString(s); err != nil {
+		return err
+	}
+	if err := e.check(e.state.Value(jog.TypeString)); err != nil {
+		return err
+	}
+	return e.string(s)
+}
+
+func (e *yajlEncoder) Value(v jog.Value) error {
+	native, ok := v.(*yajlValue)
+	if !ok {
+		return jog.EncodeValue(e, v)
+	}
+	defer runtime.KeepAlive(native)
+	return e.node(native.ptr)
+}
+
+func (e *yajlEncoder) Flush() error {
+	if e.out.err != nil {
+		return e.out.err
+	}
+	e.out.err = e.out.w.Flush()
+	return e.out.err
+}
+
+func (e *yajlEncoder) Close() error {
+	if e.gen == nil {
+		return e.out.err
+	}
+	err := e.Flush()
+	cleanupEncoder(e)
+	runtime.SetFinalizer(e, nil)
+	if err == nil && !e.state.Complete() {
+		err = errors.New("Could not close encoder, the document is incomplete!")
+	}
+	return err
+}
+
+// Private methods.
+
+// Finalizer to call yajl_gen_free and release the sink.
+func cleanupEncoder(e *yajlEncoder) {
+	C.yajl_gen_free(e.gen)
+	e.gen = nil
+	e.handle.Delete()
+}
+
+// Reject the token if the structure is invalid or a write already failed.
+func (e *yajlEncoder) check(err error) error {
+	if e.gen == nil && e.out.err == nil {
+		return errors.New("Could not write to a closed encoder!")
+	}
+	if e.out.err != nil {
+		return e.out.err
+	}
+	return err
+}
+
+// Walk a tree in document order.
+func (e *yajlEncoder) node(n *C.struct_yajl_val_s) error {
+	switch int(n._type) {
+	case yajl_t_string:
+		return e.String(treeString(*(**C.char)(unsafe.Pointer(&n.u))))
+	case yajl_t_number:
+		if err := e.check(e.state.Value(jog.TypeNumber)); err != nil {
+			return err
+		}
+		num := unionToNumber(&n.u)
+		return e.status(C.yajl_gen_number(e.gen, num.r, C.strlen(num.r)))
+	case yajl_t_object:
+		obj := unionToObject(&n.u)
+		if err := e.BeginObject(); err != nil {
+			return err
+		}
+		for i := 0; i < int(obj.len); i++ {
+			keyPtr := (**C.char)(unsafe.Pointer(uintptr(unsafe.Pointer(obj.keys)) + uintptr(i)*ptrSize))
+			if err := e.Key(treeString(*keyPtr)); err != nil {
+				return err
+			}
+			valPtr := (**C.struct_yajl_val_s)(unsafe.Pointer(uintptr(unsafe.Pointer(obj.values)) + uintptr(i)*ptrSize))
+			if err := e.node(*valPtr); err != nil {
+				return err
+			}
+		}
+		return e.EndObject()
+	case yajl_t_array:
+		arr := unionToArray(&n.u)
+		if err := e.BeginArray(); err != nil {
+			return err
+		}
+		for i := 0; i < int(arr.len); i++ {
+			valPtr := (**C.struct_yajl_val_s)(unsafe.Pointer(uintptr(unsafe.Pointer(arr.values)) + uintptr(i)*ptrSize))
+			if err := e.node(*valPtr); err != nil {
+				return err
+			}
+		}
+		return e.EndArray()
+	case yajl_t_true:
+		return e.Bool(true)
+	case yajl_t_false:
+		return e.Bool(false)
+	case yajl_t_null:
+		return e.Null()
+	}
+	return fmt.Errorf("Could not encode unknown value type! %d", int(n._type))
+}
+
+// yajl_gen_validate_utf8 accepts surrogates, overlong forms and code points
+// beyond U+10FFFF, so strings are checked here as well.
+func (e *yajlEncoder) checkString(s string) error {
+	if e.validate && !utf8.ValidString(s) {
+		return fmt.Errorf("Could not encode invalid UTF-8 string %q!", s)
+	}
+	return nil
+}
+
+func (e *yajlEncoder) string(s string) error {
+	str := (*C.uchar)(unsafe.Pointer(unsafe.StringData(s)))
+	return e.status(C.yajl_gen_string(e.gen, str, C.size_t(len(s))))
+}
+
+func (e *yajlEncoder) number(s string) error {
+	str := (*C.char)(unsafe.Pointer(unsafe.StringData(s)))
+	return e.status(C.yajl_gen_number(e.gen, str, C.size_t(len(s))))
+}
+
+// A generator error leaves the output broken, so it sticks like a write
+// error and fails every later token.
+func (e *yajlEncoder) status(s C.yajl_gen_status) error {
+	if e.out.err != nil {
+		return e.out.err
+	}
+	switch s {
+	case C.yajl_gen_status_ok:
+		return nil
+	case C.yajl_max_depth_exceeded:
+		e.out.err = ErrMaxDepth
+	case C.yajl_gen_invalid_string:
+		e.out.err = errors.New("Could not encode invalid UTF-8 string!")
+	default:
+		e.out.err = fmt.Errorf("Could not encode token! (status %d)", int(s))
+	}
+	return e.out.err
+}
+
+// Utility functions.
+
+func cbool(b bool) C.int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// A view of a NUL-terminated string in the tree, without copying it.
+func treeString(str *C.char) string {
+	return unsafe.String((*byte)(unsafe.Pointer(str)), int(C.strlen(str)))
+}
@@ -0,0 +1,482 @@
+#include <stdlib.h>
+#include <string.h>
+
+#include "api/yajl_parse.h"
+#include "jog.h"
+
+// Every counted allocation is preceded by its size, so frees can be counted.
+#define HEADER_SIZE 16
+
+static jog_memory_stats stats;
+
+static void count_alloc(jog_mem_account* account, int64_t size, int64_t mallocs, int64_t frees) {
+	__atomic_add_fetch(&stats.in_use, size, __ATOMIC_RELAXED);
+	if (size > 0) {
+		__atomic_add_fetch(&stats.total_alloc, size, __ATOMIC_RELAXED);
+	}
+	__atomic_add_fetch(&stats.mallocs, mallocs, __ATOMIC_RELAXED);
+	__atomic_add_fetch(&stats.frees, frees, __ATOMIC_RELAXED);
+	if (account != NULL) {
+		account->allocated += size;
+	}
+}
+
+static void* counted_malloc(void* ctx, size_t size) {
+	char* block = malloc(HEADER_SIZE + size);
+	if (block == NULL) {
+		return NULL;
+	}
+	*(size_t*) block = size;
+	count_alloc((jog_mem_account*) ctx, size, 1, 0);
+	return block + HEADER_SIZE;
+}
+
+static void* counted_realloc(void* ctx, void* ptr, size_t size) {
+	char* block;
+	size_t old;
+	if (ptr == NULL) {
+		return counted_malloc(ctx, size);
+	}
+	block = (char*) ptr - HEADER_SIZE;
+	old = *(size_t*) block;
+	block = realloc(block, HEADER_SIZE + size);
+	if (block == NULL) {
+		return NULL;
+	}
+	*(size_t*) block = size;
+	count_alloc((jog_mem_account*) ctx, (int64_t) size - (int64_t) old, 0, 0);
+	return block + HEADER_SIZE;
+}
+
+static void counted_free(void* ctx, void* ptr) {
+	char* block;
+	if (ptr == NULL) {
+		return;
+	}
+	block = (char*) ptr - HEADER_SIZE;
+	count_alloc((jog_mem_account*) ctx, -(int64_t) *(size_t*) block, 0, 1);
+	free(block);
+}
+
+yajl_alloc_funcs jog_counted_funcs = { counted_malloc, counted_realloc, counted_free, NULL };
+
+static yajl_alloc_funcs account_funcs(jog_mem_account* account) {
+	yajl_alloc_funcs funcs = jog_counted_funcs;
+	funcs.ctx = account;
+	return funcs;
+}
+
+void jog_get_memory_stats(jog_memory_stats* out) {
+	out->in_use = __atomic_load_n(&stats.in_use, __ATOMIC_RELAXED);
+	out->total_alloc = __atomic_load_n(&stats.total_alloc, __ATOMIC_RELAXED);
+	out->mallocs = __atomic_load_n(&stats.mallocs, __ATOMIC_RELAXED);
+	out->frees = __atomic_load_n(&stats.frees, __ATOMIC_RELAXED);
+}
+
+// Implemented in encoder.go.
+extern void yajlPrint(uintptr_t handle, char* str, size_t len);
+
+static void print_to_sink(void* ctx, const char* str, size_t len) {
+	yajlPrint((uintptr_t) ctx, (char*) str, len);
+}
+
+yajl_gen jog_gen_alloc(uintptr_t handle, int escape_solidus, int validate_utf8) {
+	yajl_gen g = yajl_gen_alloc(&jog_counted_funcs);
+	if (g == NULL) {
+		return NULL;
+	}
+	if (!yajl_gen_config(g, yajl_gen_print_callback, print_to_sink, (void*) handle) ||
+		!yajl_gen_config(g, yajl_gen_escape_solidus, escape_solidus) ||
+		!yajl_gen_config(g, yajl_gen_validate_utf8, validate_utf8)) {
+		yajl_gen_free(g);
+		return NULL;
+	}
+	return g;
+}
+
+// Limits that can stop a parse, matching jog.Limit.
+enum {
+	limit_depth = 2,
+	limit_string_length = 3,
+	limit_members = 4,
+	limit_memory = 5
+};
+
+typedef struct parse_level {
+	size_t members;
+	int object;
+} parse_level;
+
+// The open arrays and objects of a running parse.
+typedef struct parse_state {
+	jog_parse_control* control;
+	jog_mem_account* account;
+	parse_level* levels;
+	size_t depth;
+	size_t capacity;
+} parse_state;
+
+static int exceed(jog_parse_control* control, int limit) {
+	control->exceeded = limit;
+	return 0;
+}
+
+// Values are counted as members of an enclosing array; object members are
+// counted by their key.
+static int count_member(parse_state* state, int object) {
+	parse_level* level;
+	if (state->depth == 0) {
+		return 1;
+	}
+	level = &state->levels[state->depth - 1];
+	if (level->object != object) {
+		return 1;
+	}
+	level->members++;
+	if (state->control->max_members && level->members > state->control->max_members) {
+		return exceed(state->control, limit_members);
+	}
+	return 1;
+}
+
+static int check_length(jog_parse_control* control, size_t length) {
+	if (control->max_string_length && length > control->max_string_length) {
+		return exceed(control, limit_string_length);
+	}
+	return 1;
+}
+
+static int push_level(parse_state* state, int object) {
+	parse_level* levels;
+	if (state->control->max_depth && state->depth >= state->control->max_depth) {
+		return exceed(state->control, limit_depth);
+	}
+	if (state->depth == state->capacity) {
+		state->capacity = state->capacity ? state->capacity * 2 : 16;
+		levels = realloc(state->levels, state->capacity * sizeof(parse_level));
+		if (levels == NULL) {
+			return 0;
+		}
+		state->levels = levels;
+	}
+	state->levels[state->depth].members = 0;
+	state->levels[state->depth].object = object;
+	state->depth++;
+	return 1;
+}
+
+static int within_budget(jog_parse_control* control, jog_mem_account* account) {
+	return !control->max_memory || account->allocated <= (int64_t) control->max_memory;
+}
+
+static int check_control(void* ctx, yajl_tree_event event, size_t length) {
+	parse_state* state = (parse_state*) ctx;
+	if (__atomic_load_n(&state->control->canceled, __ATOMIC_RELAXED)) {
+		return 0;
+	}
+	if (!within_budget(state->control, state->account)) {
+		return exceed(state->control, limit_memory);
+	}
+	switch (event) {
+	case yajl_tree_event_map_key:
+		return count_member(state, 1) && check_length(state->control, length);
+	case yajl_tree_event_string:
+		return count_member(state, 0) && check_length(state->control, length);
+	case yajl_tree_event_start_map:
+		return count_member(state, 0) && push_level(state, 1);
+	case yajl_tree_event_start_array:
+		return count_member(state, 0) && push_level(state, 0);
+	case yajl_tree_event_end_map:
+	case yajl_tree_event_end_array:
+		state->depth--;
+		return 1;
+	default:
+		return count_member(state, 0);
+	}
+}
+
+// Validation callbacks, which only check the control.
+static int validate(void* ctx, yajl_tree_event event, size_t length) {
+	parse_state* state = (parse_state*) ctx;
+	return state->control == NULL || check_control(ctx, event, length);
+}
+
+static int validate_null(void* ctx) {
+	return validate(ctx, yajl_tree_event_null, 0);
+}
+
+static int validate_boolean(void* ctx, int boolean) {
+	return validate(ctx, yajl_tree_event_boolean, 0);
+}
+
+static int validate_number(void* ctx, const char* number, size_t length) {
+	return validate(ctx, yajl_tree_event_number, length);
+}
+
+static int validate_string(void* ctx, const unsigned char* string, size_t length) {
+	return validate(ctx, yajl_tree_event_string, length);
+}
+
+static int validate_map_key(void* ctx, const unsigned char* key, size_t length) {
+	return validate(ctx, yajl_tree_event_map_key, length);
+}
+
+static int validate_start_map(void* ctx) {
+	return validate(ctx, yajl_tree_event_start_map, 0);
+}
+
+static int validate_end_map(void* ctx) {
+	return validate(ctx, yajl_tree_event_end_map, 0);
+}
+
+static int validate_start_array(void* ctx) {
+	return validate(ctx, yajl_tree_event_start_array, 0);
+}
+
+static int validate_end_array(void* ctx) {
+	return validate(ctx, yajl_tree_event_end_array, 0);
+}
+
+void jog_cancel_parse(jog_parse_control* control) {
+	__atomic_store_n(&control->canceled, 1, __ATOMIC_RELAXED);
+}
+
+// Arena memory is handed out in chunks that are kept until the arena is
+// freed. Every allocation is preceded by its size so that it can be grown.
+#define ARENA_ALIGN 16
+#define ARENA_CHUNK (64 * 1024)
+
+typedef struct arena_chunk {
+	struct arena_chunk* next;
+	size_t capacity;
+	size_t used;
+} arena_chunk;
+
+struct jog_arena {
+	arena_chunk* chunks;
+	arena_chunk* current;
+	yajl_alloc_funcs funcs;
+	// Charged with the memory handed out for the current tree.
+	jog_mem_account* account;
+};
+
+static size_t align_up(size_t size) {
+	return (size + ARENA_ALIGN - 1) & ~(size_t) (ARENA_ALIGN - 1);
+}
+
+static char* chunk_data(arena_chunk* chunk) {
+	return (char*) chunk + align_up(sizeof(arena_chunk));
+}
+
+static size_t* header_of(void* ptr) {
+	return (size_t*) ((char*) ptr - ARENA_ALIGN);
+}
+
+// Find room for need bytes in the current chunk or one after it, adding a
+// chunk to the end of the list if none of the kept ones are large enough.
+static arena_chunk* arena_chunk_for(jog_arena* arena, size_t need) {
+	arena_chunk* chunk = arena->current;
+	arena_chunk* last = NULL;
+	size_t capacity;
+	for (; chunk != NULL; chunk = chunk->next) {
+		if (chunk->capacity - chunk->used >= need) {
+			arena->current = chunk;
+			return chunk;
+		}
+		last = chunk;
+	}
+	capacity = last ? last->capacity * 2 : ARENA_CHUNK;
+	while (capacity < need) {
+		capacity *= 2;
+	}
+	chunk = counted_malloc(NULL, align_up(sizeof(arena_chunk)) + capacity);
+	if (chunk == NULL) {
+		return NULL;
+	}
+	chunk->next = NULL;
+	chunk->capacity = capacity;
+	chunk->used = 0;
+	if (last) {
+		last->next = chunk;
+	} else {
+		arena->chunks = chunk;
+	}
+	arena->current = chunk;
+	return chunk;
+}
+
+static void* arena_malloc(void* ctx, size_t size) {
+	jog_arena* arena = (jog_arena*) ctx;
+	size_t need = ARENA_ALIGN + align_up(size);
+	arena_chunk* chunk = arena_chunk_for(arena, need);
+	char* ptr;
+	if (chunk == NULL) {
+		return NULL;
+	}
+	ptr = chunk_data(chunk) + chunk->used + ARENA_ALIGN;
+	chunk->used += need;
+	arena->account->allocated += need;
+	*header_of(ptr) = align_up(size);
+	return ptr;
+}
+
+static void* arena_realloc(void* ctx, void* ptr, size_t size) {
+	jog_arena* arena = (jog_arena*) ctx;
+	arena_chunk* chunk = arena->current;
+	size_t old, grown;
+	void* moved;
+	if (ptr == NULL) {
+		return arena_malloc(ctx, size);
+	}
+	old = *header_of(ptr);
+	if (size <= old) {
+		return ptr;
+	}
+	// The last allocation of the current chunk can grow in place.
+	grown = align_up(size);
+	if (chunk != NULL && (char*) ptr + old == chunk_data(chunk) + chunk->used &&
+		chunk->capacity - chunk->used >= grown - old) {
+		chunk->used += grown - old;
+		arena->account->allocated += grown - old;
+		*header_of(ptr) = grown;
+		return ptr;
+	}
+	moved = arena_malloc(ctx, size);
+	if (moved != NULL) {
+		memcpy(moved, ptr, old);
+	}
+	return moved;
+}
+
+static void arena_free(void* ctx, void* ptr) {
+}
+
+jog_arena* jog_arena_new(void) {
+	jog_arena* arena = counted_malloc(NULL, sizeof(jog_arena));
+	if (arena == NULL) {
+		return NULL;
+	}
+	memset(arena, 0, sizeof(jog_arena));
+	arena->funcs.malloc = arena_malloc;
+	arena->funcs.realloc = arena_realloc;
+	arena->funcs.free = arena_free;
+	arena->funcs.ctx = arena;
+	return arena;
+}
+
+void jog_arena_reset(jog_arena* arena) {
+	arena_chunk* chunk;
+	for (chunk = arena->chunks; chunk != NULL; chunk = chunk->next) {
+		chunk->used = 0;
+	}
+	arena->current = arena->chunks;
+}
+
+void jog_arena_free(jog_arena* arena) {
+	arena_chunk* chunk = arena->chunks;
+	arena_chunk* next;
+	for (; chunk != NULL; chunk = next) {
+		next = chunk->next;
+		counted_free(NULL, chunk);
+	}
+	counted_free(NULL, arena);
+}
+
+yajl_val jog_tree_parse(const char* input, size_t length, jog_parse_control* control,
+	jog_arena* arena, jog_mem_account* account) {
+	parse_state state = { control, account, NULL, 0, 0 };
+	yajl_alloc_funcs funcs = account_funcs(account);
+	yajl_val tree;
+	account->allocated = 0;
+	if (arena != NULL) {
+		arena->account = account;
+		funcs = arena->funcs;
+	}
+	if (control == NULL) {
+		return yajl_tree_parse_hook(input, length, NULL, 0, NULL, NULL, &funcs, NULL);
+	}
+	tree = yajl_tree_parse_hook(input, length, NULL, 0, check_control, &state, &funcs, &control->offset);
+	free(state.levels);
+	// The last value is allocated after its event was checked.
+	if (tree != NULL && !within_budget(control, account)) {
+		if (arena == NULL) {
+			yajl_tree_free_alloc(tree, &funcs);
+		}
+		exceed(control, limit_memory);
+		control->offset = length;
+		return NULL;
+	}
+	return tree;
+}
+
+void jog_tree_free(yajl_val tree, jog_mem_account* account) {
+	yajl_alloc_funcs funcs = account_funcs(account);
+	yajl_tree_free_alloc(tree, &funcs);
+	free(account);
+}
+
+int jog_validate(const char* input, size_t length, jog_parse_control* control) {
+	static const yajl_callbacks callbacks = {
+		validate_null,
+		validate_boolean,
+		NULL,
+		NULL,
+		validate_number,
+		validate_string,
+		validate_start_map,
+		validate_map_key,
+		validate_end_map,
+		validate_start_array,
+		validate_end_array
+	};
+	jog_mem_account account = { 0 };
+	parse_state state = { control, &account, NULL, 0, 0 };
+	yajl_alloc_funcs funcs = account_funcs(&account);
+	yajl_handle handle = yajl_alloc(&callbacks, &funcs, &state);
+	yajl_status status;
+	int valid;
+	if (handle == NULL) {
+		return 0;
+	}
+	yajl_config(handle, yajl_allow_comments, 1);
+	status = yajl_parse(handle, (const unsigned char*) input, length);
+	if (status == yajl_status_ok) {
+		status = yajl_complete_parse(handle);
+	}
+	valid = status == yajl_status_ok;
+	if (!valid && control != NULL) {
+		control->offset = yajl_get_bytes_consumed(handle);
+	}
+	yajl_free(handle);
+	free(state.levels);
+	return valid;
+}
+
+// The first member of object v named key, like the Go lookups.
+static yajl_val object_member(yajl_val v, const char* key) {
+	size_t i;
+	if (!YAJL_IS_OBJECT(v)) {
+		return NULL;
+	}
+	for (i = 0; i < v->u.object.len; i++) {
+		if (strcmp(v->u.object.keys[i], key) == 0) {
+			return v->u.object.values[i];
+		}
+	}
+	return NULL;
+}
+
+yajl_val jog_lookup(yajl_val root, char** keys, size_t length) {
+	size_t k;
+	for (k = 0; root != NULL && k < length; k++) {
+		root = object_member(root, keys[k]);
+	}
+	return root;
+}
+
+void jog_extract(yajl_val root, jog_field* fields, size_t count) {
+	size_t f;
+	for (f = 0; f < count; f++) {
+		fields[f].value = jog_lookup(root, fields[f].keys, fields[f].length);
+	}
+}
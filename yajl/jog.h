@@ -0,0 +1,85 @@
+#ifndef JOG_YAJL_H
+#define JOG_YAJL_H
+
+#include <stdint.h>
+
+#include "api/yajl_gen.h"
+#include "api/yajl_tree.h"
+
+// Shared between Go and a running parse. Go sets canceled with
+// jog_cancel_parse from another thread and the parser checks it before every
+// value. A limit of zero is not enforced; exceeded is set to the jog.Limit
+// that stopped the parse. offset is set to where a failed parse stopped.
+typedef struct jog_parse_control {
+	int canceled;
+	size_t max_depth;
+	size_t max_string_length;
+	size_t max_members;
+	size_t max_memory;
+	int exceeded;
+	size_t offset;
+} jog_parse_control;
+
+void jog_cancel_parse(jog_parse_control* control);
+
+// All native memory of trees, arenas and generators is allocated through
+// jog_counted_funcs, so that it is counted in the jog_memory_stats. A copy
+// of the funcs whose ctx is an account also charges the account.
+typedef struct jog_memory_stats {
+	int64_t in_use;
+	int64_t total_alloc;
+	int64_t mallocs;
+	int64_t frees;
+} jog_memory_stats;
+
+typedef struct jog_mem_account {
+	int64_t allocated;
+} jog_mem_account;
+
+extern yajl_alloc_funcs jog_counted_funcs;
+
+void jog_get_memory_stats(jog_memory_stats* stats);
+
+// An arena hands out the memory for one tree at a time. Freeing memory from
+// it is a no-op; jog_arena_reset makes all of it available again while
+// keeping the chunks for the next tree.
+typedef struct jog_arena jog_arena;
+
+jog_arena* jog_arena_new(void);
+void jog_arena_reset(jog_arena* arena);
+void jog_arena_free(jog_arena* arena);
+
+// Parse length bytes of UTF-8 input into a tree, charging its memory to
+// account from zero. control may be NULL. If arena is not NULL the tree is allocated
+// in it and must not be freed; it lives until the arena is reset.
+yajl_val jog_tree_parse(const char* input, size_t length, jog_parse_control* control,
+	jog_arena* arena, jog_mem_account* account);
+
+// Check length bytes of UTF-8 input like jog_tree_parse without building a
+// tree. Returns zero if it is invalid. control may be NULL.
+int jog_validate(const char* input, size_t length, jog_parse_control* control);
+
+// Free a tree parsed without an arena, along with its account.
+void jog_tree_free(yajl_val tree, jog_mem_account* account);
+
+// Follow length keys from root. Returns NULL if one of them is missing.
+yajl_val jog_lookup(yajl_val root, char** keys, size_t length);
+
+// A field for jog_extract: the keys to follow from the root, and the value
+// found there or NULL.
+typedef struct jog_field {
+	char** keys;
+	size_t length;
+	yajl_val value;
+} jog_field;
+
+// Look up count fields under root at once.
+void jog_extract(yajl_val root, jog_field* fields, size_t count);
+
+// Allocate a generator that prints through the Go sink registered under
+// handle, with the yajl_gen_escape_solidus and yajl_gen_validate_utf8
+// options set as given. Returns NULL if the generator could not be
+// configured.
+yajl_gen jog_gen_alloc(uintptr_t handle, int escape_solidus, int validate_utf8);
+
+#endif
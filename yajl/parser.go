@@ -0,0 +1,79 @@
+package yajl
+
+// #include <stdlib.h>
+// #include "jog.h"
+import "C"
+
+import (
+	"context"
+	"runtime"
+	"unsafe"
+
+	"github.com/anantn/jog"
+)
+
+// Parser parses documents one after another into the same arena, so once
+// the arena has grown to fit them, parsing stops allocating native memory.
+// A document is only valid until the next call to Parse or Reset, and a
+// Parser must not be used by more than one goroutine at a time. If its arena
+// can't be allocated, a Parser parses each document into memory of its own,
+// as New does.
+type Parser struct {
+	opts    jog.Options
+	arena   *C.jog_arena
+	account *C.jog_mem_account
+}
+
+// Finalizer to free the arena of a Parser.
+func cleanupParser(p *Parser) {
+	if p.arena != nil {
+		C.jog_arena_free(p.arena)
+		C.free(unsafe.Pointer(p.account))
+	}
+}
+
+// Create a Parser reading documents as described by opts.
+func NewParser(opts jog.Options) *Parser {
+	return newParser(opts, C.jog_arena_new())
+}
+
+// Parse data, invalidating the previous document.
+func (p *Parser) Parse(data []byte) (jog.Value, error) {
+	defer runtime.KeepAlive(p)
+	p.Reset()
+	return parseContext(context.Background(), data, p.opts, p.pooled())
+}
+
+// Release the last document, keeping its memory for the next one.
+func (p *Parser) Reset() {
+	defer runtime.KeepAlive(p)
+	if p.arena != nil {
+		C.jog_arena_reset(p.arena)
+	}
+}
+
+// Private methods.
+
+// A Parser owning arena, or parsing without one if arena or its account is
+// nil. The arena is freed if the account can't be allocated.
+func newParser(opts jog.Options, arena *C.jog_arena) *Parser {
+	p := &Parser{opts: opts}
+	if arena != nil {
+		p.account = (*C.jog_mem_account)(C.calloc(1, C.sizeof_jog_mem_account))
+		if p.account == nil {
+			C.jog_arena_free(arena)
+		} else {
+			p.arena = arena
+		}
+	}
+	runtime.SetFinalizer(p, cleanupParser)
+	return p
+}
+
+// The Parser to parse into, or nil to parse without the arena.
+func (p *Parser) pooled() *Parser {
+	if p.arena == nil {
+		return nil
+	}
+	return p
+}
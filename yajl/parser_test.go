@@ -0,0 +1,21 @@
+package yajl
+
+import (
+	"testing"
+
+	"github.com/anantn/jog"
+)
+
+func TestParserWithoutPool(t *testing.T) {
+	p := newParser(jog.Options{}, nil)
+	for i := 0; i < 2; i++ {
+		v, err := p.Parse([]byte(`{"a":[1,2]}`))
+		if err != nil {
+			t.Fatalf("Expected the document to parse, got %v\n", err)
+		}
+		if n, err := v.IndexInt(1, "a"); err != nil || n != 2 {
+			t.Fatalf("Expected a/1 to be 2, got %d (%v)\n", n, err)
+		}
+		p.Reset()
+	}
+}
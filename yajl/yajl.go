@@ -1,21 +1,56 @@
 package yajl
 
+// #include <stdlib.h>
 // #include <string.h>
 // #include "api/yajl_gen.h"
 // #include "api/yajl_tree.h"
+// #include "jog.h"
 import "C"
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"iter"
 	"runtime"
+	"strings"
 	"unsafe"
 
 	"github.com/anantn/jog"
+	"github.com/anantn/jog/internal/lazy"
+	"github.com/anantn/jog/internal/number"
 )
 
+// A parsed value is safe to read from many goroutines at once: the tree is
+// never modified after parsing and every getter only reads it.
 type yajlValue struct {
 	ptr *C.struct_yajl_val_s
+	// The value owning the tree, or nil if this is the root. Children keep
+	// it reachable so its finalizer can't free the tree under them.
+	root *yajlValue
+	// The Parser whose arena holds the tree, or nil if the root owns it.
+	parser *Parser
+	// The memory charged for the tree, set on the root. The account is
+	// freed with a tree the root owns.
+	account *C.jog_mem_account
+	memory  int
+}
+
+func init() {
+	jog.RegisterStats("yajl", Stats)
+}
+
+// Stats returns the native memory counters of this backend.
+func Stats() jog.MemoryStats {
+	var stats C.jog_memory_stats
+	C.jog_get_memory_stats(&stats)
+	return jog.MemoryStats{
+		InUse:      int64(stats.in_use),
+		TotalAlloc: int64(stats.total_alloc),
+		Mallocs:    int64(stats.mallocs),
+		Frees:      int64(stats.frees),
+	}
 }
 
 const (
@@ -29,13 +64,10 @@ const (
 	yajl_t_any
 )
 
-var ptr *C.char
-var ptrSize = unsafe.Sizeof(ptr)
-var ll C.longlong
-var llSize = unsafe.Sizeof(ll)
-var d C.double
-var dSize = unsafe.Sizeof(d)
+const ptrSize = unsafe.Sizeof((*C.char)(nil))
 
+// The structs of the yajl_val_s union, which cgo only exposes as bytes.
+// Views are read in place, so the C memory must stay aligned and alive.
 type yajlNumber struct {
 	i     C.longlong
 	d     C.double
@@ -43,13 +75,21 @@ type yajlNumber struct {
 	flags C.uint
 }
 
-func unionToNumber(u [32]byte) *yajlNumber {
-	return &yajlNumber{
-		*(*C.longlong)(unsafe.Pointer(&u[0:llSize][0])),
-		*(*C.double)(unsafe.Pointer(&u[llSize : llSize+dSize][0])),
-		*(**C.char)(unsafe.Pointer(&u[llSize+dSize : llSize+dSize+ptrSize][0])),
-		*(*C.uint)(unsafe.Pointer(&u[llSize+dSize+ptrSize : llSize+dSize+ptrSize*2][0])),
+func unionToNumber(u *[32]byte) *yajlNumber {
+	return (*yajlNumber)(unsafe.Pointer(u))
+}
+
+// Integers yajl parsed are taken as they are; the text of the others is
+// classified like rapidjson does.
+func (n *yajlNumber) number() number.Number {
+	if n.flags&C.YAJL_NUMBER_INT_VALID != 0 {
+		return number.Number{Kind: number.Int, I: int64(n.i)}
+	}
+	length := 0
+	for *(*byte)(unsafe.Add(unsafe.Pointer(n.r), length)) != 0 {
+		length++
 	}
+	return number.Parse(unsafe.String((*byte)(unsafe.Pointer(n.r)), length))
 }
 
 type yajlObject struct {
@@ -58,12 +98,8 @@ type yajlObject struct {
 	len    C.size_t
 }
 
-func unionToObject(u [32]byte) *yajlObject {
-	return &yajlObject{
-		*(***C.char)(unsafe.Pointer(&u[0:ptrSize][0])),
-		*(***C.struct_yajl_val_s)(unsafe.Pointer(&u[ptrSize : ptrSize*2][0])),
-		*(*C.size_t)(unsafe.Pointer(&u[ptrSize*2 : ptrSize*2+ptrSize][0])),
-	}
+func unionToObject(u *[32]byte) *yajlObject {
+	return (*yajlObject)(unsafe.Pointer(u))
 }
 
 type yajlArray struct {
@@ -71,11 +107,8 @@ type yajlArray struct {
 	len    C.size_t
 }
 
-func unionToArray(u [32]byte) *yajlArray {
-	return &yajlArray{
-		*(***C.struct_yajl_val_s)(unsafe.Pointer(&u[0:ptrSize][0])),
-		*(*C.size_t)(unsafe.Pointer(&u[ptrSize : ptrSize*2][0])),
-	}
+func unionToArray(u *[32]byte) *yajlArray {
+	return (*yajlArray)(unsafe.Pointer(u))
 }
 
 // Finalizer to call the yajl_tree_free.
@@ -84,104 +117,399 @@ func cleanupTree(j jog.Value) {
 	if !ok {
 		panic("cleanupTree called on non yajlValue object!")
 	}
-	C.yajl_tree_free(yajlValue.ptr)
+	C.jog_tree_free(yajlValue.ptr, yajlValue.account)
 }
 
 // Constructor by string.
 func New(val string) (jog.Value, error) {
 	cval := C.CString(val)
-	yval := C.yajl_tree_parse(cval, nil, 0)
+	defer C.free(unsafe.Pointer(cval))
+	return parse(cval, C.size_t(len(val)), nil, nil)
+}
+
+// Constructor by bytes, in the encoding given by opts. yajl only reads UTF-8,
+// so other encodings are transcoded before parsing.
+func NewWithOptions(data []byte, opts jog.Options) (jog.Value, error) {
+	return NewContext(context.Background(), data, opts)
+}
+
+// Constructor by bytes that stops parsing once ctx is done, returning
+// ctx.Err() wrapped with the offset reached. A document exceeding
+// opts.Limits returns a *jog.LimitError.
+func NewContext(ctx context.Context, data []byte, opts jog.Options) (jog.Value, error) {
+	return parseContext(ctx, data, opts, nil)
+}
+
+// Parse data into the arena of p, or into a tree of its own if p is nil.
+func parseContext(ctx context.Context, data []byte, opts jog.Options, p *Parser) (jog.Value, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := opts.Limits.CheckSize(len(data)); err != nil {
+		return nil, err
+	}
+	if opts.Encoding != jog.EncodingUTF8 {
+		var err error
+		data, err = jog.Transcode(data, opts.Encoding)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var control *C.jog_parse_control
+	if ctx.Done() != nil || opts.Limits != (jog.Limits{}) {
+		control = (*C.jog_parse_control)(C.calloc(1, C.sizeof_jog_parse_control))
+		defer C.free(unsafe.Pointer(control))
+		control.max_depth = C.size_t(max(opts.Limits.MaxDepth, 0))
+		control.max_string_length = C.size_t(max(opts.Limits.MaxStringLength, 0))
+		control.max_members = C.size_t(max(opts.Limits.MaxMembers, 0))
+		control.max_memory = C.size_t(max(opts.Limits.MaxMemory, 0))
+	}
+	stop := watch(ctx, control)
+	var v jog.Value
+	var err error
+	if opts.Lazy {
+		v, err = parseLazy(data, control)
+	} else {
+		cdata := (*C.char)(unsafe.Pointer(unsafe.SliceData(data)))
+		v, err = parse(cdata, C.size_t(len(data)), control, p)
+	}
+	if stop() && err != nil {
+		return nil, fmt.Errorf("[%d] Parsing was canceled: %w", int(control.offset), ctx.Err())
+	}
+	if control != nil && control.exceeded != 0 {
+		limit := jog.Limit(control.exceeded)
+		return nil, &jog.LimitError{Limit: limit, Max: opts.Limits.Get(limit), Offset: int(control.offset)}
+	}
+	return v, err
+}
+
+// The tree holds copies of all strings, so the input can be freed. A tree
+// parsed into the arena of p is freed with it instead of by a finalizer.
+func parse(input *C.char, length C.size_t, control *C.jog_parse_control, p *Parser) (jog.Value, error) {
+	if p != nil {
+		yval := C.jog_tree_parse(input, length, control, p.arena, p.account)
+		if yval == nil {
+			return nil, errors.New("Could not parse JSON!")
+		}
+		return &yajlValue{ptr: yval, parser: p, memory: int(p.account.allocated)}, nil
+	}
+	account := (*C.jog_mem_account)(C.calloc(1, C.sizeof_jog_mem_account))
+	yval := C.jog_tree_parse(input, length, control, nil, account)
 	if yval == nil {
+		C.free(unsafe.Pointer(account))
 		return nil, errors.New("Could not parse JSON!")
 	}
-	obj := &yajlValue{yval}
+	obj := &yajlValue{ptr: yval, account: account, memory: int(account.allocated)}
 	runtime.SetFinalizer(obj, cleanupTree)
 	return obj, nil
 }
 
-func (j *yajlValue) get(path ...string) (*C.struct_yajl_val_s, error) {
+// Validate data and keep a copy of it as a lazy value, which parses the
+// subtrees it needs like New.
+func parseLazy(data []byte, control *C.jog_parse_control) (jog.Value, error) {
+	data = bytes.Clone(data)
+	cdata := (*C.char)(unsafe.Pointer(unsafe.SliceData(data)))
+	if C.jog_validate(cdata, C.size_t(len(data)), control) == 0 {
+		return nil, errors.New("Could not parse JSON!")
+	}
+	return lazy.New(data, func(span []byte) (jog.Value, error) {
+		cspan := (*C.char)(unsafe.Pointer(unsafe.SliceData(span)))
+		return parse(cspan, C.size_t(len(span)), nil, nil)
+	}), nil
+}
+
+// Cancel the parse behind control once ctx is done. The returned function
+// stops watching and reports whether the parse was canceled.
+func watch(ctx context.Context, control *C.jog_parse_control) func() bool {
+	if control == nil || ctx.Done() == nil {
+		return func() bool { return false }
+	}
+	stop := make(chan struct{})
+	canceled := make(chan bool)
+	go func() {
+		select {
+		case <-ctx.Done():
+			C.jog_cancel_parse(control)
+			canceled <- true
+		case <-stop:
+			canceled <- false
+		}
+	}()
+	return func() bool {
+		close(stop)
+		return <-canceled
+	}
+}
+
+// Wrap a node of the tree owned by j.
+func (j *yajlValue) child(n *C.struct_yajl_val_s) *yajlValue {
+	return &yajlValue{ptr: n, root: j.owner()}
+}
+
+// The value owning the tree of j.
+func (j *yajlValue) owner() *yajlValue {
+	if j.root != nil {
+		return j.root
+	}
+	return j
+}
+
+// The array at path.
+func (j *yajlValue) array(path []string) (*C.struct_yajl_val_s, error) {
+	n := j.ptr
+	var err error
+	if len(path) != 0 {
+		n, err = j.get("array", path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if int(n._type) != yajl_t_array {
+		return nil, jog.MismatchError(path, "array", yajlType(n))
+	}
+	return n, nil
+}
+
+// The object at path.
+func (j *yajlValue) object(path []string) (*C.struct_yajl_val_s, error) {
+	n, err := j.get("object", path)
+	if err != nil {
+		return nil, err
+	}
+	if int(n._type) != yajl_t_object {
+		return nil, jog.MismatchError(path, "object", yajlType(n))
+	}
+	return n, nil
+}
+
+// Element i of the array at path, wrapped without allocating for the Index
+// getters to read.
+func (j *yajlValue) element(expected string, i int, path []string) (yajlValue, error) {
+	defer runtime.KeepAlive(j)
+	n, err := j.array(path)
+	if err != nil {
+		return yajlValue{}, err
+	}
+	arr := unionToArray(&n.u)
+	if i < 0 || i >= int(arr.len) {
+		return yajlValue{}, jog.OutOfRangeError(path, i, expected)
+	}
+	value := *(**C.struct_yajl_val_s)(unsafe.Add(unsafe.Pointer(arr.values), uintptr(i)*ptrSize))
+	return yajlValue{ptr: value, root: j.owner()}, nil
+}
+
+func (j *yajlValue) get(expected string, path []string) (*C.struct_yajl_val_s, error) {
 	if len(path) == 0 {
 		return j.ptr, nil
 	}
 	n := j.ptr
-	for _, part := range path {
+	for segment, part := range path {
 		if int(n._type) != yajl_t_object {
-			return nil, errors.New("Get called on a non-object value!")
+			return nil, jog.NotFoundError(path, segment, expected, yajlType(n))
 		}
 		i := 0
-		obj := unionToObject(n.u)
+		obj := unionToObject(&n.u)
 		for ; i < int(obj.len); i++ {
 			keyPtr := (**C.char)(unsafe.Pointer(uintptr(unsafe.Pointer(obj.keys)) + uintptr(i)*ptrSize))
-			child := C.GoString(*keyPtr)
-			if child == part {
+			if keyEquals(*keyPtr, part) {
 				valPtr := (**C.struct_yajl_val_s)(unsafe.Pointer(uintptr(unsafe.Pointer(obj.values)) + uintptr(i)*ptrSize))
 				n = *valPtr
 				break
 			}
 		}
 		if i == int(obj.len) {
-			return nil, errors.New("Could not find child at path!")
+			return nil, jog.NotFoundError(path, segment, expected, jog.TypeObject)
 		}
 	}
-	if n == nil {
-		return nil, errors.New("Could not find valid value at path!")
-	}
 	return n, nil
 }
 
 func (j *yajlValue) Get(path ...string) (jog.Value, error) {
-	n, err := j.get(path...)
+	defer runtime.KeepAlive(j)
+	n, err := j.get("value", path)
 	if err != nil {
 		return nil, err
 	}
-	return &yajlValue{n}, nil
+	return j.child(n), nil
 }
 
-func (j *yajlValue) getNumber(path ...string) (*yajlNumber, error) {
+// The compiled keys are followed in C. A failed lookup is walked again to
+// tell where it failed.
+func (j *yajlValue) At(path *jog.Path) (jog.Value, error) {
+	defer runtime.KeepAlive(j)
+	compiled := path.Compiled("yajl", compilePath).(*yajlPath)
+	defer runtime.KeepAlive(compiled)
+	var n *C.struct_yajl_val_s
+	if !compiled.nul {
+		n = C.jog_lookup(j.ptr, compiled.keys, C.size_t(compiled.length))
+	}
+	if n == nil {
+		return j.Get(path.Segments()...)
+	}
+	return j.child(n), nil
+}
+
+// The keys of a path as C strings for jog_lookup, stored after the array
+// pointing at them and freed along with the jog.Path keeping them. A key
+// holding a NUL byte would match the key it starts with as a C string, so At
+// and Extract follow such a path in Go.
+type yajlPath struct {
+	keys   **C.char
+	length int
+	nul    bool
+}
+
+func compilePath(segments []string) any {
+	p := &yajlPath{length: len(segments)}
+	if len(segments) == 0 {
+		return p
+	}
+	for _, key := range segments {
+		p.nul = p.nul || strings.IndexByte(key, 0) >= 0
+	}
+	offset := len(segments) * int(ptrSize)
+	size := offset
+	for _, key := range segments {
+		size += len(key) + 1
+	}
+	ptr := C.malloc(C.size_t(size))
+	keys := unsafe.Slice((**C.char)(ptr), len(segments))
+	buf := unsafe.Slice((*byte)(ptr), size)
+	for i, key := range segments {
+		keys[i] = (*C.char)(unsafe.Pointer(&buf[offset]))
+		offset += copy(buf[offset:], key)
+		buf[offset] = 0
+		offset++
+	}
+	p.keys = (**C.char)(ptr)
+	runtime.SetFinalizer(p, func(p *yajlPath) {
+		C.free(unsafe.Pointer(p.keys))
+	})
+	return p
+}
+
+func (j *yajlValue) Extract(fields []jog.Field, results []jog.Result) {
+	defer runtime.KeepAlive(j)
+	if len(fields) == 0 {
+		return
+	}
+
+	cfields := make([]C.jog_field, len(fields))
+	for i, field := range fields {
+		path := field.Path.Compiled("yajl", compilePath).(*yajlPath)
+		cfields[i].keys = path.keys
+		cfields[i].length = C.size_t(path.length)
+	}
+	C.jog_extract(j.ptr, &cfields[0], C.size_t(len(cfields)))
+	runtime.KeepAlive(fields)
+	for i, field := range fields {
+		if field.Path.Compiled("yajl", compilePath).(*yajlPath).nul {
+			cfields[i].value, _ = j.get("value", field.Path.Segments())
+		}
+	}
+
+	for i, field := range cfields {
+		n := field.value
+		r := &results[i]
+		if n == nil {
+			r.Status = jog.FieldMissing
+			continue
+		}
+		switch int(n._type) {
+		case yajl_t_string:
+			r.Type = jog.TypeString
+			r.String = C.GoString(*(**C.char)(unsafe.Pointer(&n.u)))
+		case yajl_t_number:
+			num := unionToNumber(&n.u).number()
+			r.Type = jog.TypeNumber
+			r.Float = float64(unionToNumber(&n.u).d)
+			if num.Kind == number.Int {
+				r.Int, r.Integer = num.I, true
+			}
+		case yajl_t_object:
+			r.Type = jog.TypeObject
+			r.Value = j.child(n)
+		case yajl_t_array:
+			r.Type = jog.TypeArray
+			r.Value = j.child(n)
+		case yajl_t_true, yajl_t_false:
+			r.Type = jog.TypeBool
+			r.Bool = int(n._type) == yajl_t_true
+		case yajl_t_null:
+			r.Type = jog.TypeNull
+		}
+		if fields[i].Type == jog.TypeUnknown {
+			r.Value = j.child(n)
+		}
+	}
+}
+
+func (j *yajlValue) getNumber(name string, path ...string) (*yajlNumber, error) {
 	n := j.ptr
 	var err error
 	if len(path) != 0 {
-		n, err = j.get(path...)
+		n, err = j.get(name, path)
 		if err != nil {
 			return nil, err
 		}
 	}
 	if int(n._type) != yajl_t_number {
-		return nil, errors.New("GetInt called on a non-number value!")
+		return nil, jog.MismatchError(path, name, yajlType(n))
 	}
-	obj := unionToNumber(n.u)
+	obj := unionToNumber(&n.u)
 	return obj, nil
 }
 
 func (j *yajlValue) GetInt(path ...string) (int, error) {
-	obj, err := j.getNumber(path...)
+	defer runtime.KeepAlive(j)
+	obj, err := j.getNumber("int", path...)
 	if err != nil {
 		return 0, err
 	}
-	return int(obj.i), nil
+	i, err := obj.number().Int()
+	if err != nil {
+		return 0, jog.NumberError(err, "int", path)
+	}
+	return i, nil
 }
 
 func (j *yajlValue) GetUInt(path ...string) (uint, error) {
-	obj, err := j.getNumber(path...)
+	defer runtime.KeepAlive(j)
+	obj, err := j.getNumber("uint", path...)
 	if err != nil {
 		return 0, err
 	}
-	return uint(obj.i), nil
+	u, err := obj.number().Uint()
+	if err != nil {
+		return 0, jog.NumberError(err, "uint", path)
+	}
+	return u, nil
 }
 
 func (j *yajlValue) GetFloat(path ...string) (float64, error) {
-	obj, err := j.getNumber(path...)
+	defer runtime.KeepAlive(j)
+	obj, err := j.getNumber("float", path...)
+	if err != nil {
+		return 0, err
+	}
+	return obj.number().Approx(), nil
+}
+
+func (j *yajlValue) NumberKind(path ...string) (jog.NumberKind, error) {
+	defer runtime.KeepAlive(j)
+	obj, err := j.getNumber("number", path...)
 	if err != nil {
 		return 0, err
 	}
-	return float64(obj.d), nil
+	return jog.NumberKind(obj.number().Flags()), nil
 }
 
 func (j *yajlValue) GetBool(path ...string) (bool, error) {
+	defer runtime.KeepAlive(j)
 	n := j.ptr
 	var err error
 	if len(path) != 0 {
-		n, err = j.get(path...)
+		n, err = j.get("bool", path)
 		if err != nil {
 			return false, err
 		}
@@ -192,60 +520,49 @@ func (j *yajlValue) GetBool(path ...string) (bool, error) {
 	if int(n._type) == yajl_t_false {
 		return false, nil
 	}
-	return false, errors.New("GetBool called on non-boolean type!")
+	return false, jog.MismatchError(path, "bool", yajlType(n))
 }
 
 func (j *yajlValue) GetString(path ...string) (string, error) {
+	defer runtime.KeepAlive(j)
 	n := j.ptr
 	var err error
 	if len(path) != 0 {
-		n, err = j.get(path...)
+		n, err = j.get("string", path)
 		if err != nil {
 			return "", err
 		}
 	}
 	if int(n._type) != yajl_t_string {
-		return "", errors.New("GetString called on a non-string value!")
+		return "", jog.MismatchError(path, "string", yajlType(n))
 	}
 	str := (**C.char)(unsafe.Pointer(&n.u))
 	return C.GoString(*str), nil
 }
 
 func (j *yajlValue) GetArray(path ...string) ([]jog.Value, error) {
-	n := j.ptr
-	var err error
-	if len(path) != 0 {
-		n, err = j.get(path...)
-		if err != nil {
-			return nil, err
-		}
-	}
-	if int(n._type) != yajl_t_array {
-		return nil, errors.New("GetArray called on a non-array value!")
+	defer runtime.KeepAlive(j)
+	n, err := j.array(path)
+	if err != nil {
+		return nil, err
 	}
-	obj := unionToArray(n.u)
+	obj := unionToArray(&n.u)
 	l := int(obj.len)
 	arr := make([]jog.Value, l)
 	for i := 0; i < l; i++ {
 		valPtr := (**C.struct_yajl_val_s)(unsafe.Pointer(uintptr(unsafe.Pointer(obj.values)) + uintptr(i)*ptrSize))
-		arr[i] = &yajlValue{*valPtr}
+		arr[i] = j.child(*valPtr)
 	}
 	return arr, nil
 }
 
 func (j *yajlValue) GetObject(path ...string) (map[string]jog.Value, error) {
-	n := j.ptr
-	var err error
-	if len(path) != 0 {
-		n, err = j.get(path...)
-		if err != nil {
-			return nil, err
-		}
-	}
-	if int(n._type) != yajl_t_object {
-		return nil, errors.New("GetObject called on a non-object value!")
+	defer runtime.KeepAlive(j)
+	n, err := j.object(path)
+	if err != nil {
+		return nil, err
 	}
-	obj := unionToObject(n.u)
+	obj := unionToObject(&n.u)
 	l := int(obj.len)
 	bag := make(map[string]jog.Value, l)
 	keySize := unsafe.Sizeof(obj.keys)
@@ -253,16 +570,159 @@ func (j *yajlValue) GetObject(path ...string) (map[string]jog.Value, error) {
 	for i := 0; i < l; i++ {
 		keyPtr := (**C.char)(unsafe.Pointer(uintptr(unsafe.Pointer(obj.keys)) + uintptr(i)*keySize))
 		valPtr := (**C.struct_yajl_val_s)(unsafe.Pointer(uintptr(unsafe.Pointer(obj.values)) + uintptr(i)*valueSize))
-		bag[C.GoString(*keyPtr)] = &yajlValue{*valPtr}
+		bag[C.GoString(*keyPtr)] = j.child(*valPtr)
 	}
 	return bag, nil
 }
 
+func (j *yajlValue) Len(path ...string) (int, error) {
+	defer runtime.KeepAlive(j)
+	n, err := j.get("array or object", path)
+	if err != nil {
+		return 0, err
+	}
+	switch int(n._type) {
+	case yajl_t_array:
+		return int(unionToArray(&n.u).len), nil
+	case yajl_t_object:
+		return int(unionToObject(&n.u).len), nil
+	}
+	return 0, jog.MismatchError(path, "array or object", yajlType(n))
+}
+
+func (j *yajlValue) Index(i int, path ...string) (jog.Value, error) {
+	e, err := j.element("value", i, path)
+	if err != nil {
+		return nil, err
+	}
+	return j.child(e.ptr), nil
+}
+
+func (j *yajlValue) IndexInt(i int, path ...string) (int, error) {
+	e, err := j.element("int", i, path)
+	if err != nil {
+		return 0, err
+	}
+	n, err := e.GetInt()
+	return n, jog.ElementError(err, path, i)
+}
+
+func (j *yajlValue) IndexUInt(i int, path ...string) (uint, error) {
+	e, err := j.element("uint", i, path)
+	if err != nil {
+		return 0, err
+	}
+	u, err := e.GetUInt()
+	return u, jog.ElementError(err, path, i)
+}
+
+func (j *yajlValue) IndexFloat(i int, path ...string) (float64, error) {
+	e, err := j.element("float", i, path)
+	if err != nil {
+		return 0, err
+	}
+	f, err := e.GetFloat()
+	return f, jog.ElementError(err, path, i)
+}
+
+func (j *yajlValue) IndexBool(i int, path ...string) (bool, error) {
+	e, err := j.element("bool", i, path)
+	if err != nil {
+		return false, err
+	}
+	b, err := e.GetBool()
+	return b, jog.ElementError(err, path, i)
+}
+
+func (j *yajlValue) IndexString(i int, path ...string) (string, error) {
+	e, err := j.element("string", i, path)
+	if err != nil {
+		return "", err
+	}
+	str, err := e.GetString()
+	return str, jog.ElementError(err, path, i)
+}
+
+func (j *yajlValue) Elements(path ...string) iter.Seq2[int, jog.Value] {
+	return jog.Elements(j, path...)
+}
+
+func (j *yajlValue) ArrayIterator(path ...string) (jog.ArrayIterator, error) {
+	defer runtime.KeepAlive(j)
+	n, err := j.array(path)
+	if err != nil {
+		return nil, err
+	}
+	arr := unionToArray(&n.u)
+	return &yajlArrayIterator{values: arr.values, length: int(arr.len), index: -1, elem: yajlValue{root: j.owner()}}, nil
+}
+
+func (j *yajlValue) ObjectIterator(path ...string) (jog.ObjectIterator, error) {
+	defer runtime.KeepAlive(j)
+	n, err := j.object(path)
+	if err != nil {
+		return nil, err
+	}
+	obj := unionToObject(&n.u)
+	return &yajlObjectIterator{keys: obj.keys, values: obj.values, length: int(obj.len), index: -1, elem: yajlValue{root: j.owner()}}, nil
+}
+
 func (j *yajlValue) Type(path ...string) jog.Type {
-	n, err := j.get(path...)
+	defer runtime.KeepAlive(j)
+	n, err := j.get("value", path)
+	if err != nil {
+		return jog.TypeMissing
+	}
+	return yajlType(n)
+}
+
+func (j *yajlValue) Exists(path ...string) bool {
+	return j.Type(path...) != jog.TypeMissing
+}
+
+func (j *yajlValue) IsNull(path ...string) bool {
+	return j.Type(path...) == jog.TypeNull
+}
+
+func (j *yajlValue) MemoryUsage() int {
+	if j.root != nil {
+		return j.root.memory
+	}
+	return j.memory
+}
+
+func (j *yajlValue) Stringify(path ...string) (string, error) {
+	defer runtime.KeepAlive(j)
+	n, err := j.get("value", path)
+	if err != nil {
+		return "", err
+	}
+	h := C.yajl_gen_alloc(&C.jog_counted_funcs)
+	defer C.yajl_gen_free(h)
+
+	err = toString(n, h)
 	if err != nil {
-		return jog.TypeUnknown
+		return "", err
 	}
+
+	var buf *C.uchar
+	var length C.size_t
+	if int(C.yajl_gen_get_buf(h, &buf, &length)) != 0 {
+		return "", errors.New("Could not get final encoded buffer!")
+	}
+
+	return C.GoString((*C.char)(unsafe.Pointer(buf))), nil
+}
+
+// The generator fails to open a container nested deeper than MaxDepth.
+func openError(s C.yajl_gen_status, what string) error {
+	if s == C.yajl_max_depth_exceeded {
+		return ErrMaxDepth
+	}
+	return fmt.Errorf("Could not start encoding %s!", what)
+}
+
+func yajlType(n *C.struct_yajl_val_s) jog.Type {
 	switch int(n._type) {
 	case yajl_t_string:
 		return jog.TypeString
@@ -282,26 +742,78 @@ func (j *yajlValue) Type(path ...string) jog.Type {
 	return jog.TypeUnknown
 }
 
-func (j *yajlValue) Stringify(path ...string) (string, error) {
-	n, err := j.get(path...)
-	if err != nil {
-		return "", err
+// The iterators step through the arrays of pointers yajl keeps, and wrap
+// each element or member in turn with elem.
+type yajlArrayIterator struct {
+	values **C.struct_yajl_val_s
+	length int
+	index  int
+	elem   yajlValue
+}
+
+func (it *yajlArrayIterator) Next() bool {
+	if it.index+1 >= it.length {
+		it.index = it.length
+		return false
 	}
-	h := C.yajl_gen_alloc(nil)
-	defer C.yajl_gen_free(h)
+	it.index++
+	it.elem.ptr = *(**C.struct_yajl_val_s)(unsafe.Add(unsafe.Pointer(it.values), uintptr(it.index)*ptrSize))
+	return true
+}
 
-	err = toString(n, h)
-	if err != nil {
-		return "", err
+func (it *yajlArrayIterator) Index() int {
+	return it.index
+}
+
+func (it *yajlArrayIterator) Value() jog.Value {
+	if it.index < 0 || it.index >= it.length {
+		return nil
 	}
+	return &it.elem
+}
 
-	var buf *C.uchar
-	var length C.size_t
-	if int(C.yajl_gen_get_buf(h, &buf, &length)) != 0 {
-		return "", errors.New("Could not get final encoded buffer!")
+type yajlObjectIterator struct {
+	keys   **C.char
+	values **C.struct_yajl_val_s
+	length int
+	index  int
+	elem   yajlValue
+}
+
+func (it *yajlObjectIterator) Next() bool {
+	if it.index+1 >= it.length {
+		it.index = it.length
+		return false
 	}
+	it.index++
+	it.elem.ptr = *(**C.struct_yajl_val_s)(unsafe.Add(unsafe.Pointer(it.values), uintptr(it.index)*ptrSize))
+	return true
+}
 
-	return C.GoString((*C.char)(unsafe.Pointer(buf))), nil
+func (it *yajlObjectIterator) Key() string {
+	defer runtime.KeepAlive(it)
+	if it.index < 0 || it.index >= it.length {
+		return ""
+	}
+	return C.GoString(*(**C.char)(unsafe.Add(unsafe.Pointer(it.keys), uintptr(it.index)*ptrSize)))
+}
+
+func (it *yajlObjectIterator) Value() jog.Value {
+	if it.index < 0 || it.index >= it.length {
+		return nil
+	}
+	return &it.elem
+}
+
+// Compare a NUL-terminated key of the tree with part without copying it.
+func keyEquals(key *C.char, part string) bool {
+	for i := 0; i < len(part); i++ {
+		c := *(*byte)(unsafe.Add(unsafe.Pointer(key), i))
+		if c == 0 || c != part[i] {
+			return false
+		}
+	}
+	return *(*byte)(unsafe.Add(unsafe.Pointer(key), len(part))) == 0
 }
 
 func toString(n *C.struct_yajl_val_s, h *C.struct_yajl_gen_t) error {
@@ -310,17 +822,17 @@ func toString(n *C.struct_yajl_val_s, h *C.struct_yajl_gen_t) error {
 		str := (**C.char)(unsafe.Pointer(&n.u))
 		length := C.strlen(*str)
 		if int(C.yajl_gen_string(h, *(**C.uchar)(unsafe.Pointer(str)), length)) != 0 {
-			errors.New("Could not encode string!")
+			return errors.New("Could not encode string!")
 		}
 	case yajl_t_number:
-		num := unionToNumber(n.u)
+		num := unionToNumber(&n.u)
 		if int(C.yajl_gen_number(h, num.r, C.strlen(num.r))) != 0 {
-			errors.New("Could not encode number!")
+			return errors.New("Could not encode number!")
 		}
 	case yajl_t_object:
-		obj := unionToObject(n.u)
-		if int(C.yajl_gen_map_open(h)) != 0 {
-			errors.New("Could not start encoding object!")
+		obj := unionToObject(&n.u)
+		if s := C.yajl_gen_map_open(h); s != C.yajl_gen_status_ok {
+			return openError(s, "object")
 		}
 		for i := 0; i < int(obj.len); i++ {
 			keyPtr := (**C.char)(unsafe.Pointer(uintptr(unsafe.Pointer(obj.keys)) + uintptr(i)*ptrSize))
@@ -334,12 +846,12 @@ func toString(n *C.struct_yajl_val_s, h *C.struct_yajl_gen_t) error {
 			}
 		}
 		if int(C.yajl_gen_map_close(h)) != 0 {
-			errors.New("Could not end encoding object!")
+			return errors.New("Could not end encoding object!")
 		}
 	case yajl_t_array:
-		arr := unionToArray(n.u)
-		if int(C.yajl_gen_array_open(h)) != 0 {
-			errors.New("Could not start encoding array!")
+		arr := unionToArray(&n.u)
+		if s := C.yajl_gen_array_open(h); s != C.yajl_gen_status_ok {
+			return openError(s, "array")
 		}
 		for i := 0; i < int(arr.len); i++ {
 			valPtr := (**C.struct_yajl_val_s)(unsafe.Pointer(uintptr(unsafe.Pointer(arr.values)) + uintptr(i)*ptrSize))
@@ -349,19 +861,19 @@ func toString(n *C.struct_yajl_val_s, h *C.struct_yajl_gen_t) error {
 			}
 		}
 		if int(C.yajl_gen_array_close(h)) != 0 {
-			errors.New("Could not end encoding array!")
+			return errors.New("Could not end encoding array!")
 		}
 	case yajl_t_true:
 		if int(C.yajl_gen_bool(h, 1)) != 0 {
-			errors.New("Could not encode true!")
+			return errors.New("Could not encode true!")
 		}
 	case yajl_t_false:
 		if int(C.yajl_gen_bool(h, 0)) != 0 {
-			errors.New("Could not encode false!")
+			return errors.New("Could not encode false!")
 		}
 	case yajl_t_null:
 		if int(C.yajl_gen_null(h)) != 0 {
-			errors.New("Could not encode null!")
+			return errors.New("Could not encode null!")
 		}
 	default:
 		return fmt.Errorf("Could not encode unknown value type! %d", int(n._type))
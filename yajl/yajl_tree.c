@@ -24,6 +24,7 @@
 #include "api/yajl_parse.h"
 
 #include "yajl_parser.h"
+#include "yajl_alloc.h"
 
 #if defined(_WIN32) || defined(WIN32)
 #define snprintf sprintf_s
@@ -47,6 +48,9 @@ struct context_s
     yajl_val root;
     char *errbuf;
     size_t errbuf_size;
+    yajl_tree_hook hook;
+    void *hook_ctx;
+    yajl_alloc_funcs afs;
 };
 typedef struct context_s context_t;
 
@@ -56,11 +60,17 @@ typedef struct context_s context_t;
         return (retval);                                                \
     }
 
-static yajl_val value_alloc (yajl_type type)
+#define CHECK_HOOK(ctx,event,length) {                                  \
+        context_t *c_ = (context_t *) (ctx);                            \
+        if (c_->hook != NULL && !c_->hook (c_->hook_ctx, (event), (length))) \
+            return (STATUS_ABORT);                                      \
+    }
+
+static yajl_val value_alloc (context_t *ctx, yajl_type type)
 {
     yajl_val v;
 
-    v = malloc (sizeof (*v));
+    v = YA_MALLOC (&ctx->afs, sizeof (*v));
     if (v == NULL) return (NULL);
     memset (v, 0, sizeof (*v));
     v->type = type;
@@ -68,39 +78,71 @@ static yajl_val value_alloc (yajl_type type)
     return (v);
 }
 
-static void yajl_object_free (yajl_val v)
+/*
+ * Values still to be freed. Freeing a tree with an explicit stack instead of
+ * recursion keeps deeply nested trees from overflowing the call stack.
+ */
+typedef struct
 {
-    size_t i;
+    yajl_alloc_funcs *afs;
+    yajl_val *values;
+    size_t len;
+    size_t cap;
+} free_stack_t;
 
-    if (!YAJL_IS_OBJECT(v)) return;
+static void free_later (free_stack_t *pending, yajl_val v)
+{
+    yajl_val *values;
+    size_t cap;
 
-    for (i = 0; i < v->u.object.len; i++)
+    if (v == NULL) return;
+
+    if (pending->len == pending->cap)
     {
-        free((char *) v->u.object.keys[i]);
-        v->u.object.keys[i] = NULL;
-        yajl_tree_free (v->u.object.values[i]);
-        v->u.object.values[i] = NULL;
+        cap = pending->cap ? pending->cap * 2 : 64;
+        values = YA_REALLOC (pending->afs, pending->values, cap * sizeof (yajl_val));
+        if (values == NULL)
+        {
+            /* Out of memory, free this subtree right away instead. */
+            yajl_tree_free_alloc (v, pending->afs);
+            return;
+        }
+        pending->values = values;
+        pending->cap = cap;
     }
-
-    free((void*) v->u.object.keys);
-    free(v->u.object.values);
-    free(v);
+    pending->values[pending->len++] = v;
 }
 
-static void yajl_array_free (yajl_val v)
+static void yajl_value_free (free_stack_t *pending, yajl_val v)
 {
     size_t i;
 
-    if (!YAJL_IS_ARRAY(v)) return;
-
-    for (i = 0; i < v->u.array.len; i++)
+    if (YAJL_IS_STRING(v))
     {
-        yajl_tree_free (v->u.array.values[i]);
-        v->u.array.values[i] = NULL;
+        YA_FREE(pending->afs, v->u.string);
     }
-
-    free(v->u.array.values);
-    free(v);
+    else if (YAJL_IS_NUMBER(v))
+    {
+        YA_FREE(pending->afs, v->u.number.r);
+    }
+    else if (YAJL_IS_OBJECT(v))
+    {
+        for (i = 0; i < v->u.object.len; i++)
+        {
+            YA_FREE(pending->afs, (char *) v->u.object.keys[i]);
+            free_later (pending, v->u.object.values[i]);
+        }
+        YA_FREE(pending->afs, (void*) v->u.object.keys);
+        YA_FREE(pending->afs, v->u.object.values);
+    }
+    else if (YAJL_IS_ARRAY(v))
+    {
+        for (i = 0; i < v->u.array.len; i++)
+            free_later (pending, v->u.array.values[i]);
+        YA_FREE(pending->afs, v->u.array.values);
+    }
+    /* yajl_t_true, yajl_t_false and yajl_t_null own no other memory. */
+    YA_FREE(pending->afs, v);
 }
 
 /*
@@ -114,7 +156,7 @@ static int context_push(context_t *ctx, yajl_val v)
 {
     stack_elem_t *stack;
 
-    stack = malloc (sizeof (*stack));
+    stack = YA_MALLOC (&ctx->afs, sizeof (*stack));
     if (stack == NULL)
         RETURN_ERROR (ctx, ENOMEM, "Out of memory");
     memset (stack, 0, sizeof (*stack));
@@ -144,11 +186,25 @@ static yajl_val context_pop(context_t *ctx)
 
     v = stack->value;
 
-    free (stack);
+    YA_FREE (&ctx->afs, stack);
 
     return (v);
 }
 
+/*
+ * Object and array storage doubles whenever its length reaches a power of
+ * two, so appending stays linear without storing a capacity.
+ */
+static int needs_growth (size_t len)
+{
+    return (len & (len - 1)) == 0;
+}
+
+static size_t grown_length (size_t len)
+{
+    return (len == 0) ? 1 : len * 2;
+}
+
 static int object_add_keyval(context_t *ctx,
                              yajl_val obj, char *key, yajl_val value)
 {
@@ -164,15 +220,18 @@ static int object_add_keyval(context_t *ctx,
     /* We're assuring that "obj" is an object in "context_add_value". */
     assert(YAJL_IS_OBJECT(obj));
 
-    tmpk = realloc((void *) obj->u.object.keys, sizeof(*(obj->u.object.keys)) * (obj->u.object.len + 1));
-    if (tmpk == NULL)
-        RETURN_ERROR(ctx, ENOMEM, "Out of memory");
-    obj->u.object.keys = tmpk;
-
-    tmpv = realloc(obj->u.object.values, sizeof (*obj->u.object.values) * (obj->u.object.len + 1));
-    if (tmpv == NULL)
-        RETURN_ERROR(ctx, ENOMEM, "Out of memory");
-    obj->u.object.values = tmpv;
+    if (needs_growth (obj->u.object.len))
+    {
+        tmpk = YA_REALLOC(&ctx->afs, (void *) obj->u.object.keys, sizeof(*(obj->u.object.keys)) * grown_length (obj->u.object.len));
+        if (tmpk == NULL)
+            RETURN_ERROR(ctx, ENOMEM, "Out of memory");
+        obj->u.object.keys = tmpk;
+
+        tmpv = YA_REALLOC(&ctx->afs, obj->u.object.values, sizeof (*obj->u.object.values) * grown_length (obj->u.object.len));
+        if (tmpv == NULL)
+            RETURN_ERROR(ctx, ENOMEM, "Out of memory");
+        obj->u.object.values = tmpv;
+    }
 
     obj->u.object.keys[obj->u.object.len] = key;
     obj->u.object.values[obj->u.object.len] = value;
@@ -195,11 +254,14 @@ static int array_add_value (context_t *ctx,
     /* "context_add_value" will only call us with array values. */
     assert(YAJL_IS_ARRAY(array));
 
-    tmp = realloc(array->u.array.values,
-                  sizeof(*(array->u.array.values)) * (array->u.array.len + 1));
-    if (tmp == NULL)
-        RETURN_ERROR(ctx, ENOMEM, "Out of memory");
-    array->u.array.values = tmp;
+    if (needs_growth (array->u.array.len))
+    {
+        tmp = YA_REALLOC(&ctx->afs, array->u.array.values,
+                         sizeof(*(array->u.array.values)) * grown_length (array->u.array.len));
+        if (tmp == NULL)
+            RETURN_ERROR(ctx, ENOMEM, "Out of memory");
+        array->u.array.values = tmp;
+    }
     array->u.array.values[array->u.array.len] = value;
     array->u.array.len++;
 
@@ -244,7 +306,7 @@ static int context_add_value (context_t *ctx, yajl_val v)
 
             ctx->stack->key = v->u.string;
             v->u.string = NULL;
-            free(v);
+            YA_FREE(&ctx->afs, v);
             return (0);
         }
         else /* if (ctx->key != NULL) */
@@ -268,19 +330,19 @@ static int context_add_value (context_t *ctx, yajl_val v)
     }
 }
 
-static int handle_string (void *ctx,
-                          const unsigned char *string, size_t string_length)
+static int add_string (void *ctx,
+                       const unsigned char *string, size_t string_length)
 {
     yajl_val v;
 
-    v = value_alloc (yajl_t_string);
+    v = value_alloc ((context_t *) ctx, yajl_t_string);
     if (v == NULL)
         RETURN_ERROR ((context_t *) ctx, STATUS_ABORT, "Out of memory");
 
-    v->u.string = malloc (string_length + 1);
+    v->u.string = YA_MALLOC (&((context_t *) ctx)->afs, string_length + 1);
     if (v->u.string == NULL)
     {
-        free (v);
+        YA_FREE (&((context_t *) ctx)->afs, v);
         RETURN_ERROR ((context_t *) ctx, STATUS_ABORT, "Out of memory");
     }
     memcpy(v->u.string, string, string_length);
@@ -289,19 +351,35 @@ static int handle_string (void *ctx,
     return ((context_add_value (ctx, v) == 0) ? STATUS_CONTINUE : STATUS_ABORT);
 }
 
+static int handle_string (void *ctx,
+                          const unsigned char *string, size_t string_length)
+{
+    CHECK_HOOK (ctx, yajl_tree_event_string, string_length);
+    return add_string (ctx, string, string_length);
+}
+
+static int handle_map_key (void *ctx,
+                           const unsigned char *string, size_t string_length)
+{
+    CHECK_HOOK (ctx, yajl_tree_event_map_key, string_length);
+    return add_string (ctx, string, string_length);
+}
+
 static int handle_number (void *ctx, const char *string, size_t string_length)
 {
     yajl_val v;
     char *endptr;
 
-    v = value_alloc(yajl_t_number);
+    CHECK_HOOK (ctx, yajl_tree_event_number, string_length);
+
+    v = value_alloc((context_t *) ctx, yajl_t_number);
     if (v == NULL)
         RETURN_ERROR((context_t *) ctx, STATUS_ABORT, "Out of memory");
 
-    v->u.number.r = malloc(string_length + 1);
+    v->u.number.r = YA_MALLOC(&((context_t *) ctx)->afs, string_length + 1);
     if (v->u.number.r == NULL)
     {
-        free(v);
+        YA_FREE(&((context_t *) ctx)->afs, v);
         RETURN_ERROR((context_t *) ctx, STATUS_ABORT, "Out of memory");
     }
     memcpy(v->u.number.r, string, string_length);
@@ -328,7 +406,9 @@ static int handle_start_map (void *ctx)
 {
     yajl_val v;
 
-    v = value_alloc(yajl_t_object);
+    CHECK_HOOK (ctx, yajl_tree_event_start_map, 0);
+
+    v = value_alloc((context_t *) ctx, yajl_t_object);
     if (v == NULL)
         RETURN_ERROR ((context_t *) ctx, STATUS_ABORT, "Out of memory");
 
@@ -343,6 +423,8 @@ static int handle_end_map (void *ctx)
 {
     yajl_val v;
 
+    CHECK_HOOK (ctx, yajl_tree_event_end_map, 0);
+
     v = context_pop (ctx);
     if (v == NULL)
         return (STATUS_ABORT);
@@ -354,7 +436,9 @@ static int handle_start_array (void *ctx)
 {
     yajl_val v;
 
-    v = value_alloc(yajl_t_array);
+    CHECK_HOOK (ctx, yajl_tree_event_start_array, 0);
+
+    v = value_alloc((context_t *) ctx, yajl_t_array);
     if (v == NULL)
         RETURN_ERROR ((context_t *) ctx, STATUS_ABORT, "Out of memory");
 
@@ -368,6 +452,8 @@ static int handle_end_array (void *ctx)
 {
     yajl_val v;
 
+    CHECK_HOOK (ctx, yajl_tree_event_end_array, 0);
+
     v = context_pop (ctx);
     if (v == NULL)
         return (STATUS_ABORT);
@@ -379,7 +465,9 @@ static int handle_boolean (void *ctx, int boolean_value)
 {
     yajl_val v;
 
-    v = value_alloc (boolean_value ? yajl_t_true : yajl_t_false);
+    CHECK_HOOK (ctx, yajl_tree_event_boolean, 0);
+
+    v = value_alloc ((context_t *) ctx, boolean_value ? yajl_t_true : yajl_t_false);
     if (v == NULL)
         RETURN_ERROR ((context_t *) ctx, STATUS_ABORT, "Out of memory");
 
@@ -390,7 +478,9 @@ static int handle_null (void *ctx)
 {
     yajl_val v;
 
-    v = value_alloc (yajl_t_null);
+    CHECK_HOOK (ctx, yajl_tree_event_null, 0);
+
+    v = value_alloc ((context_t *) ctx, yajl_t_null);
     if (v == NULL)
         RETURN_ERROR ((context_t *) ctx, STATUS_ABORT, "Out of memory");
 
@@ -402,6 +492,34 @@ static int handle_null (void *ctx)
  */
 yajl_val yajl_tree_parse (const char *input,
                           char *error_buffer, size_t error_buffer_size)
+{
+    return yajl_tree_parse_hook (input, strlen (input),
+                                 error_buffer, error_buffer_size,
+                                 NULL, NULL, NULL, NULL);
+}
+
+/* Free the partial tree left behind by a failed parse. */
+static void context_free (context_t *ctx)
+{
+    stack_elem_t *stack;
+
+    while (ctx->stack != NULL)
+    {
+        stack = ctx->stack;
+        ctx->stack = stack->next;
+        YA_FREE (&ctx->afs, stack->key);
+        yajl_tree_free_alloc (stack->value, &ctx->afs);
+        YA_FREE (&ctx->afs, stack);
+    }
+    yajl_tree_free_alloc (ctx->root, &ctx->afs);
+    ctx->root = NULL;
+}
+
+yajl_val yajl_tree_parse_hook (const char *input, size_t input_length,
+                               char *error_buffer, size_t error_buffer_size,
+                               yajl_tree_hook hook, void *hook_ctx,
+                               yajl_alloc_funcs *alloc_funcs,
+                               size_t *bytes_consumed)
 {
     static const yajl_callbacks callbacks =
         {
@@ -412,7 +530,7 @@ yajl_val yajl_tree_parse (const char *input,
             /* number      = */ handle_number,
             /* string      = */ handle_string,
             /* start map   = */ handle_start_map,
-            /* map key     = */ handle_string,
+            /* map key     = */ handle_map_key,
             /* end map     = */ handle_end_map,
             /* start array = */ handle_start_array,
             /* end array   = */ handle_end_array
@@ -421,30 +539,40 @@ yajl_val yajl_tree_parse (const char *input,
     yajl_handle handle;
     yajl_status status;
     char * internal_err_str;
-	context_t ctx = { NULL, NULL, NULL, 0 };
-
-	ctx.errbuf = error_buffer;
-	ctx.errbuf_size = error_buffer_size;
+    context_t ctx = { NULL, NULL, NULL, 0, NULL, NULL };
+
+    ctx.errbuf = error_buffer;
+    ctx.errbuf_size = error_buffer_size;
+    ctx.hook = hook;
+    ctx.hook_ctx = hook_ctx;
+    if (alloc_funcs != NULL)
+        ctx.afs = *alloc_funcs;
+    else
+        yajl_set_default_alloc_funcs (&ctx.afs);
 
     if (error_buffer != NULL)
         memset (error_buffer, 0, error_buffer_size);
 
-    handle = yajl_alloc (&callbacks, NULL, &ctx);
+    handle = yajl_alloc (&callbacks, &ctx.afs, &ctx);
     yajl_config(handle, yajl_allow_comments, 1);
 
     status = yajl_parse(handle,
                         (unsigned char *) input,
-                        strlen (input));
-    status = yajl_complete_parse (handle);
+                        input_length);
+    if (status == yajl_status_ok)
+        status = yajl_complete_parse (handle);
     if (status != yajl_status_ok) {
         if (error_buffer != NULL && error_buffer_size > 0) {
                internal_err_str = (char *) yajl_get_error(handle, 1,
                      (const unsigned char *) input,
-                     strlen(input));
+                     input_length);
              snprintf(error_buffer, error_buffer_size, "%s", internal_err_str);
              YA_FREE(&(handle->alloc), internal_err_str);
         }
+        if (bytes_consumed != NULL)
+            *bytes_consumed = yajl_get_bytes_consumed (handle);
         yajl_free (handle);
+        context_free (&ctx);
         return NULL;
     }
 
@@ -476,28 +604,24 @@ yajl_val yajl_tree_get(yajl_val n, const char ** path, yajl_type type)
 
 void yajl_tree_free (yajl_val v)
 {
+    yajl_tree_free_alloc (v, NULL);
+}
+
+void yajl_tree_free_alloc (yajl_val v, yajl_alloc_funcs *alloc_funcs)
+{
+    yajl_alloc_funcs afs;
+    free_stack_t pending = { NULL, NULL, 0, 0 };
+
     if (v == NULL) return;
 
-    if (YAJL_IS_STRING(v))
-    {
-        free(v->u.string);
-        free(v);
-    }
-    else if (YAJL_IS_NUMBER(v))
-    {
-        free(v->u.number.r);
-        free(v);
-    }
-    else if (YAJL_GET_OBJECT(v))
-    {
-        yajl_object_free(v);
-    }
-    else if (YAJL_GET_ARRAY(v))
-    {
-        yajl_array_free(v);
-    }
-    else /* if (yajl_t_true or yajl_t_false or yajl_t_null) */
-    {
-        free(v);
-    }
+    if (alloc_funcs != NULL)
+        afs = *alloc_funcs;
+    else
+        yajl_set_default_alloc_funcs (&afs);
+    pending.afs = &afs;
+
+    yajl_value_free (&pending, v);
+    while (pending.len > 0)
+        yajl_value_free (&pending, pending.values[--pending.len]);
+    YA_FREE (&afs, pending.values);
 }